@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+)
+
+// collectInputs gathers the directories and files to process from the arguments, a path list
+// (- reads stdin) and the files recorded in an earlier results or failures file. Arguments must
+// exist, listed paths that are gone are skipped with a warning.
+func collectInputs(args []string, fromFile string, fromResults string, stdin io.Reader) ([]string, error) {
+	var inputs []string
+	readStdin := fromFile == "-"
+	for _, arg := range args {
+		if arg == "-" {
+			readStdin = true
+			continue
+		}
+		if _, err := os.Stat(arg); err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, arg)
+	}
+
+	var listed []string
+	if readStdin {
+		paths, err := utils.ReadPathList(stdin)
+		if err != nil {
+			return nil, err
+		}
+		listed = append(listed, paths...)
+	}
+	if fromFile != "" && fromFile != "-" {
+		file, err := os.Open(fromFile)
+		if err != nil {
+			return nil, fmt.Errorf("error opening %s: %w", fromFile, err)
+		}
+		paths, err := utils.ReadPathList(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, err
+		}
+		listed = append(listed, paths...)
+	}
+	if fromResults != "" {
+		paths, err := utils.LoadResultPaths(fromResults)
+		if err != nil {
+			return nil, err
+		}
+		listed = append(listed, paths...)
+	}
+	for _, path := range listed {
+		if _, err := os.Stat(path); err != nil {
+			log.Warn().Err(err).Msgf("Skipping listed path %s", path)
+			fmt.Printf("Warning: skipping %s: %v\n", path, err)
+			continue
+		}
+		inputs = append(inputs, path)
+	}
+
+	if len(inputs) == 0 {
+		return nil, errors.New("nothing to process - pass directories or files, --from-file or --from-results")
+	}
+	return inputs, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/bmj2728/go-vmu/internal/ffmpeg"
+	"github.com/bmj2728/go-vmu/internal/processor"
+	"github.com/rs/zerolog/log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// interruptGrace is how long the running files get to kill ffmpeg and revert their inputs
+// before an interrupted run exits anyway
+const interruptGrace = time.Minute
+
+// interrupter stops a run on SIGINT or SIGTERM. The running files are cancelled and cleaned up
+// by the run itself, only a run that does not stop within interruptGrace, or a second signal,
+// makes it exit on the spot.
+type interrupter struct {
+	signals  chan os.Signal
+	received chan os.Signal
+	finished chan struct{}
+}
+
+// watchInterrupts starts stopping proc on the first SIGINT or SIGTERM. runScratch is the
+// scratch directory of the run, if any, removed when vmu has to exit without the run.
+func watchInterrupts(proc *processor.Processor, runScratch string) *interrupter {
+	i := &interrupter{
+		signals:  make(chan os.Signal, 2),
+		received: make(chan os.Signal, 1),
+		finished: make(chan struct{}),
+	}
+	signal.Notify(i.signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		var sig os.Signal
+		select {
+		case sig = <-i.signals:
+		case <-i.finished:
+			return
+		}
+		i.received <- sig
+		log.Warn().Msgf("Received %s, stopping the running files", sig)
+		proc.Stop()
+		select {
+		case <-i.finished:
+			return
+		case <-i.signals:
+			log.Warn().Msg("Received a second signal, exiting now")
+		case <-time.After(interruptGrace):
+			log.Warn().Msgf("Running files did not stop within %s, exiting now", interruptGrace)
+		}
+		if runScratch != "" {
+			log.Warn().Msgf("Removing scratch directory %s", runScratch)
+			_ = os.RemoveAll(runScratch)
+		}
+		removePushTemps()
+		os.Exit(exitCode(sig))
+	}()
+	return i
+}
+
+// done is called once the run returned and reports the signal that stopped it, nil when it
+// ran to the end
+func (i *interrupter) done() os.Signal {
+	close(i.finished)
+	select {
+	case sig := <-i.received:
+		removePushTemps()
+		return sig
+	default:
+		return nil
+	}
+}
+
+// removePushTemps removes the copies still being pushed next to their destination
+func removePushTemps() {
+	for _, name := range ffmpeg.RemovePushTemps() {
+		log.Warn().Msgf("Removed unfinished copy %s", name)
+	}
+}
+
+// exitCode is 128 + the signal number, as a shell reports a process killed by sig
+func exitCode(sig os.Signal) int {
+	if sig == syscall.SIGTERM {
+		return 143
+	}
+	return 130
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/bmj2728/go-vmu/internal/config"
+	"github.com/bmj2728/go-vmu/internal/discovery"
 	"github.com/bmj2728/go-vmu/internal/logger"
-	"github.com/bmj2728/go-vmu/internal/processor"
+	"github.com/bmj2728/go-vmu/internal/mediaserver"
+	"github.com/bmj2728/go-vmu/internal/metrics"
+	"github.com/bmj2728/go-vmu/internal/pool"
+	"github.com/bmj2728/go-vmu/internal/report"
+	"github.com/bmj2728/go-vmu/internal/retry"
+	"github.com/bmj2728/go-vmu/internal/tracker"
 	"github.com/bmj2728/go-vmu/internal/utils"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -19,12 +29,29 @@ func main() {
 	var retries int
 	var resultsPath string
 	var saveResults bool
+	var configPath string
+	var metricsTextfile string
+	var outputDir string
+	var sidecars string
+	var importChapters bool
+	var muxSidecars bool
+	var convertTo string
+	var sniff bool
+	var include, exclude, includeRegex, excludeRegex []string
+	var modifiedSince string
+	var fromFile string
+	var fromResults string
+	var fileTimeout time.Duration
+	var scratchDir string
+	var progressMode string
+	var reportFormats []string
+	var reportNaming string
 
 	rootCmd := &cobra.Command{
-		Use:   "vmu [directory]",
+		Use:   "vmu [directory|file|-]...",
 		Short: "Video Metadata Updater",
 		Long:  "Update metadata in video files based on NFO files",
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.ArbitraryArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 
 			// setup logger
@@ -32,86 +59,240 @@ func main() {
 			log.Info().Msgf("is verbose - %v", verbose)
 			log.Info().Msg("Starting vmu")
 
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
 			// Validate arguments
 
-			//ensure sane worker count
+			//ensure sane worker count - the work is I/O bound, so more workers than CPUs is fine
 			if workerCount < 1 {
 				workerCount = 1
 				log.Warn().Msg("Worker count must be greater than 0, defaulting to 1")
 			}
-			if workerCount > runtime.NumCPU() {
-				workerCount = runtime.NumCPU()
-				log.Warn().Msgf("Worker count must be less than %d, defaulting to %d", runtime.NumCPU(), runtime.NumCPU())
+			//enough workers to fill every filesystem's limit unless told otherwise
+			if !cmd.Flags().Changed("workers") && cfg.Concurrency.Workers() > workerCount {
+				workerCount = cfg.Concurrency.Workers()
 			}
 			//set sane retry attempts val
-			if retries < 0 {
-				retries = 0
-			}
-			if retries > 5 {
-				retries = 5
-			}
+			retries = retry.ClampRetries(retries)
 
-			directory := args[0]
-
-			// Validate directory
-			path, err := os.Stat(directory)
+			// Validate inputs
+			inputs, err := collectInputs(args, fromFile, fromResults, os.Stdin)
 			if err != nil {
 				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
 			}
-			if !path.IsDir() {
-				fmt.Printf("Error: %s is not a directory\n", directory)
+
+			//output tree must not live inside an input or the next run would pick it up
+			if outputDir != "" {
+				absOutput, _ := filepath.Abs(outputDir)
+				for _, input := range inputs {
+					if info, err := os.Stat(input); err != nil || !info.IsDir() {
+						continue
+					}
+					absInput, _ := filepath.Abs(input)
+					if utils.InDir(absInput, absOutput) {
+						fmt.Printf("Error: output directory %s must not be inside %s\n", outputDir, input)
+						os.Exit(1)
+					}
+				}
+			}
+			switch sidecars {
+			case pool.SidecarsNone, pool.SidecarsCopy, pool.SidecarsHardlink:
+			default:
+				fmt.Printf("Error: --sidecars must be one of none, copy or hardlink\n")
 				os.Exit(1)
 			}
-			if len(directory) == 0 {
-				fmt.Printf("Error: directory is empty\n")
+
+			if convertTo != "" {
+				cfg.Convert.To = convertTo
+				if err := cfg.Convert.Validate(); err != nil {
+					fmt.Printf("Error: --convert: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			//asking for a report format implies saving
+			if cmd.Flags().Changed("report-format") {
+				cfg.Report.Formats = reportFormats
+				saveResults = true
+			}
+			if cmd.Flags().Changed("report-name") {
+				cfg.Report.Naming = reportNaming
+			}
+			if err := cfg.Report.Validate(); err != nil {
+				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
 			}
 
 			//if no location don't try to save
 			if saveResults && resultsPath == "" {
-				resultsPath = directory
+				resultsPath = inputs[0]
+				if info, err := os.Stat(resultsPath); err == nil && !info.IsDir() {
+					resultsPath = filepath.Dir(resultsPath)
+				}
 			}
 
-			log.Info().Msgf("Processing directory: %s with %d workers\n", directory, workerCount)
+			log.Info().Msgf("Processing %s with %d workers\n", strings.Join(inputs, ", "), workerCount)
 
 			// Initialize processor
-			proc := processor.NewProcessor(workerCount)
+			proc, hookRunner, err := newProcessor(cfg, workerCount, utils.NewRunID())
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			proc.Reporter, err = tracker.NewReporter(progressMode)
+			if err != nil {
+				fmt.Printf("Error: --progress: %v\n", err)
+				os.Exit(1)
+			}
+			if cmd.Flags().Changed("file-timeout") {
+				proc.Options.Timeouts.File = fileTimeout
+			}
+			if err := proc.Options.Timeouts.Validate(); err != nil {
+				fmt.Printf("Error: --file-timeout: %v\n", err)
+				os.Exit(1)
+			}
+			if sniff {
+				proc.Discovery.Sniff = true
+			}
+			proc.Discovery.Include = append(proc.Discovery.Include, include...)
+			proc.Discovery.Exclude = append(proc.Discovery.Exclude, exclude...)
+			proc.Discovery.IncludeRegex = append(proc.Discovery.IncludeRegex, includeRegex...)
+			proc.Discovery.ExcludeRegex = append(proc.Discovery.ExcludeRegex, excludeRegex...)
+			if modifiedSince != "" {
+				proc.Discovery.ModifiedSince, err = discovery.ParseSince(modifiedSince, time.Now())
+				if err != nil {
+					fmt.Printf("Error: --modified-since: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if err := proc.Discovery.Validate(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			proc.Options.OutputDir = outputDir
+			proc.Options.Sidecars = sidecars
+			if importChapters {
+				proc.Options.Chapters.Enabled = true
+			}
+			if muxSidecars {
+				proc.Options.Tracks.Enabled = true
+			}
+			if scratchDir != "" {
+				if err := os.MkdirAll(scratchDir, 0700); err != nil {
+					fmt.Printf("Error: --scratch-dir: %v\n", err)
+					os.Exit(1)
+				}
+				proc.Options.ScratchDir = scratchDir
+			}
+
+			//an interrupt stops the running files, which kill ffmpeg and revert their inputs, before vmu exits
+			runScratch := ""
+			if proc.Options.ScratchDir != "" {
+				runScratch = proc.Options.RunScratchDir()
+			}
+			interrupts := watchInterrupts(proc, runScratch)
 
 			// Process files
-			results, err := proc.ProcessDirectory(directory, retries)
+			results, err := proc.ProcessPaths(inputs, retries)
+			sig := interrupts.done()
+			if hookRunner != nil {
+				hookRunner.RunFinished(results)
+			}
+			if sig != nil {
+				fmt.Printf("Stopped by %s after %d files\n", sig, len(results))
+				os.Exit(exitCode(sig))
+			}
 			if err != nil {
 				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
 			}
 
 			// Report results
+			fmt.Printf("Run ID: %s\n", proc.Options.RunID)
 			fmt.Printf("Processed %d files. Success: %d, Failed: %d\n",
 				len(results),
 				utils.CountSuccesses(results),
 				len(results)-utils.CountSuccesses(results))
 			counts := utils.GetStatusCounts(results)
 			utils.PrintStatusCounts(counts)
+			utils.PrintDroppedKeys(utils.DroppedKeys(results))
+			utils.PrintExclusions(proc.Excluded)
+
+			// Tell media servers about rewritten files
+			var refreshResults []*mediaserver.RefreshResult
+			if len(cfg.MediaServers) > 0 {
+				refresher := mediaserver.NewRefresher(cfg.MediaServers)
+				refreshResults = refresher.Refresh(context.Background(), utils.ChangedFiles(results))
+				for _, r := range refreshResults {
+					if !r.Success {
+						log.Error().Msgf("Media server refresh failed on %s: %s", r.Server, r.Error)
+					}
+				}
+			}
+
+			if metricsTextfile != "" {
+				if err := metrics.Default.WriteTextfile(metricsTextfile); err != nil {
+					log.Error().Msgf("Error writing metrics textfile: %v", err)
+				}
+			}
 
 			if saveResults {
-				err = utils.SaveResults(filepath.Join(resultsPath, "results.json"), results)
-				if err != nil {
-					log.Error().Msgf("Error saving results: %v", err)
+				runReport := report.New(proc.Options.RunID, cfg.Report.Naming, results)
+				if len(cfg.MediaServers) > 0 {
+					runReport = runReport.WithRefreshes(refreshResults)
 				}
-				err = utils.SaveFailures(filepath.Join(resultsPath, "failures.json"), results)
+				written, err := runReport.Save(resultsPath, cfg.Report.Formats)
 				if err != nil {
 					log.Error().Msgf("Error saving results: %v", err)
 				}
+				for _, file := range written {
+					fmt.Printf("Saved %s\n", file)
+				}
+				if len(proc.Excluded) > 0 {
+					err = utils.SaveExclusions(filepath.Join(resultsPath, runReport.FileName("excluded.json")), proc.Excluded)
+					if err != nil {
+						log.Error().Msgf("Error saving exclusions: %v", err)
+					}
+				}
 			}
 		},
 	}
 
 	// Define flags
-	rootCmd.Flags().IntVarP(&workerCount, "workers", "w", runtime.NumCPU(), "Number of concurrent workers(1-#CPUs)")
+	rootCmd.Flags().IntVarP(&workerCount, "workers", "w", runtime.NumCPU(), "Number of concurrent workers, defaults to the number of CPUs or what the [concurrency] limits need")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
 	rootCmd.Flags().IntVarP(&retries, "retries", "r", 3, "Number of retries (0-5)")
-	rootCmd.Flags().BoolVarP(&saveResults, "save", "s", false, "Save results to file - results.json/failures.json in directory. If no path is specified, results will be saved to processed directory.")
+	rootCmd.Flags().BoolVarP(&saveResults, "save", "s", false, "Save the run reports - results.json/failures.json unless --report-format says otherwise. If no path is specified, reports will be saved to the processed directory.")
 	rootCmd.Flags().StringVarP(&resultsPath, "path", "p", "", "Path to directory to save results")
+	rootCmd.Flags().StringSliceVar(&reportFormats, "report-format", nil, "Formats --save writes: json (results.json/failures.json), csv, ndjson, markdown, html, junit - implies --save")
+	rootCmd.Flags().StringVar(&reportNaming, "report-name", report.NamingFixed, "How report files are named: fixed (overwrite the last run), timestamp or run-id")
+	rootCmd.Flags().StringVarP(&configPath, "config", "c", "", "Path to a TOML config file (media servers, etc.)")
+	rootCmd.Flags().StringVarP(&outputDir, "output-dir", "o", "", "Write tagged files to a mirrored tree under this directory instead of replacing the originals")
+	rootCmd.Flags().StringVar(&sidecars, "sidecars", pool.SidecarsNone, "With --output-dir, bring NFO and image sidecars along: none, copy or hardlink")
+	rootCmd.Flags().BoolVar(&importChapters, "chapters", false, "Import chapters from the NFO <chapters> block or .chapters.xml/.chapters.txt/.segments.json sidecars")
+	rootCmd.Flags().BoolVar(&muxSidecars, "mux-sidecars", false, "Mux subtitle and audio sidecars such as Episode.en.forced.srt into the container")
+	rootCmd.Flags().StringVar(&convertTo, "convert", "", "Remux AVI, MPG, WMV and FLV files into mkv or mp4 while tagging, when no re-encoding is needed")
+	rootCmd.Flags().BoolVar(&sniff, "sniff", false, "Check the first bytes of every file and skip the ones that are not a video container")
+	rootCmd.Flags().StringVar(&fromFile, "from-file", "", "Read newline or NUL separated paths to process from this file, - for stdin")
+	rootCmd.Flags().StringVar(&fromResults, "from-results", "", "Re-run the files recorded in a failures.json or results.json of an earlier run")
+	rootCmd.Flags().StringArrayVar(&include, "include", nil, "Only process files under paths matching this glob, relative to the directory (repeatable)")
+	rootCmd.Flags().StringArrayVar(&exclude, "exclude", nil, "Skip files and folders matching this glob, e.g. Extras or @eaDir/ (repeatable)")
+	rootCmd.Flags().StringArrayVar(&includeRegex, "include-regex", nil, "Only process files whose relative path matches this regular expression (repeatable)")
+	rootCmd.Flags().StringArrayVar(&excludeRegex, "exclude-regex", nil, "Skip files and folders whose relative path matches this regular expression (repeatable)")
+	rootCmd.Flags().StringVar(&modifiedSince, "modified-since", "", "Only process files modified after this date (2006-01-02), timestamp (RFC 3339) or age (36h, 7d)")
+	rootCmd.Flags().StringVar(&scratchDir, "scratch-dir", "", "Copy each file to this local directory, remux and validate it there and push the result back")
+	rootCmd.Flags().DurationVar(&fileTimeout, "file-timeout", 0, "Give up on a file that takes longer than this, e.g. 30m - 0 waits forever")
+	rootCmd.Flags().StringVar(&progressMode, "progress", tracker.ReporterAuto, "How to show progress on stderr: auto (bar on a terminal, text otherwise), bar, text, json (NDJSON events) or silent")
+	rootCmd.Flags().StringVar(&metricsTextfile, "metrics-textfile", "", "Write Prometheus metrics to this file at the end of the run (node_exporter textfile collector)")
+
+	rootCmd.AddCommand(newServeCmd())
+	rootCmd.AddCommand(newRestoreCmd())
+	rootCmd.AddCommand(newUndoCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/backup"
+	"github.com/bmj2728/go-vmu/internal/config"
+	"github.com/bmj2728/go-vmu/internal/logger"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func newRestoreCmd() *cobra.Command {
+	var verbose bool
+	var configPath string
+
+	restoreCmd := &cobra.Command{
+		Use:   "restore <file|run-id>",
+		Short: "Restore originals from retained backups",
+		Long:  "Restore a single file from its newest backup, or every file backed up during a run. Restored files are checked against the checksum recorded at backup time.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Setup(logger.NewLoggerConfig(verbose))
+
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if !cfg.Backup.Enabled() {
+				fmt.Printf("Error: no [backup] section configured, there is nothing to restore from\n")
+				os.Exit(1)
+			}
+			store, err := backup.NewStore(cfg.Backup, cfg.StateDir)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			entries, err := restoreTargets(store, args[0])
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			failed := 0
+			for _, entry := range entries {
+				if err := store.Restore(entry); err != nil {
+					fmt.Printf("FAILED   %s: %v\n", entry.Original, err)
+					failed++
+					continue
+				}
+				fmt.Printf("Restored %s\n", entry.Original)
+			}
+			fmt.Printf("Restored %d of %d files\n", len(entries)-failed, len(entries))
+			if failed > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+
+	restoreCmd.Flags().StringVarP(&configPath, "config", "c", "", "Path to a TOML config file")
+	restoreCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return restoreCmd
+}
+
+// restoreTargets treats an existing path as a file and anything else as a run id
+func restoreTargets(store *backup.Store, target string) ([]backup.Entry, error) {
+	if _, err := os.Stat(target); err == nil {
+		entry, ok, err := store.Latest(target)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("no backup recorded for %s", target)
+		}
+		return []backup.Entry{entry}, nil
+	}
+	entries, err := store.ForRun(target)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s is neither an existing file nor a run with backups", target)
+	}
+	return entries, nil
+}
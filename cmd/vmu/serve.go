@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/config"
+	"github.com/bmj2728/go-vmu/internal/logger"
+	"github.com/bmj2728/go-vmu/internal/retry"
+	"github.com/bmj2728/go-vmu/internal/server"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+)
+
+func newServeCmd() *cobra.Command {
+	var verbose bool
+	var configPath string
+	cfg := server.Config{}
+
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the REST API and web dashboard",
+		Long:  "Serve a REST API for starting and inspecting runs, with a live web dashboard",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Setup(logger.NewLoggerConfig(verbose))
+
+			if cfg.Token == "" {
+				cfg.Token = os.Getenv("VMU_TOKEN")
+			}
+			if cfg.Workers < 1 {
+				cfg.Workers = 1
+			}
+			cfg.Retries = retry.ClampRetries(cfg.Retries)
+
+			fileCfg, err := config.Load(configPath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			srv, err := server.NewServer(cfg)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			//API runs get the same tag policy, journal, backups, limits and hooks as CLI runs
+			srv.RunFunc = func(runID string, directory string, workers int, retries int, listener tracker.Listener) ([]*tracker.ProcessResult, error) {
+				proc, hookRunner, err := newProcessor(fileCfg, workers, runID)
+				if err != nil {
+					return nil, err
+				}
+				proc.Listeners = append(proc.Listeners, listener)
+				//the API streams the events, a bar would only clutter the server log
+				proc.Reporter = tracker.NewSilentReporter()
+				results, err := proc.ProcessDirectory(directory, retries)
+				if hookRunner != nil {
+					hookRunner.RunFinished(results)
+				}
+				return results, err
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if err := srv.ListenAndServe(ctx); err != nil {
+				log.Error().Err(err).Msg("Server error")
+				os.Exit(1)
+			}
+		},
+	}
+
+	serveCmd.Flags().StringVarP(&cfg.Addr, "addr", "a", ":8080", "Address to listen on")
+	serveCmd.Flags().StringVarP(&cfg.Token, "token", "t", "", "API token (defaults to $VMU_TOKEN)")
+	serveCmd.Flags().StringVarP(&cfg.DataDir, "data-dir", "d", "", "Directory to persist run history in")
+	serveCmd.Flags().IntVarP(&cfg.Workers, "workers", "w", runtime.NumCPU(), "Number of concurrent workers per run")
+	serveCmd.Flags().IntVarP(&cfg.Retries, "retries", "r", 3, "Number of retries per run")
+	serveCmd.Flags().StringVarP(&configPath, "config", "c", "", "Path to a TOML config file applied to every run")
+	serveCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return serveCmd
+}
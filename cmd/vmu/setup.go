@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/bmj2728/go-vmu/internal/backup"
+	"github.com/bmj2728/go-vmu/internal/config"
+	"github.com/bmj2728/go-vmu/internal/diskspace"
+	"github.com/bmj2728/go-vmu/internal/hooks"
+	"github.com/bmj2728/go-vmu/internal/iolimit"
+	"github.com/bmj2728/go-vmu/internal/journal"
+	"github.com/bmj2728/go-vmu/internal/processor"
+)
+
+// newProcessor builds a processor with the settings of the config file, shared by CLI and API runs,
+// for the run runID. The hook runner is nil when no hooks are configured.
+func newProcessor(cfg *config.Config, workers int, runID string) (*processor.Processor, *hooks.Runner, error) {
+	proc := processor.NewProcessor(workers)
+	proc.Retry = cfg.Retry
+	proc.Discovery = cfg.Discovery
+	proc.Options.RunID = runID
+	proc.Options.Timeouts = cfg.Timeouts
+	proc.Options.Journal = journal.NewJournal(cfg.JournalDir())
+	proc.Options.TagPolicy = cfg.Tags
+	proc.Options.Chapters = cfg.Chapters
+	proc.Options.Tracks = cfg.Tracks
+	proc.Options.Convert = cfg.Convert
+
+	var err error
+	if cfg.Concurrency.Enabled() {
+		proc.Options.Limiter, err = iolimit.NewLimiter(cfg.Concurrency)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.DiskSpace.Check {
+		proc.Options.Space = diskspace.NewReservations(cfg.DiskSpace)
+	}
+	if cfg.Backup.Enabled() {
+		proc.Options.Backups, err = backup.NewStore(cfg.Backup, cfg.StateDir)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var hookRunner *hooks.Runner
+	if len(cfg.Hooks) > 0 {
+		hookRunner = hooks.NewRunner(cfg.Hooks, runID)
+		proc.Listeners = append(proc.Listeners, hookRunner.Listener)
+		proc.OnResult = hookRunner.FileFinished
+	}
+	return proc, hookRunner, nil
+}
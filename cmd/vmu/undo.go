@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/backup"
+	"github.com/bmj2728/go-vmu/internal/config"
+	"github.com/bmj2728/go-vmu/internal/journal"
+	"github.com/bmj2728/go-vmu/internal/logger"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func newUndoCmd() *cobra.Command {
+	var verbose bool
+	var configPath string
+
+	undoCmd := &cobra.Command{
+		Use:   "undo <run-id>",
+		Short: "Re-apply the tags files had before a run",
+		Long:  "Rewrite every file changed by a run with exactly the tags recorded in that run's journal. Unlike restore this needs no full-file backups.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Setup(logger.NewLoggerConfig(verbose))
+
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			var backups *backup.Store
+			if cfg.Backup.Enabled() {
+				backups, err = backup.NewStore(cfg.Backup, cfg.StateDir)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			entries, err := journal.NewJournal(cfg.JournalDir()).Entries(args[0])
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			// the undo is a run of its own so its backups do not mix with the original run's
+			runID := utils.NewRunID()
+			fmt.Printf("Run ID: %s\n", runID)
+
+			failed := 0
+			for _, entry := range entries {
+				if err := journal.Revert(entry, backups, runID); err != nil {
+					fmt.Printf("FAILED   %s: %v\n", entry.Path, err)
+					failed++
+					continue
+				}
+				fmt.Printf("Reverted %s\n", entry.Path)
+			}
+			fmt.Printf("Reverted %d of %d files\n", len(entries)-failed, len(entries))
+			if failed > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+
+	undoCmd.Flags().StringVarP(&configPath, "config", "c", "", "Path to a TOML config file")
+	undoCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return undoCmd
+}
@@ -0,0 +1,327 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backup locations
+const (
+	ModeDir     = "dir"
+	ModeInPlace = "in-place"
+)
+
+// Config controls where backups are kept and for how long
+type Config struct {
+	// Mode is "dir" to keep backups under Dir or "in-place" to keep them next to the original
+	Mode string `toml:"mode"`
+	Dir  string `toml:"dir"`
+	// KeepCount is the number of backups kept per file, 0 keeps all
+	KeepCount int `toml:"keep_count"`
+	// MaxAgeDays removes backups older than this, 0 disables
+	MaxAgeDays int `toml:"max_age_days"`
+	// MaxTotalSizeMB removes the oldest backups once the store grows past this, 0 disables
+	MaxTotalSizeMB int64 `toml:"max_total_size_mb"`
+}
+
+// Enabled reports whether backups should be retained at all
+func (c Config) Enabled() bool {
+	return c.Mode != ""
+}
+
+// Entry records a single retained backup
+type Entry struct {
+	RunID     string    `json:"run_id"`
+	Original  string    `json:"original"`
+	Backup    string    `json:"backup"`
+	Checksum  string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store keeps retained backups and a manifest describing them
+type Store struct {
+	Config   Config
+	manifest string
+	mu       sync.Mutex
+}
+
+// NewStore creates a store whose manifest lives in stateDir
+func NewStore(cfg Config, stateDir string) (*Store, error) {
+	switch cfg.Mode {
+	case ModeDir:
+		if cfg.Dir == "" {
+			cfg.Dir = filepath.Join(stateDir, "backups")
+		}
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return nil, fmt.Errorf("error creating backup directory %s: %w", cfg.Dir, err)
+		}
+	case ModeInPlace:
+	default:
+		return nil, fmt.Errorf("unknown backup mode %q - use %q or %q", cfg.Mode, ModeDir, ModeInPlace)
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating state directory %s: %w", stateDir, err)
+	}
+	return &Store{
+		Config:   cfg,
+		manifest: filepath.Join(stateDir, "backups.json"),
+	}, nil
+}
+
+// Path returns where the backup of original is written for the given run
+func (s *Store) Path(original string, runID string) string {
+	if s.Config.Mode == ModeInPlace {
+		return utils.InsertTagToFileName(original, "backup."+runID)
+	}
+	abs, err := filepath.Abs(original)
+	if err != nil {
+		abs = original
+	}
+	// mirror the absolute path so files with the same name never collide
+	return filepath.Join(s.Config.Dir, runID, strings.TrimPrefix(abs, string(filepath.Separator)))
+}
+
+// Add records a backup in the manifest
+func (s *Store) Add(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.load()
+	if err != nil {
+		return err
+	}
+	entries = append(entries, entry)
+	return s.save(entries)
+}
+
+// Entries returns all recorded backups, oldest first
+func (s *Store) Entries() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// ForRun returns the backups taken during a run
+func (s *Store) ForRun(runID string) ([]Entry, error) {
+	entries, err := s.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var matches []Entry
+	for _, entry := range entries {
+		if entry.RunID == runID {
+			matches = append(matches, entry)
+		}
+	}
+	return matches, nil
+}
+
+// Latest returns the newest backup of original
+func (s *Store) Latest(original string) (Entry, bool, error) {
+	entries, err := s.Entries()
+	if err != nil {
+		return Entry{}, false, err
+	}
+	abs, err := filepath.Abs(original)
+	if err != nil {
+		abs = original
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Original == abs || entries[i].Original == original {
+			return entries[i], true, nil
+		}
+	}
+	return Entry{}, false, nil
+}
+
+// Prune applies the retention policy, removing backups by count, age and then total size
+func (s *Store) Prune() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	remove := make(map[int]bool)
+	if s.Config.KeepCount > 0 {
+		perFile := make(map[string]int)
+		for i := len(entries) - 1; i >= 0; i-- {
+			perFile[entries[i].Original]++
+			if perFile[entries[i].Original] > s.Config.KeepCount {
+				remove[i] = true
+			}
+		}
+	}
+	if s.Config.MaxAgeDays > 0 {
+		cutoff := time.Now().Add(-time.Duration(s.Config.MaxAgeDays) * 24 * time.Hour)
+		for i, entry := range entries {
+			if entry.CreatedAt.Before(cutoff) {
+				remove[i] = true
+			}
+		}
+	}
+	if s.Config.MaxTotalSizeMB > 0 {
+		limit := s.Config.MaxTotalSizeMB * 1024 * 1024
+		var total int64
+		for i := len(entries) - 1; i >= 0; i-- {
+			if remove[i] {
+				continue
+			}
+			total += entries[i].Size
+			if total > limit {
+				remove[i] = true
+			}
+		}
+	}
+
+	kept := make([]Entry, 0, len(entries))
+	var errs []error
+	for i, entry := range entries {
+		if !remove[i] {
+			kept = append(kept, entry)
+			continue
+		}
+		log.Debug().Msgf("Pruning backup %s of %s", entry.Backup, entry.Original)
+		if err := os.Remove(entry.Backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			// keep the entry so the file is not orphaned
+			kept = append(kept, entry)
+			errs = append(errs, err)
+			continue
+		}
+		s.removeEmptyDirs(filepath.Dir(entry.Backup))
+	}
+	if err := s.save(kept); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Restore copies a backup over its original and verifies the result against the recorded checksum
+func (s *Store) Restore(entry Entry) error {
+	tmp := utils.InsertTagToFileName(entry.Original, "govmu-restore")
+	if err := os.MkdirAll(filepath.Dir(entry.Original), 0755); err != nil {
+		return fmt.Errorf("error recreating directory for %s: %w", entry.Original, err)
+	}
+	sum, err := copyWithChecksum(entry.Backup, tmp)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("error restoring %s: %w", entry.Original, err)
+	}
+	if sum != entry.Checksum {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("checksum mismatch restoring %s: backup %s has %s, recorded %s", entry.Original, entry.Backup, sum, entry.Checksum)
+	}
+	if err := os.Rename(tmp, entry.Original); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("error moving restored file into place: %w", err)
+	}
+	log.Info().Msgf("Restored %s from %s", entry.Original, entry.Backup)
+	return nil
+}
+
+// CopyWithChecksum copies src to dst, creating parent directories, and returns the sha256 of the data
+func CopyWithChecksum(src string, dst string) (string, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	sum, err := copyWithChecksum(src, dst)
+	if err != nil {
+		return "", 0, err
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		return "", 0, err
+	}
+	return sum, info.Size(), nil
+}
+
+func copyWithChecksum(src string, dst string) (string, error) {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer func() {
+		if err := sourceFile.Close(); err != nil {
+			log.Debug().Err(err).Msgf("Error closing %s", src)
+		}
+	}()
+	destFile, err := os.Create(dst)
+	if err != nil {
+		return "", fmt.Errorf("failed to create destination file: %w", err)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(destFile, hash), sourceFile); err != nil {
+		_ = destFile.Close()
+		return "", fmt.Errorf("error copying file: %w", err)
+	}
+	if err := destFile.Sync(); err != nil {
+		_ = destFile.Close()
+		return "", fmt.Errorf("error syncing file: %w", err)
+	}
+	if err := destFile.Close(); err != nil {
+		return "", fmt.Errorf("error closing destination file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// removeEmptyDirs cleans up empty run directories left behind in dir mode
+func (s *Store) removeEmptyDirs(dir string) {
+	if s.Config.Mode != ModeDir {
+		return
+	}
+	root := filepath.Clean(s.Config.Dir)
+	for dir != root && strings.HasPrefix(dir, root) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// load reads the manifest, callers must hold the lock
+func (s *Store) load() ([]Entry, error) {
+	data, err := os.ReadFile(s.manifest)
+	if errors.Is(err, os.ErrNotExist) {
+		return make([]Entry, 0), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup manifest: %w", err)
+	}
+	entries := make([]Entry, 0)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("error parsing backup manifest: %w", err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+// save writes the manifest atomically, callers must hold the lock
+func (s *Store) save(entries []Entry) error {
+	data, err := json.MarshalIndent(entries, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error marshalling backup manifest: %w", err)
+	}
+	tmp := s.manifest + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing backup manifest: %w", err)
+	}
+	if err := os.Rename(tmp, s.manifest); err != nil {
+		return fmt.Errorf("error writing backup manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStore(t *testing.T) {
+	stateDir := t.TempDir()
+
+	store, err := NewStore(Config{Mode: ModeDir}, stateDir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(stateDir, "backups"), store.Config.Dir)
+	assert.DirExists(t, store.Config.Dir)
+
+	_, err = NewStore(Config{Mode: "cloud"}, stateDir)
+	assert.Error(t, err)
+}
+
+func TestStore_Path(t *testing.T) {
+	stateDir := t.TempDir()
+
+	inPlace, err := NewStore(Config{Mode: ModeInPlace}, stateDir)
+	assert.NoError(t, err)
+	assert.Equal(t, "/tv/ep1.backup.run1.mkv", inPlace.Path("/tv/ep1.mkv", "run1"))
+
+	dir, err := NewStore(Config{Mode: ModeDir, Dir: "/backups"}, stateDir)
+	assert.NoError(t, err)
+	assert.Equal(t, "/backups/run1/tv/ep1.mkv", dir.Path("/tv/ep1.mkv", "run1"))
+}
+
+func TestStore_Entries(t *testing.T) {
+	store, err := NewStore(Config{Mode: ModeInPlace}, t.TempDir())
+	assert.NoError(t, err)
+	now := time.Now()
+
+	assert.NoError(t, store.Add(Entry{RunID: "run2", Original: "/tv/ep1.mkv", Backup: "b2", CreatedAt: now}))
+	assert.NoError(t, store.Add(Entry{RunID: "run1", Original: "/tv/ep1.mkv", Backup: "b1", CreatedAt: now.Add(-time.Hour)}))
+	assert.NoError(t, store.Add(Entry{RunID: "run2", Original: "/tv/ep2.mkv", Backup: "b3", CreatedAt: now}))
+
+	entries, err := store.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "b1", entries[0].Backup)
+
+	latest, ok, err := store.Latest("/tv/ep1.mkv")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "b2", latest.Backup)
+
+	_, ok, err = store.Latest("/tv/ep3.mkv")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	run, err := store.ForRun("run2")
+	assert.NoError(t, err)
+	assert.Len(t, run, 2)
+}
+
+// addBackup writes a backup file of the given size and records it
+func addBackup(t *testing.T, store *Store, original string, runID string, size int, created time.Time) Entry {
+	t.Helper()
+	path := store.Path(original, runID)
+	assert.NoError(t, os.WriteFile(path, make([]byte, size), 0644))
+	entry := Entry{RunID: runID, Original: original, Backup: path, Size: int64(size), CreatedAt: created}
+	assert.NoError(t, store.Add(entry))
+	return entry
+}
+
+func TestStore_Prune(t *testing.T) {
+	now := time.Now()
+
+	t.Run("keep count", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewStore(Config{Mode: ModeInPlace, KeepCount: 1}, t.TempDir())
+		assert.NoError(t, err)
+		original := filepath.Join(dir, "ep1.mkv")
+		old := addBackup(t, store, original, "run1", 10, now.Add(-time.Hour))
+		newest := addBackup(t, store, original, "run2", 10, now)
+
+		assert.NoError(t, store.Prune())
+
+		entries, err := store.Entries()
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, newest.Backup, entries[0].Backup)
+		assert.NoFileExists(t, old.Backup)
+		assert.FileExists(t, newest.Backup)
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewStore(Config{Mode: ModeInPlace, MaxAgeDays: 7}, t.TempDir())
+		assert.NoError(t, err)
+		old := addBackup(t, store, filepath.Join(dir, "ep1.mkv"), "run1", 10, now.Add(-10*24*time.Hour))
+		recent := addBackup(t, store, filepath.Join(dir, "ep2.mkv"), "run2", 10, now)
+
+		assert.NoError(t, store.Prune())
+
+		assert.NoFileExists(t, old.Backup)
+		assert.FileExists(t, recent.Backup)
+	})
+
+	t.Run("max total size", func(t *testing.T) {
+		stateDir := t.TempDir()
+		store, err := NewStore(Config{Mode: ModeDir, MaxTotalSizeMB: 1}, stateDir)
+		assert.NoError(t, err)
+		original := filepath.Join(t.TempDir(), "ep1.mkv")
+		assert.NoError(t, os.MkdirAll(filepath.Dir(store.Path(original, "run1")), 0755))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(store.Path(original, "run2")), 0755))
+		old := addBackup(t, store, original, "run1", 700*1024, now.Add(-time.Hour))
+		recent := addBackup(t, store, original, "run2", 700*1024, now)
+
+		assert.NoError(t, store.Prune())
+
+		assert.NoFileExists(t, old.Backup)
+		assert.FileExists(t, recent.Backup)
+		// the emptied run directory is cleaned up
+		assert.NoDirExists(t, filepath.Join(store.Config.Dir, "run1"))
+	})
+}
+
+func TestStore_Restore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(Config{Mode: ModeDir}, t.TempDir())
+	assert.NoError(t, err)
+	original := filepath.Join(dir, "ep1.mkv")
+	assert.NoError(t, os.WriteFile(original, []byte("original data"), 0644))
+
+	backupPath := store.Path(original, "run1")
+	sum, size, err := CopyWithChecksum(original, backupPath)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(13), size)
+	entry := Entry{RunID: "run1", Original: original, Backup: backupPath, Checksum: sum, Size: size}
+
+	assert.NoError(t, os.WriteFile(original, []byte("tagged data"), 0644))
+	assert.NoError(t, store.Restore(entry))
+	content, err := os.ReadFile(original)
+	assert.NoError(t, err)
+	assert.Equal(t, "original data", string(content))
+
+	// a corrupted backup is refused and the current file is left alone
+	assert.NoError(t, os.WriteFile(backupPath, []byte("corrupted"), 0644))
+	assert.Error(t, store.Restore(entry))
+	content, err = os.ReadFile(original)
+	assert.NoError(t, err)
+	assert.Equal(t, "original data", string(content))
+	matches, err := filepath.Glob(filepath.Join(dir, "*govmu-restore*"))
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+}
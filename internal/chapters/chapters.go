@@ -0,0 +1,134 @@
+package chapters
+
+import (
+	"fmt"
+	"gopkg.in/vansante/go-ffprobe.v2"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Chapter writers
+const (
+	// WriterFFMetadata passes an FFMETADATA file to the ffmpeg remux, works for every container
+	WriterFFMetadata = "ffmetadata"
+	// WriterMkvpropedit writes Matroska chapter XML into the remuxed file with mkvpropedit
+	WriterMkvpropedit = "mkvpropedit"
+)
+
+// Config controls chapter import
+type Config struct {
+	Enabled bool   `toml:"enabled"`
+	Writer  string `toml:"writer"`
+}
+
+// Validate checks the writer
+func (c Config) Validate() error {
+	switch c.Writer {
+	case "", WriterFFMetadata, WriterMkvpropedit:
+		return nil
+	default:
+		return fmt.Errorf("unknown chapter writer %q - use %q or %q", c.Writer, WriterFFMetadata, WriterMkvpropedit)
+	}
+}
+
+// Chapter is a single named section of a video
+type Chapter struct {
+	Start time.Duration
+	End   time.Duration
+	Title string
+}
+
+// tolerance absorbs the rounding of the different timestamp formats
+const tolerance = time.Millisecond
+
+// Normalize sorts chapters by start and fills missing ends from the next chapter,
+// the last one ends at duration when it is known
+func Normalize(chapters []Chapter, duration time.Duration) []Chapter {
+	normalized := append([]Chapter(nil), chapters...)
+	sort.SliceStable(normalized, func(i, j int) bool {
+		return normalized[i].Start < normalized[j].Start
+	})
+	for i := range normalized {
+		if normalized[i].End > normalized[i].Start {
+			continue
+		}
+		switch {
+		case i+1 < len(normalized):
+			normalized[i].End = normalized[i+1].Start
+		case duration > normalized[i].Start:
+			normalized[i].End = duration
+		default:
+			normalized[i].End = normalized[i].Start
+		}
+	}
+	return normalized
+}
+
+// Equal reports whether two chapter lists have the same starts, ends and titles
+func Equal(a []Chapter, b []Chapter) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Title != b[i].Title || !near(a[i].Start, b[i].Start) || !near(a[i].End, b[i].End) {
+			return false
+		}
+	}
+	return true
+}
+
+func near(a time.Duration, b time.Duration) bool {
+	return math.Abs(float64(a-b)) <= float64(tolerance)
+}
+
+// FromProbe converts the chapters reported by ffprobe
+func FromProbe(probed []*ffprobe.Chapter) []Chapter {
+	chapters := make([]Chapter, 0, len(probed))
+	for _, chapter := range probed {
+		chapters = append(chapters, Chapter{
+			Start: chapter.StartTime(),
+			End:   chapter.EndTime(),
+			Title: chapter.Title(),
+		})
+	}
+	return chapters
+}
+
+// ParseTimestamp reads "HH:MM:SS.fff", "MM:SS.fff" or plain seconds
+func ParseTimestamp(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("empty timestamp")
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	var total float64
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil || number < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		// only the seconds may carry a fraction
+		if i < len(parts)-1 && number != math.Trunc(number) {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		total = total*60 + number
+	}
+	return time.Duration(math.Round(total * float64(time.Second))), nil
+}
+
+// FormatTimestamp writes the "HH:MM:SS.nnnnnnnnn" form used by Matroska chapter XML
+func FormatTimestamp(d time.Duration) string {
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+	d -= seconds * time.Second
+	return fmt.Sprintf("%02d:%02d:%02d.%09d", hours, minutes, seconds, d)
+}
@@ -0,0 +1,185 @@
+package chapters
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmj2728/go-vmu/internal/nfo"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	cases := map[string]time.Duration{
+		"00:01:30.500":       90*time.Second + 500*time.Millisecond,
+		"01:00:00.000000000": time.Hour,
+		"02:15":              2*time.Minute + 15*time.Second,
+		"90.25":              90*time.Second + 250*time.Millisecond,
+	}
+	for input, expected := range cases {
+		actual, err := ParseTimestamp(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, actual, input)
+	}
+
+	for _, input := range []string{"", "abc", "1:2:3:4", "1.5:00", "-5"} {
+		_, err := ParseTimestamp(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	assert.Equal(t, "01:02:03.500000000", FormatTimestamp(time.Hour+2*time.Minute+3*time.Second+500*time.Millisecond))
+}
+
+func TestNormalize(t *testing.T) {
+	chapters := Normalize([]Chapter{
+		{Start: 10 * time.Minute, Title: "Act 2"},
+		{Start: 0, Title: "Act 1"},
+	}, 20*time.Minute)
+
+	assert.Equal(t, []Chapter{
+		{Start: 0, End: 10 * time.Minute, Title: "Act 1"},
+		{Start: 10 * time.Minute, End: 20 * time.Minute, Title: "Act 2"},
+	}, chapters)
+}
+
+func TestEqual(t *testing.T) {
+	a := []Chapter{{Start: 0, End: time.Minute, Title: "Intro"}}
+
+	assert.True(t, Equal(a, []Chapter{{Start: 0, End: time.Minute + 500*time.Microsecond, Title: "Intro"}}))
+	assert.False(t, Equal(a, []Chapter{{Start: 0, End: time.Minute, Title: "Opening"}}))
+	assert.False(t, Equal(a, nil))
+}
+
+func TestFromProbe(t *testing.T) {
+	probed := []*ffprobe.Chapter{{StartTimeSeconds: 0, EndTimeSeconds: 60, TagList: ffprobe.Tags{"title": "Intro"}}}
+
+	assert.Equal(t, []Chapter{{Start: 0, End: time.Minute, Title: "Intro"}}, FromProbe(probed))
+}
+
+func TestParseOGM(t *testing.T) {
+	chapters, err := ParseOGM(strings.NewReader("\ufeffCHAPTER01=00:00:00.000\nCHAPTER01NAME=Intro\nCHAPTER02=00:01:30.000\nCHAPTER02NAME=Episode\n"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Chapter{
+		{Start: 0, Title: "Intro"},
+		{Start: 90 * time.Second, Title: "Episode"},
+	}, chapters)
+
+	_, err = ParseOGM(strings.NewReader("not a chapter"))
+	assert.Error(t, err)
+}
+
+func TestParseMatroskaXML(t *testing.T) {
+	chapters, err := ParseMatroskaXML(strings.NewReader(`<?xml version="1.0"?>
+<Chapters>
+  <EditionEntry>
+    <ChapterAtom>
+      <ChapterTimeStart>00:00:00.000000000</ChapterTimeStart>
+      <ChapterTimeEnd>00:01:00.000000000</ChapterTimeEnd>
+      <ChapterDisplay><ChapterString>Intro</ChapterString><ChapterLanguage>eng</ChapterLanguage></ChapterDisplay>
+    </ChapterAtom>
+    <ChapterAtom>
+      <ChapterTimeStart>00:01:00.000000000</ChapterTimeStart>
+      <ChapterDisplay><ChapterString>Episode</ChapterString></ChapterDisplay>
+    </ChapterAtom>
+  </EditionEntry>
+</Chapters>`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Chapter{
+		{Start: 0, End: time.Minute, Title: "Intro"},
+		{Start: time.Minute, Title: "Episode"},
+	}, chapters)
+}
+
+func TestMatroskaXML_RoundTrip(t *testing.T) {
+	chapters := []Chapter{
+		{Start: 0, End: time.Minute, Title: "Intro"},
+		{Start: time.Minute, End: 20 * time.Minute, Title: "Episode"},
+	}
+
+	data, err := MatroskaXML(chapters)
+	assert.NoError(t, err)
+
+	parsed, err := ParseMatroskaXML(strings.NewReader(string(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, chapters, parsed)
+}
+
+func TestSegmentsToChapters(t *testing.T) {
+	segments, err := ParseSegments(strings.NewReader(`{"Items":[
+		{"Type":"Outro","StartTicks":11400000000,"EndTicks":12000000000},
+		{"Type":"Intro","StartTicks":300000000,"EndTicks":900000000}
+	]}`))
+	assert.NoError(t, err)
+
+	chapters := SegmentsToChapters(segments, 21*time.Minute)
+
+	assert.Equal(t, []Chapter{
+		{Start: 0, End: 30 * time.Second, Title: "Episode"},
+		{Start: 30 * time.Second, End: 90 * time.Second, Title: "Intro"},
+		{Start: 90 * time.Second, End: 19 * time.Minute, Title: "Episode"},
+		{Start: 19 * time.Minute, End: 20 * time.Minute, Title: "Credits"},
+		{Start: 20 * time.Minute, End: 21 * time.Minute, Title: "Episode"},
+	}, chapters)
+
+	// a bare array is accepted too
+	segments, err = ParseSegments(strings.NewReader(`[{"Type":"Recap","StartTicks":0,"EndTicks":600000000}]`))
+	assert.NoError(t, err)
+	assert.Len(t, segments, 1)
+}
+
+func TestFFMetadata(t *testing.T) {
+	output := FFMetadata([]Chapter{{Start: 0, End: 1500 * time.Millisecond, Title: "Part 1; a=b"}})
+
+	assert.Equal(t, ";FFMETADATA1\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=1500\ntitle=Part 1\\; a\\=b\n", output)
+}
+
+func TestFind(t *testing.T) {
+	tmpDir := t.TempDir()
+	video := filepath.Join(tmpDir, "ep1.mkv")
+
+	chapters, source, err := Find(video, &nfo.EpisodeDetails{}, time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, chapters)
+	assert.Empty(t, source)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "ep1.chapters.txt"), []byte("CHAPTER01=00:00:00.000\nCHAPTER01NAME=Intro\n"), 0644))
+	chapters, source, err = Find(video, &nfo.EpisodeDetails{}, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(tmpDir, "ep1.chapters.txt"), source)
+	assert.Equal(t, []Chapter{{Start: 0, End: time.Minute, Title: "Intro"}}, chapters)
+
+	// the nfo wins over sidecars
+	episode := &nfo.EpisodeDetails{Chapters: []nfo.Chapter{{Title: "Cold Open", Start: "0"}, {Title: "Episode", Start: "00:02:00"}}}
+	chapters, source, err = Find(video, episode, 10*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "nfo", source)
+	assert.Equal(t, []Chapter{
+		{Start: 0, End: 2 * time.Minute, Title: "Cold Open"},
+		{Start: 2 * time.Minute, End: 10 * time.Minute, Title: "Episode"},
+	}, chapters)
+
+	_, _, err = Find(video, &nfo.EpisodeDetails{Chapters: []nfo.Chapter{{Title: "Broken", Start: "soon"}}}, time.Minute)
+	assert.ErrorIs(t, err, ErrInvalid)
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "ep1.chapters.txt"), []byte("not a chapter\n"), 0644))
+	_, _, err = Find(video, &nfo.EpisodeDetails{}, time.Minute)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	// a symlink loop exists but cannot be opened
+	sidecar := filepath.Join(tmpDir, "ep1.chapters.xml")
+	assert.NoError(t, os.Symlink(sidecar, sidecar))
+	_, _, err = Find(video, &nfo.EpisodeDetails{}, time.Minute)
+	assert.ErrorIs(t, err, ErrUnreadable)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, Config{}.Validate())
+	assert.NoError(t, Config{Writer: WriterMkvpropedit}.Validate())
+	assert.Error(t, Config{Writer: "mp4box"}.Validate())
+}
@@ -0,0 +1,70 @@
+package chapters
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/nfo"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sidecar suffixes next to the video, checked in this order after the NFO
+const (
+	MatroskaSuffix = ".chapters.xml"
+	OGMSuffix      = ".chapters.txt"
+	SegmentsSuffix = ".segments.json"
+)
+
+// ErrInvalid is wrapped by the errors of chapter sources that cannot be parsed
+var ErrInvalid = errors.New("invalid chapters")
+
+// ErrUnreadable is wrapped by the errors of chapter sources that exist but cannot be read
+var ErrUnreadable = errors.New("unreadable chapters")
+
+// Find returns the chapters for a video and where they came from. The NFO <chapters> block wins,
+// then Matroska XML, OGM and Jellyfin segment sidecars. No source returns nil chapters.
+func Find(videoPath string, episode *nfo.EpisodeDetails, duration time.Duration) ([]Chapter, string, error) {
+	if episode != nil && len(episode.Chapters) > 0 {
+		chapters, err := FromNFO(episode.Chapters)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w in NFO: %w", ErrInvalid, err)
+		}
+		return Normalize(chapters, duration), "nfo", nil
+	}
+
+	base := strings.TrimSuffix(videoPath, filepath.Ext(videoPath))
+	sources := []struct {
+		suffix string
+		parse  func(io.Reader) ([]Chapter, error)
+	}{
+		{MatroskaSuffix, ParseMatroskaXML},
+		{OGMSuffix, ParseOGM},
+		{SegmentsSuffix, func(r io.Reader) ([]Chapter, error) {
+			segments, err := ParseSegments(r)
+			if err != nil {
+				return nil, err
+			}
+			return SegmentsToChapters(segments, duration), nil
+		}},
+	}
+	for _, source := range sources {
+		path := base + source.suffix
+		file, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: error opening %s: %w", ErrUnreadable, path, err)
+		}
+		chapters, err := source.parse(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, "", fmt.Errorf("%w in %s: %w", ErrInvalid, path, err)
+		}
+		return Normalize(chapters, duration), path, nil
+	}
+	return nil, "", nil
+}
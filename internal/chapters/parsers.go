@@ -0,0 +1,203 @@
+package chapters
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/nfo"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ogmLine = regexp.MustCompile(`^CHAPTER(\d+)(NAME)?=(.*)$`)
+
+// ParseOGM reads the simple OGM format used by mkvmerge and many rippers
+// example: CHAPTER01=00:00:00.000 / CHAPTER01NAME=Intro
+func ParseOGM(r io.Reader) ([]Chapter, error) {
+	byNumber := make(map[string]*Chapter)
+	var order []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" {
+			continue
+		}
+		match := ogmLine.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("invalid OGM chapter line %q", line)
+		}
+		chapter, ok := byNumber[match[1]]
+		if !ok {
+			chapter = &Chapter{}
+			byNumber[match[1]] = chapter
+			order = append(order, match[1])
+		}
+		if match[2] != "" {
+			chapter.Title = match[3]
+			continue
+		}
+		start, err := ParseTimestamp(match[3])
+		if err != nil {
+			return nil, err
+		}
+		chapter.Start = start
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading OGM chapters: %w", err)
+	}
+	chapters := make([]Chapter, 0, len(order))
+	for _, number := range order {
+		chapters = append(chapters, *byNumber[number])
+	}
+	return chapters, nil
+}
+
+type matroskaChapters struct {
+	XMLName  xml.Name          `xml:"Chapters"`
+	Editions []matroskaEdition `xml:"EditionEntry"`
+}
+
+type matroskaEdition struct {
+	Default int            `xml:"EditionFlagDefault,omitempty"`
+	Atoms   []matroskaAtom `xml:"ChapterAtom"`
+}
+
+type matroskaAtom struct {
+	Start    string            `xml:"ChapterTimeStart"`
+	End      string            `xml:"ChapterTimeEnd,omitempty"`
+	Displays []matroskaDisplay `xml:"ChapterDisplay"`
+}
+
+type matroskaDisplay struct {
+	String   string `xml:"ChapterString"`
+	Language string `xml:"ChapterLanguage,omitempty"`
+}
+
+// ParseMatroskaXML reads mkvextract/mkvmerge chapter XML, using the default edition or the first one
+func ParseMatroskaXML(r io.Reader) ([]Chapter, error) {
+	var doc matroskaChapters
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error parsing Matroska chapters: %w", err)
+	}
+	if len(doc.Editions) == 0 {
+		return nil, nil
+	}
+	edition := doc.Editions[0]
+	for _, candidate := range doc.Editions {
+		if candidate.Default == 1 {
+			edition = candidate
+			break
+		}
+	}
+	chapters := make([]Chapter, 0, len(edition.Atoms))
+	for _, atom := range edition.Atoms {
+		start, err := ParseTimestamp(atom.Start)
+		if err != nil {
+			return nil, err
+		}
+		chapter := Chapter{Start: start}
+		if atom.End != "" {
+			if chapter.End, err = ParseTimestamp(atom.End); err != nil {
+				return nil, err
+			}
+		}
+		if len(atom.Displays) > 0 {
+			chapter.Title = atom.Displays[0].String
+		}
+		chapters = append(chapters, chapter)
+	}
+	return chapters, nil
+}
+
+// Segment is a Jellyfin media segment - times are in 100ns ticks
+type Segment struct {
+	Type       string `json:"Type"`
+	StartTicks int64  `json:"StartTicks"`
+	EndTicks   int64  `json:"EndTicks"`
+}
+
+// segmentTitles names the chapters created from Jellyfin segment types
+var segmentTitles = map[string]string{
+	"intro":      "Intro",
+	"outro":      "Credits",
+	"recap":      "Recap",
+	"preview":    "Preview",
+	"commercial": "Commercial",
+}
+
+// ParseSegments reads Jellyfin media segments, either the /MediaSegments response or a bare array
+func ParseSegments(r io.Reader) ([]Segment, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading segments: %w", err)
+	}
+	var response struct {
+		Items []Segment `json:"Items"`
+	}
+	if err := json.Unmarshal(data, &response); err == nil && response.Items != nil {
+		return response.Items, nil
+	}
+	var segments []Segment
+	if err := json.Unmarshal(data, &segments); err != nil {
+		return nil, fmt.Errorf("error parsing segments: %w", err)
+	}
+	return segments, nil
+}
+
+// SegmentsToChapters turns segments into chapters, filling the gaps between them with
+// "Episode" chapters so the whole video stays navigable
+func SegmentsToChapters(segments []Segment, duration time.Duration) []Chapter {
+	sorted := append([]Segment(nil), segments...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTicks < sorted[j].StartTicks
+	})
+	var chapters []Chapter
+	var position time.Duration
+	for _, segment := range sorted {
+		start := ticks(segment.StartTicks)
+		end := ticks(segment.EndTicks)
+		if end <= start || start < position {
+			continue
+		}
+		if start-position > tolerance {
+			chapters = append(chapters, Chapter{Start: position, End: start, Title: "Episode"})
+		}
+		title, ok := segmentTitles[strings.ToLower(segment.Type)]
+		if !ok {
+			title = segment.Type
+		}
+		chapters = append(chapters, Chapter{Start: start, End: end, Title: title})
+		position = end
+	}
+	if len(chapters) > 0 && duration-position > tolerance {
+		chapters = append(chapters, Chapter{Start: position, End: duration, Title: "Episode"})
+	}
+	return chapters
+}
+
+func ticks(value int64) time.Duration {
+	return time.Duration(value * 100)
+}
+
+// FromNFO converts the <chapters> block of an episode NFO
+func FromNFO(nfoChapters []nfo.Chapter) ([]Chapter, error) {
+	chapters := make([]Chapter, 0, len(nfoChapters))
+	for _, nfoChapter := range nfoChapters {
+		start, err := ParseTimestamp(nfoChapter.Start)
+		if err != nil {
+			return nil, fmt.Errorf("error in NFO chapter %q: %w", nfoChapter.Title, err)
+		}
+		chapter := Chapter{Start: start, Title: nfoChapter.Title}
+		if nfoChapter.End != "" {
+			if chapter.End, err = ParseTimestamp(nfoChapter.End); err != nil {
+				return nil, fmt.Errorf("error in NFO chapter %q: %w", nfoChapter.Title, err)
+			}
+		}
+		chapters = append(chapters, chapter)
+	}
+	return chapters, nil
+}
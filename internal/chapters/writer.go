@@ -0,0 +1,85 @@
+package chapters
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	"os"
+	"strings"
+)
+
+// ffmetadataEscaper escapes the characters FFMETADATA treats as special
+var ffmetadataEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+
+// FFMetadata renders chapters as an FFMETADATA file with millisecond timestamps
+func FFMetadata(chapters []Chapter) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, chapter := range chapters {
+		b.WriteString("[CHAPTER]\nTIMEBASE=1/1000\n")
+		fmt.Fprintf(&b, "START=%d\n", chapter.Start.Milliseconds())
+		fmt.Fprintf(&b, "END=%d\n", chapter.End.Milliseconds())
+		if chapter.Title != "" {
+			fmt.Fprintf(&b, "title=%s\n", ffmetadataEscaper.Replace(chapter.Title))
+		}
+	}
+	return b.String()
+}
+
+// MatroskaXML renders chapters as a single-edition Matroska chapter file
+func MatroskaXML(chapters []Chapter) ([]byte, error) {
+	doc := matroskaChapters{Editions: []matroskaEdition{{Default: 1}}}
+	for _, chapter := range chapters {
+		atom := matroskaAtom{
+			Start: FormatTimestamp(chapter.Start),
+			End:   FormatTimestamp(chapter.End),
+		}
+		if chapter.Title != "" {
+			atom.Displays = []matroskaDisplay{{String: chapter.Title, Language: "und"}}
+		}
+		doc.Editions[0].Atoms = append(doc.Editions[0].Atoms, atom)
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error rendering Matroska chapters: %w", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// WriteFFMetadata writes the FFMETADATA file that is passed to ffmpeg as a second input
+func WriteFFMetadata(path string, chapters []Chapter) error {
+	if err := os.WriteFile(path, []byte(FFMetadata(chapters)), 0644); err != nil {
+		return fmt.Errorf("error writing chapter file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Mkvpropedit replaces the chapters of an MKV file in place, mkvpropedit is killed when ctx ends
+func Mkvpropedit(ctx context.Context, file string, chapters []Chapter) error {
+	data, err := MatroskaXML(chapters)
+	if err != nil {
+		return err
+	}
+	xmlFile, err := os.CreateTemp("", "govmu-chapters-*.xml")
+	if err != nil {
+		return fmt.Errorf("error creating chapter file: %w", err)
+	}
+	defer func() { _ = os.Remove(xmlFile.Name()) }()
+	if _, err := xmlFile.Write(data); err != nil {
+		_ = xmlFile.Close()
+		return fmt.Errorf("error writing chapter file: %w", err)
+	}
+	if err := xmlFile.Close(); err != nil {
+		return fmt.Errorf("error writing chapter file: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	command := utils.CommandContext(ctx, "mkvpropedit", file, "--chapters", xmlFile.Name())
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("mkvpropedit failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/bmj2728/go-vmu/internal/backup"
+	"github.com/bmj2728/go-vmu/internal/chapters"
+	"github.com/bmj2728/go-vmu/internal/convert"
+	"github.com/bmj2728/go-vmu/internal/discovery"
+	"github.com/bmj2728/go-vmu/internal/diskspace"
+	"github.com/bmj2728/go-vmu/internal/hooks"
+	"github.com/bmj2728/go-vmu/internal/iolimit"
+	"github.com/bmj2728/go-vmu/internal/mediaserver"
+	"github.com/bmj2728/go-vmu/internal/metadata"
+	"github.com/bmj2728/go-vmu/internal/pool"
+	"github.com/bmj2728/go-vmu/internal/report"
+	"github.com/bmj2728/go-vmu/internal/retry"
+	"github.com/bmj2728/go-vmu/internal/tracks"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+)
+
+// Config holds the optional settings that are loaded from a TOML file
+type Config struct {
+	// StateDir holds vmu's own bookkeeping such as the backup manifest
+	StateDir     string                     `toml:"state_dir"`
+	Discovery    discovery.Config           `toml:"discovery"`
+	Retry        retry.Policy               `toml:"retry"`
+	Timeouts     pool.Timeouts              `toml:"timeouts"`
+	DiskSpace    diskspace.Config           `toml:"disk_space"`
+	Concurrency  iolimit.Config             `toml:"concurrency"`
+	Backup       backup.Config              `toml:"backup"`
+	Tags         metadata.TagPolicy         `toml:"tags"`
+	Chapters     chapters.Config            `toml:"chapters"`
+	Tracks       tracks.Config              `toml:"tracks"`
+	Convert      convert.Config             `toml:"convert"`
+	MediaServers []mediaserver.ServerConfig `toml:"media_server"`
+	Hooks        []hooks.Config             `toml:"hook"`
+	Report       report.Config              `toml:"report"`
+}
+
+// NewConfig returns an empty config - every section is optional
+func NewConfig() *Config {
+	return &Config{
+		StateDir:    DefaultStateDir(),
+		Discovery:   discovery.NewConfig(),
+		Retry:       retry.NewPolicy(),
+		Timeouts:    pool.NewTimeouts(),
+		DiskSpace:   diskspace.NewConfig(),
+		Concurrency: iolimit.NewConfig(),
+		Tags:        metadata.NewTagPolicy(),
+		Report:      report.NewConfig(),
+	}
+}
+
+// DefaultStateDir follows the XDG base directory spec - $XDG_STATE_HOME/vmu or ~/.local/state/vmu
+func DefaultStateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "vmu")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "vmu")
+	}
+	return filepath.Join(home, ".local", "state", "vmu")
+}
+
+// JournalDir is where the per-run tag journals are kept
+func (c *Config) JournalDir() string {
+	return filepath.Join(c.StateDir, "journal")
+}
+
+// Load reads a TOML config file, an empty path returns the default config
+func Load(path string) (*Config, error) {
+	cfg := NewConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	meta, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config %s: %w", path, err)
+	}
+	for _, key := range meta.Undecoded() {
+		log.Warn().Msgf("Unknown config key %q in %s", key.String(), path)
+	}
+	if err := cfg.Discovery.Validate(); err != nil {
+		return nil, fmt.Errorf("error in config %s: %w", path, err)
+	}
+	if err := cfg.Retry.Validate(); err != nil {
+		return nil, fmt.Errorf("error in config %s: %w", path, err)
+	}
+	if err := cfg.Timeouts.Validate(); err != nil {
+		return nil, fmt.Errorf("error in config %s: %w", path, err)
+	}
+	if err := cfg.DiskSpace.Validate(); err != nil {
+		return nil, fmt.Errorf("error in config %s: %w", path, err)
+	}
+	if err := cfg.Concurrency.Validate(); err != nil {
+		return nil, fmt.Errorf("error in config %s: %w", path, err)
+	}
+	if err := cfg.Tags.Validate(); err != nil {
+		return nil, fmt.Errorf("error in config %s: %w", path, err)
+	}
+	if err := cfg.Chapters.Validate(); err != nil {
+		return nil, fmt.Errorf("error in config %s: %w", path, err)
+	}
+	if err := cfg.Convert.Validate(); err != nil {
+		return nil, fmt.Errorf("error in config %s: %w", path, err)
+	}
+	if err := cfg.Report.Validate(); err != nil {
+		return nil, fmt.Errorf("error in config %s: %w", path, err)
+	}
+	for _, hook := range cfg.Hooks {
+		if err := hook.Validate(); err != nil {
+			return nil, fmt.Errorf("error in config %s: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
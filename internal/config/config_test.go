@@ -0,0 +1,327 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmj2728/go-vmu/internal/iolimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_EmptyPath(t *testing.T) {
+	cfg, err := Load("")
+
+	assert.NoError(t, err)
+	assert.NotNil(t, cfg)
+	assert.Empty(t, cfg.MediaServers)
+}
+
+func TestLoad_MediaServers(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.toml")
+	err := os.WriteFile(path, []byte(`
+[[media_server]]
+name = "living room"
+type = "jellyfin"
+url = "http://jellyfin:8096"
+token = "abc"
+granularity = "folder"
+retries = 2
+
+[[media_server]]
+type = "plex"
+url = "http://plex:32400"
+section = "4"
+`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := Load(path)
+
+	assert.NoError(t, err)
+	assert.Len(t, cfg.MediaServers, 2)
+	assert.Equal(t, "living room", cfg.MediaServers[0].Name)
+	assert.Equal(t, "folder", cfg.MediaServers[0].Granularity)
+	assert.Equal(t, 2, cfg.MediaServers[0].Retries)
+	assert.Equal(t, "plex", cfg.MediaServers[1].Type)
+	assert.Equal(t, "4", cfg.MediaServers[1].Section)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.toml")
+	err := os.WriteFile(path, []byte("[[media_server]\n"), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := Load(path)
+
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	cfg, err := Load("/non/existent/vmu.toml")
+
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+}
+
+func TestLoad_Tags(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.toml")
+	err := os.WriteFile(path, []byte(`
+[tags]
+mode = "replace"
+keep = ["handler_*"]
+`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := Load(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "replace", cfg.Tags.Mode)
+	assert.Equal(t, []string{"handler_*"}, cfg.Tags.Keep)
+
+	err = os.WriteFile(path, []byte(`
+[tags]
+mode = "overwrite"
+`), 0644)
+	assert.NoError(t, err)
+
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestLoad_Convert(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.toml")
+	err := os.WriteFile(path, []byte(`
+[convert]
+to = "mkv"
+from = [".avi", ".wmv"]
+`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := Load(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "mkv", cfg.Convert.To)
+	assert.Equal(t, []string{".avi", ".wmv"}, cfg.Convert.From)
+
+	err = os.WriteFile(path, []byte(`
+[convert]
+to = "webm"
+`), 0644)
+	assert.NoError(t, err)
+
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestLoad_Discovery(t *testing.T) {
+	cfg, err := Load("")
+	assert.NoError(t, err)
+	assert.True(t, cfg.Discovery.FollowSymlinks)
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.toml")
+	err = os.WriteFile(path, []byte(`
+[discovery]
+extensions = [".mkv", ".ts"]
+sniff = true
+follow_symlinks = false
+`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err = Load(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".mkv", ".ts"}, cfg.Discovery.Extensions)
+	assert.True(t, cfg.Discovery.Sniff)
+	assert.False(t, cfg.Discovery.FollowSymlinks)
+}
+
+func TestLoad_Retry(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.toml")
+	err := os.WriteFile(path, []byte(`
+[retry]
+base_delay = "500ms"
+max_delay = "30s"
+
+[retry.rules]
+FFmpegError = "transient"
+`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := Load(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, cfg.Retry.BaseDelay)
+	assert.Equal(t, 30*time.Second, cfg.Retry.MaxDelay)
+	// unset keys keep their defaults
+	assert.Equal(t, 0.2, cfg.Retry.Jitter)
+	assert.Equal(t, map[string]string{"FFmpegError": "transient"}, cfg.Retry.Rules)
+
+	err = os.WriteFile(path, []byte(`
+[retry.rules]
+NFONotFound = "maybe"
+`), 0644)
+	assert.NoError(t, err)
+
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestLoad_Timeouts(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.toml")
+	err := os.WriteFile(path, []byte(`
+[timeouts]
+file = "45m"
+ffmpeg = "30m"
+`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := Load(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 45*time.Minute, cfg.Timeouts.File)
+	assert.Equal(t, 30*time.Minute, cfg.Timeouts.FFmpeg)
+	// unset keys keep their defaults
+	assert.Equal(t, 30*time.Second, cfg.Timeouts.Probe)
+	assert.Equal(t, 5*time.Minute, cfg.Timeouts.Validation)
+
+	err = os.WriteFile(path, []byte(`
+[timeouts]
+probe = "-1s"
+`), 0644)
+	assert.NoError(t, err)
+
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestLoad_DiskSpace(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.toml")
+	err := os.WriteFile(path, []byte(`
+[disk_space]
+min_free_mb = 4096
+`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := Load(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4096), cfg.DiskSpace.MinFreeMB)
+	// unset keys keep their defaults
+	assert.True(t, cfg.DiskSpace.Check)
+	assert.Equal(t, 10*time.Second, cfg.DiskSpace.PollInterval)
+}
+
+func TestLoad_Concurrency(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.toml")
+	err := os.WriteFile(path, []byte(`
+[concurrency]
+default = 8
+
+[[concurrency.mount]]
+path = "/mnt/nfs"
+limit = 2
+`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := Load(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 8, cfg.Concurrency.Default)
+	assert.Equal(t, []iolimit.Mount{{Path: "/mnt/nfs", Limit: 2}}, cfg.Concurrency.Mounts)
+	// unset keys keep their defaults
+	assert.False(t, cfg.Concurrency.Adaptive)
+	assert.Equal(t, 16, cfg.Concurrency.MaxLimit)
+
+	err = os.WriteFile(path, []byte(`
+[[concurrency.mount]]
+path = "/mnt/nfs"
+`), 0644)
+	assert.NoError(t, err)
+
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestLoad_Hooks(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.toml")
+	err := os.WriteFile(path, []byte(`
+[[hook]]
+event = "file_finished"
+statuses = ["Success"]
+command = ["/usr/local/bin/after.sh", "--quiet"]
+
+[[hook]]
+name = "ntfy"
+event = "run_finished"
+url = "https://ntfy.example/vmu"
+body = '{{.Message}}'
+timeout = "10s"
+headers = { Title = "vmu" }
+`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := Load(path)
+
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Hooks, 2)
+	assert.Equal(t, []string{"/usr/local/bin/after.sh", "--quiet"}, cfg.Hooks[0].Command)
+	assert.Equal(t, []string{"Success"}, cfg.Hooks[0].Statuses)
+	assert.Equal(t, "ntfy", cfg.Hooks[1].Name)
+	assert.Equal(t, 10*time.Second, cfg.Hooks[1].Timeout)
+	assert.Equal(t, "vmu", cfg.Hooks[1].Headers["Title"])
+
+	err = os.WriteFile(path, []byte(`
+[[hook]]
+event = "file_finished"
+statuses = ["Exploded"]
+command = ["true"]
+`), 0644)
+	assert.NoError(t, err)
+
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestLoad_Report(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.toml")
+	err := os.WriteFile(path, []byte(`
+[report]
+formats = ["json", "junit"]
+naming = "timestamp"
+`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := Load(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"json", "junit"}, cfg.Report.Formats)
+	assert.Equal(t, "timestamp", cfg.Report.Naming)
+
+	// without the section results.json and failures.json are written as before
+	cfg, err = Load("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"json"}, cfg.Report.Formats)
+	assert.Equal(t, "fixed", cfg.Report.Naming)
+
+	err = os.WriteFile(path, []byte(`
+[report]
+formats = ["pdf"]
+`), 0644)
+	assert.NoError(t, err)
+
+	_, err = Load(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/vansante/go-ffprobe.v2"
+	"strings"
+)
+
+// mp4Codecs are the codecs the mp4 muxer accepts with -c copy, keyed by codec_type
+var mp4Codecs = map[string][]string{
+	"video":    {"h264", "hevc", "av1", "vp9", "mpeg4", "mpeg2video", "mpeg1video", "mjpeg", "png"},
+	"audio":    {"aac", "mp3", "mp2", "ac3", "eac3", "alac", "flac", "opus"},
+	"subtitle": {"mov_text"},
+}
+
+// mkvBlocked are the codecs Matroska cannot take with -c copy, everything else has a codec id
+// or falls back to the VfW/ACM compatibility ids
+var mkvBlocked = map[string][]string{
+	"subtitle": {"mov_text", "eia_608"},
+}
+
+// ErrCannotConvert is wrapped by the errors of files that cannot be remuxed into the target container
+var ErrCannotConvert = errors.New("cannot convert")
+
+// Check reports the streams that could only be converted to the target container by re-encoding
+func Check(streams []*ffprobe.Stream, to string) error {
+	var incompatible []string
+	for _, stream := range streams {
+		if !compatible(stream, to) {
+			incompatible = append(incompatible, fmt.Sprintf("#%d %s (%s)", stream.Index, stream.CodecType, codecName(stream)))
+		}
+	}
+	if len(incompatible) > 0 {
+		return fmt.Errorf("%w to %s without re-encoding: %s", ErrCannotConvert, to, strings.Join(incompatible, ", "))
+	}
+	return nil
+}
+
+// compatible reports whether a stream can be copied into the target container as is
+func compatible(stream *ffprobe.Stream, to string) bool {
+	//data streams such as timecodes have no place in either container
+	if stream.CodecType == "data" || codecName(stream) == "none" {
+		return false
+	}
+	if to == FormatMP4 {
+		return contains(mp4Codecs[stream.CodecType], stream.CodecName)
+	}
+	return !contains(mkvBlocked[stream.CodecType], stream.CodecName)
+}
+
+func codecName(stream *ffprobe.Stream) string {
+	if stream.CodecName == "" {
+		return "none"
+	}
+	return stream.CodecName
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package convert
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Target containers
+const (
+	FormatMKV = "mkv"
+	FormatMP4 = "mp4"
+)
+
+// DefaultFrom are the legacy containers that cannot hold our tags
+var DefaultFrom = []string{".avi", ".mpg", ".mpeg", ".wmv", ".flv"}
+
+// Config controls remuxing legacy containers into MKV or MP4 while tagging
+type Config struct {
+	// To is the target container, empty disables conversion
+	To string `toml:"to"`
+	// From lists the extensions that are converted, empty uses DefaultFrom
+	From []string `toml:"from"`
+}
+
+// Enabled reports whether conversion is switched on
+func (c Config) Enabled() bool {
+	return c.To != ""
+}
+
+// Validate checks the target container
+func (c Config) Validate() error {
+	switch c.To {
+	case "", FormatMKV, FormatMP4:
+		return nil
+	default:
+		return fmt.Errorf("unknown conversion target %q - use %q or %q", c.To, FormatMKV, FormatMP4)
+	}
+}
+
+// Target returns the path path is converted to, false when it stays in its container
+func (c Config) Target(path string) (string, bool) {
+	if !c.Enabled() {
+		return path, false
+	}
+	from := c.From
+	if len(from) == 0 {
+		from = DefaultFrom
+	}
+	ext := filepath.Ext(path)
+	for _, candidate := range from {
+		if !strings.HasPrefix(candidate, ".") {
+			candidate = "." + candidate
+		}
+		if strings.EqualFold(ext, candidate) && !strings.EqualFold(ext, "."+c.To) {
+			return strings.TrimSuffix(path, ext) + "." + c.To, true
+		}
+	}
+	return path, false
+}
@@ -0,0 +1,72 @@
+package convert
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, Config{}.Validate())
+	assert.NoError(t, Config{To: FormatMKV}.Validate())
+	assert.NoError(t, Config{To: FormatMP4}.Validate())
+	assert.Error(t, Config{To: "avi"}.Validate())
+}
+
+func TestConfig_Target(t *testing.T) {
+	target, ok := Config{}.Target("/tv/Episode.avi")
+	assert.False(t, ok)
+	assert.Equal(t, "/tv/Episode.avi", target)
+
+	cfg := Config{To: FormatMKV}
+	target, ok = cfg.Target("/tv/Episode.AVI")
+	assert.True(t, ok)
+	assert.Equal(t, "/tv/Episode.mkv", target)
+
+	_, ok = cfg.Target("/tv/Episode.mp4")
+	assert.False(t, ok)
+	_, ok = cfg.Target("/tv/Episode.mkv")
+	assert.False(t, ok)
+
+	// custom lists accept extensions with or without the dot, the target itself is never converted
+	cfg = Config{To: FormatMP4, From: []string{"mov", ".mp4"}}
+	target, ok = cfg.Target("/tv/Episode.mov")
+	assert.True(t, ok)
+	assert.Equal(t, "/tv/Episode.mp4", target)
+	_, ok = cfg.Target("/tv/Episode.mp4")
+	assert.False(t, ok)
+	_, ok = cfg.Target("/tv/Episode.avi")
+	assert.False(t, ok)
+}
+
+func TestCheck(t *testing.T) {
+	xvid := []*ffprobe.Stream{
+		{Index: 0, CodecType: "video", CodecName: "mpeg4"},
+		{Index: 1, CodecType: "audio", CodecName: "mp3"},
+	}
+	assert.NoError(t, Check(xvid, FormatMKV))
+	assert.NoError(t, Check(xvid, FormatMP4))
+
+	wmv := []*ffprobe.Stream{
+		{Index: 0, CodecType: "video", CodecName: "wmv3"},
+		{Index: 1, CodecType: "audio", CodecName: "wmav2"},
+	}
+	assert.NoError(t, Check(wmv, FormatMKV))
+	err := Check(wmv, FormatMP4)
+	assert.ErrorIs(t, err, ErrCannotConvert)
+	assert.Contains(t, err.Error(), "#0 video (wmv3)")
+	assert.Contains(t, err.Error(), "#1 audio (wmav2)")
+
+	withData := []*ffprobe.Stream{
+		{Index: 0, CodecType: "video", CodecName: "h264"},
+		{Index: 1, CodecType: "data"},
+	}
+	err = Check(withData, FormatMKV)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "#1 data (none)")
+
+	assert.Error(t, Check([]*ffprobe.Stream{{Index: 0, CodecType: "subtitle", CodecName: "mov_text"}}, FormatMKV))
+	assert.NoError(t, Check([]*ffprobe.Stream{{Index: 0, CodecType: "subtitle", CodecName: "mov_text"}}, FormatMP4))
+	assert.Error(t, Check([]*ffprobe.Stream{{Index: 0, CodecType: "subtitle", CodecName: "subrip"}}, FormatMP4))
+}
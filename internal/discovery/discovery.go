@@ -0,0 +1,232 @@
+package discovery
+
+import (
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultExtensions are the video files picked up when no extension list is configured
+var DefaultExtensions = []string{
+	".avi", ".mp4", ".mkv", ".mpg", ".mpeg", ".mov", ".wmv", ".flv", ".m4v",
+	".ts", ".m2ts", ".webm", ".ogm",
+}
+
+// tempMarkers are the tags vmu inserts into the names of its own backup and work files
+var tempMarkers = []string{".backup.", ".govmu-edit."}
+
+// Config controls which files a run picks up
+type Config struct {
+	// Extensions are matched case-insensitively, empty uses DefaultExtensions
+	Extensions []string `toml:"extensions"`
+	// Sniff reads the first bytes of each candidate and skips files that are not a known container
+	Sniff bool `toml:"sniff"`
+	// FollowSymlinks descends into symlinked directories, loops are detected and skipped
+	FollowSymlinks bool `toml:"follow_symlinks"`
+	// Include limits the run to files matching one of these globs or regexes, relative to the root
+	Include      []string `toml:"include"`
+	IncludeRegex []string `toml:"include_regex"`
+	// Exclude skips files and whole directories matching one of these globs or regexes
+	Exclude      []string `toml:"exclude"`
+	ExcludeRegex []string `toml:"exclude_regex"`
+	// ModifiedSince skips files that were last modified before this time, zero disables
+	ModifiedSince time.Time `toml:"modified_since"`
+}
+
+// NewConfig returns the default discovery settings
+func NewConfig() Config {
+	return Config{FollowSymlinks: true}
+}
+
+// Validate compiles the include and exclude rules
+func (c Config) Validate() error {
+	_, err := compileFilters(c)
+	return err
+}
+
+// Discoverer walks a directory tree for video files
+type Discoverer struct {
+	Config Config
+	// Excluded lists the files and directories the last Find left out because of a filter
+	Excluded   []Exclusion
+	extensions map[string]bool
+	filters    filters
+}
+
+// NewDiscoverer creates a discoverer for the given settings
+func NewDiscoverer(cfg Config) (*Discoverer, error) {
+	compiled, err := compileFilters(cfg)
+	if err != nil {
+		return nil, err
+	}
+	extensions := cfg.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+	d := &Discoverer{Config: cfg, extensions: make(map[string]bool, len(extensions)), filters: compiled}
+	for _, ext := range extensions {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		d.extensions[strings.ToLower(ext)] = true
+	}
+	return d, nil
+}
+
+// Find returns the video files under root in lexical order
+func (d *Discoverer) Find(root string) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	var files []string
+	d.Excluded = nil
+	visited := make(map[string]bool)
+	if err := d.walk(root, root, nil, visited, &files); err != nil {
+		return nil, err
+	}
+	log.Debug().Msgf("Found %d files", len(files))
+	return files, nil
+}
+
+// walk collects the files of dir, ignores are the .vmuignore files of its parents and
+// visited holds the resolved directories already walked
+func (d *Discoverer) walk(root string, dir string, ignores []*ignoreFile, visited map[string]bool, files *[]string) error {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %w", dir, err)
+	}
+	if visited[real] {
+		log.Warn().Msgf("Skipping %s, %s was already walked (symlink loop or duplicate link)", dir, real)
+		return nil
+	}
+	visited[real] = true
+
+	ignore, err := loadIgnoreFile(dir)
+	if err != nil {
+		return err
+	}
+	if ignore != nil {
+		ignores = append(ignores[:len(ignores):len(ignores)], ignore)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		log.Debug().Msgf("Checking %s", path)
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			target, err := os.Stat(path)
+			if err != nil {
+				log.Warn().Err(err).Msgf("Skipping broken symlink %s", path)
+				continue
+			}
+			if target.IsDir() && !d.Config.FollowSymlinks {
+				log.Debug().Msgf("Not following symlinked directory %s", path)
+				continue
+			}
+			isDir = target.IsDir()
+		}
+		if isDir {
+			if rule, excluded := d.excludes(root, path, true, ignores); excluded {
+				d.exclude(path, rule)
+				continue
+			}
+			if err := d.walk(root, path, ignores, visited, files); err != nil {
+				return err
+			}
+			continue
+		}
+		if !d.candidate(path) {
+			continue
+		}
+		if rule, excluded := d.excludes(root, path, false, ignores); excluded {
+			d.exclude(path, rule)
+			continue
+		}
+		if !d.Matches(path) {
+			continue
+		}
+		*files = append(*files, path)
+		log.Debug().Msgf("Found file: %s", path)
+	}
+	return nil
+}
+
+// candidate reports whether path has a video extension and is not one of vmu's work files
+func (d *Discoverer) candidate(path string) bool {
+	name := filepath.Base(path)
+	if !d.extensions[strings.ToLower(filepath.Ext(name))] {
+		return false
+	}
+	for _, marker := range tempMarkers {
+		if strings.Contains(name, marker) {
+			log.Debug().Msgf("Skipping work file %s", path)
+			return false
+		}
+	}
+	return true
+}
+
+// excludes returns the rule that filters path out of the run
+func (d *Discoverer) excludes(root string, path string, isDir bool, ignores []*ignoreFile) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	rel = filepath.ToSlash(rel)
+	if rule, excluded := d.filters.excludes(rel, isDir); excluded {
+		return rule, true
+	}
+	if rule, excluded := ignored(ignores, path, isDir); excluded {
+		return rule, true
+	}
+	if isDir {
+		return "", false
+	}
+	if !d.filters.includes(rel) {
+		return "not matched by --include", true
+	}
+	if !d.Config.ModifiedSince.IsZero() {
+		info, err := os.Stat(path)
+		if err == nil && info.ModTime().Before(d.Config.ModifiedSince) {
+			return "--modified-since " + d.Config.ModifiedSince.Format(time.RFC3339), true
+		}
+	}
+	return "", false
+}
+
+// exclude records a filtered path for the run report
+func (d *Discoverer) exclude(path string, rule string) {
+	log.Debug().Msgf("Excluding %s (%s)", path, rule)
+	d.Excluded = append(d.Excluded, Exclusion{Path: path, Rule: rule})
+}
+
+// Matches reports whether path is a video file the run should process, the filters aside
+func (d *Discoverer) Matches(path string) bool {
+	if !d.candidate(path) {
+		return false
+	}
+	if d.Config.Sniff {
+		container, err := Sniff(path)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Skipping %s, could not read its header", path)
+			return false
+		}
+		if container == "" {
+			log.Warn().Msgf("Skipping %s, its content is not a known video container", path)
+			return false
+		}
+		log.Debug().Msgf("%s sniffed as %s", path, container)
+	}
+	return true
+}
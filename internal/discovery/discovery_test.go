@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDiscoverer(t *testing.T, cfg Config) *Discoverer {
+	d, err := NewDiscoverer(cfg)
+	assert.NoError(t, err)
+	return d
+}
+
+func TestDiscoverer_Find(t *testing.T) {
+	tmpDir := t.TempDir()
+	season := filepath.Join(tmpDir, "Season 01")
+	assert.NoError(t, os.Mkdir(season, 0755))
+	for _, name := range []string{
+		"a.mkv", "b.MKV", "c.Mp4", "d.ts", "e.m2ts", "f.webm", "g.ogm", "notes.txt",
+		"a.backup.mkv", "a.govmu-edit.mkv",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(season, name), []byte("x"), 0644))
+	}
+
+	files, err := newTestDiscoverer(t, NewConfig()).Find(tmpDir)
+
+	assert.NoError(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.Base(file))
+	}
+	assert.Equal(t, []string{"a.mkv", "b.MKV", "c.Mp4", "d.ts", "e.m2ts", "f.webm", "g.ogm"}, names)
+
+	// a custom list replaces the defaults
+	files, err = newTestDiscoverer(t, Config{Extensions: []string{"mkv"}}).Find(tmpDir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	_, err = newTestDiscoverer(t, NewConfig()).Find(filepath.Join(tmpDir, "missing"))
+	assert.Error(t, err)
+	_, err = newTestDiscoverer(t, NewConfig()).Find(filepath.Join(season, "a.mkv"))
+	assert.Error(t, err)
+}
+
+func TestDiscoverer_FindSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	library := filepath.Join(tmpDir, "library")
+	shows := filepath.Join(tmpDir, "shows")
+	assert.NoError(t, os.MkdirAll(library, 0755))
+	assert.NoError(t, os.MkdirAll(shows, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(shows, "ep1.mkv"), []byte("x"), 0644))
+	assert.NoError(t, os.Symlink(shows, filepath.Join(library, "Show")))
+	// a link back up the tree must not loop forever
+	assert.NoError(t, os.Symlink(library, filepath.Join(shows, "loop")))
+	assert.NoError(t, os.Symlink(filepath.Join(tmpDir, "gone"), filepath.Join(library, "broken")))
+
+	files, err := newTestDiscoverer(t, NewConfig()).Find(library)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(library, "Show", "ep1.mkv")}, files)
+
+	files, err = newTestDiscoverer(t, Config{}).Find(library)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestDiscoverer_Sniff(t *testing.T) {
+	tmpDir := t.TempDir()
+	real := filepath.Join(tmpDir, "real.mkv")
+	fake := filepath.Join(tmpDir, "fake.mkv")
+	assert.NoError(t, os.WriteFile(real, append([]byte{0x1A, 0x45, 0xDF, 0xA3}, make([]byte, 32)...), 0644))
+	assert.NoError(t, os.WriteFile(fake, []byte("<html>not found</html>"), 0644))
+
+	files, err := newTestDiscoverer(t, Config{Sniff: true}).Find(tmpDir)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{real}, files)
+}
+
+func TestSniffBytes(t *testing.T) {
+	ts := make([]byte, 2*tsPacket)
+	ts[0], ts[tsPacket] = 0x47, 0x47
+	m2ts := make([]byte, 2*(tsPacket+4))
+	m2ts[4], m2ts[tsPacket+8] = 0x47, 0x47
+
+	assert.Equal(t, "matroska", SniffBytes([]byte{0x1A, 0x45, 0xDF, 0xA3, 0x01}))
+	assert.Equal(t, "avi", SniffBytes([]byte("RIFF\x00\x00\x00\x00AVI LIST")))
+	assert.Equal(t, "mp4", SniffBytes([]byte("\x00\x00\x00\x20ftypisom")))
+	assert.Equal(t, "asf", SniffBytes([]byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6}))
+	assert.Equal(t, "flv", SniffBytes([]byte("FLV\x01")))
+	assert.Equal(t, "ogg", SniffBytes([]byte("OggS\x00")))
+	assert.Equal(t, "mpeg", SniffBytes([]byte{0x00, 0x00, 0x01, 0xBA, 0x44}))
+	assert.Equal(t, "mpegts", SniffBytes(ts))
+	assert.Equal(t, "m2ts", SniffBytes(m2ts))
+	assert.Empty(t, SniffBytes([]byte("RIFF\x00\x00\x00\x00WAVE")))
+	assert.Empty(t, SniffBytes(nil))
+
+	// headers cut off around the second m2ts sync byte
+	for _, tc := range []struct {
+		size      int
+		container string
+	}{
+		{size: 0},
+		{size: tsPacket + 1},
+		{size: tsPacket + 5},
+		{size: tsPacket + 8},
+		{size: tsPacket + 9, container: "m2ts"},
+	} {
+		header := make([]byte, tc.size)
+		if tc.size > 4 {
+			header[4] = 0x47
+		}
+		if tc.size > tsPacket+8 {
+			header[tsPacket+8] = 0x47
+		}
+		assert.Equal(t, tc.container, SniffBytes(header), "%d bytes", tc.size)
+	}
+}
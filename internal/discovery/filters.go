@@ -0,0 +1,286 @@
+package discovery
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IgnoreFile is the gitignore-style file whose rules apply to its directory and everything below
+const IgnoreFile = ".vmuignore"
+
+// Exclusion is a path the walk left out and the rule responsible
+type Exclusion struct {
+	Path string `json:"path"`
+	Rule string `json:"rule"`
+}
+
+// pattern is a compiled gitignore-style glob
+type pattern struct {
+	source string
+	re     *regexp.Regexp
+	// anchored patterns contain a slash and match the path relative to their base,
+	// the rest match a single name at any depth
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+// compilePattern translates a gitignore-style glob - *, ?, [...], ** and a trailing / for directories
+func compilePattern(source string) (pattern, error) {
+	p := pattern{source: source}
+	glob := source
+	if strings.HasPrefix(glob, "!") {
+		p.negate = true
+		glob = glob[1:]
+	}
+	if strings.HasSuffix(glob, "/") {
+		p.dirOnly = true
+		glob = strings.TrimRight(glob, "/")
+	}
+	if strings.Contains(glob, "/") {
+		p.anchored = true
+		glob = strings.TrimPrefix(glob, "/")
+	}
+	if glob == "" {
+		return p, fmt.Errorf("empty pattern %q", source)
+	}
+
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				return p, fmt.Errorf("unterminated [ in pattern %q", source)
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return p, fmt.Errorf("invalid pattern %q: %w", source, err)
+	}
+	p.re = compiled
+	return p, nil
+}
+
+// match reports whether rel, a slash separated path relative to the pattern's base, matches
+func (p pattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.anchored {
+		return p.re.MatchString(rel)
+	}
+	return p.re.MatchString(path.Base(rel))
+}
+
+// matchTree reports whether a file or any of its parent directories matches
+func (p pattern) matchTree(rel string) bool {
+	isDir := false
+	for rel != "." && rel != "/" && rel != "" {
+		if p.match(rel, isDir) {
+			return true
+		}
+		rel, isDir = path.Dir(rel), true
+	}
+	return false
+}
+
+// filters are the compiled include and exclude rules of a Config
+type filters struct {
+	include      []pattern
+	exclude      []pattern
+	includeRegex []*regexp.Regexp
+	excludeRegex []*regexp.Regexp
+}
+
+func compileFilters(cfg Config) (filters, error) {
+	var f filters
+	for _, source := range cfg.Include {
+		p, err := compileFlagPattern(source)
+		if err != nil {
+			return f, fmt.Errorf("include: %w", err)
+		}
+		f.include = append(f.include, p)
+	}
+	for _, source := range cfg.Exclude {
+		p, err := compileFlagPattern(source)
+		if err != nil {
+			return f, fmt.Errorf("exclude: %w", err)
+		}
+		f.exclude = append(f.exclude, p)
+	}
+	for _, source := range cfg.IncludeRegex {
+		re, err := regexp.Compile(source)
+		if err != nil {
+			return f, fmt.Errorf("include regex: %w", err)
+		}
+		f.includeRegex = append(f.includeRegex, re)
+	}
+	for _, source := range cfg.ExcludeRegex {
+		re, err := regexp.Compile(source)
+		if err != nil {
+			return f, fmt.Errorf("exclude regex: %w", err)
+		}
+		f.excludeRegex = append(f.excludeRegex, re)
+	}
+	return f, nil
+}
+
+// compileFlagPattern compiles an include or exclude glob. A leading ! only means something in the
+// last-match-wins order of a .vmuignore, so it is rejected here rather than silently ignored.
+func compileFlagPattern(source string) (pattern, error) {
+	p, err := compilePattern(source)
+	if err == nil && p.negate {
+		return p, fmt.Errorf("negated pattern %q is only supported in %s", source, IgnoreFile)
+	}
+	return p, err
+}
+
+// excludes returns the exclude rule matching rel, a path relative to the walk root
+func (f filters) excludes(rel string, isDir bool) (string, bool) {
+	for _, p := range f.exclude {
+		if p.match(rel, isDir) {
+			return "--exclude " + p.source, true
+		}
+	}
+	for _, re := range f.excludeRegex {
+		if re.MatchString(rel) {
+			return "--exclude-regex " + re.String(), true
+		}
+	}
+	return "", false
+}
+
+// includes reports whether a file passes the include rules - without any rule every file does
+func (f filters) includes(rel string) bool {
+	if len(f.include) == 0 && len(f.includeRegex) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if p.matchTree(rel) {
+			return true
+		}
+	}
+	for _, re := range f.includeRegex {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreRule is a line of a .vmuignore file
+type ignoreRule struct {
+	pattern
+	line int
+}
+
+// ignoreFile holds the rules of one .vmuignore, relative to the directory it lives in
+type ignoreFile struct {
+	dir   string
+	path  string
+	rules []ignoreRule
+}
+
+// loadIgnoreFile reads the .vmuignore in dir, nil when there is none. Bad lines are skipped.
+func loadIgnoreFile(dir string) (*ignoreFile, error) {
+	file, err := os.Open(filepath.Join(dir, IgnoreFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", filepath.Join(dir, IgnoreFile), err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	ignore := &ignoreFile{dir: dir, path: file.Name()}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		p, err := compilePattern(text)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Skipping line %d of %s", line, ignore.path)
+			continue
+		}
+		ignore.rules = append(ignore.rules, ignoreRule{pattern: p, line: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", ignore.path, err)
+	}
+	return ignore, nil
+}
+
+// ignored applies the .vmuignore files from the top of the tree down - the last matching rule wins,
+// so a deeper file or a later ! line can bring a path back
+func ignored(files []*ignoreFile, fullPath string, isDir bool) (string, bool) {
+	rule, excluded := "", false
+	for _, file := range files {
+		rel, err := filepath.Rel(file.dir, fullPath)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, r := range file.rules {
+			if r.match(rel, isDir) {
+				excluded = !r.negate
+				rule = file.path + ":" + strconv.Itoa(r.line) + ": " + r.source
+			}
+		}
+	}
+	return rule, excluded
+}
+
+// ParseSince reads a --modified-since value - a date, an RFC 3339 timestamp or an age such as 36h or 7d
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q - use 2006-01-02, an RFC 3339 timestamp or an age like 36h or 7d", value)
+}
@@ -0,0 +1,159 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilePattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		match   bool
+	}{
+		{"Extras", "Show/Season 1/Extras", true, true},
+		{"Extras", "Show/Extras.mkv", false, false},
+		{"@eaDir/", "Show/@eaDir", true, true},
+		{"@eaDir/", "Show/@eaDir", false, false},
+		{"*.sample.mkv", "Show/ep1.sample.mkv", false, true},
+		{"Show/Season ?", "Show/Season 2", true, true},
+		{"/Season 1", "Show/Season 1", true, false},
+		{"/Season 1", "Season 1", true, true},
+		{"**/Featurettes", "A/B/Featurettes", true, true},
+		{"**/Featurettes", "Featurettes", true, true},
+		{"Show/**", "Show/Season 1/ep1.mkv", false, true},
+		{"ep[0-9].mkv", "ep7.mkv", false, true},
+		{"ep[!0-9].mkv", "ep7.mkv", false, false},
+	}
+	for _, c := range cases {
+		p, err := compilePattern(c.pattern)
+		assert.NoError(t, err, c.pattern)
+		assert.Equal(t, c.match, p.match(c.rel, c.isDir), "%s against %s", c.pattern, c.rel)
+	}
+
+	_, err := compilePattern("ep[0-9")
+	assert.Error(t, err)
+	_, err = compilePattern("/")
+	assert.Error(t, err)
+}
+
+func TestDiscoverer_Filters(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{
+		"Show A/Season 01/ep1.mkv",
+		"Show A/Season 01/Extras/behind.mkv",
+		"Show A/Season 02/ep1.mkv",
+		"Show B/Season 01/ep1.mkv",
+		"Show B/@eaDir/ep1.mkv",
+	} {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("x"), 0644))
+	}
+
+	d := newTestDiscoverer(t, Config{
+		Include:      []string{"Show A"},
+		Exclude:      []string{"Extras"},
+		ExcludeRegex: []string{`Season 02`},
+	})
+	files, err := d.Find(tmpDir)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(tmpDir, "Show A", "Season 01", "ep1.mkv")}, files)
+	assert.Equal(t, []Exclusion{
+		{Path: filepath.Join(tmpDir, "Show A", "Season 01", "Extras"), Rule: "--exclude Extras"},
+		{Path: filepath.Join(tmpDir, "Show A", "Season 02"), Rule: "--exclude-regex Season 02"},
+		{Path: filepath.Join(tmpDir, "Show B", "@eaDir", "ep1.mkv"), Rule: "not matched by --include"},
+		{Path: filepath.Join(tmpDir, "Show B", "Season 01", "ep1.mkv"), Rule: "not matched by --include"},
+	}, d.Excluded)
+
+	_, err = NewDiscoverer(Config{ExcludeRegex: []string{"("}})
+	assert.Error(t, err)
+	assert.Error(t, Config{Include: []string{"[a"}}.Validate())
+	assert.Error(t, Config{Include: []string{"!Show A"}}.Validate())
+	assert.Error(t, Config{Exclude: []string{"!Extras"}}.Validate())
+}
+
+func TestDiscoverer_IgnoreFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{
+		"Show/Season 01/ep1.mkv",
+		"Show/Season 01/ep2.mkv",
+		"Show/Specials/sp1.mkv",
+		"Show/Specials/sp2.mkv",
+		"Other/@eaDir/ep1.mkv",
+	} {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("x"), 0644))
+	}
+	rootIgnore := filepath.Join(tmpDir, IgnoreFile)
+	showIgnore := filepath.Join(tmpDir, "Show", IgnoreFile)
+	assert.NoError(t, os.WriteFile(rootIgnore, []byte("# synology thumbnails\n@eaDir/\nsp*.mkv\n"), 0644))
+	// a deeper file can bring a path back and anchors its patterns to its own directory
+	assert.NoError(t, os.WriteFile(showIgnore, []byte("!sp2.mkv\n/Season 01/ep2.mkv\n"), 0644))
+
+	d := newTestDiscoverer(t, NewConfig())
+	files, err := d.Find(tmpDir)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(tmpDir, "Show", "Season 01", "ep1.mkv"),
+		filepath.Join(tmpDir, "Show", "Specials", "sp2.mkv"),
+	}, files)
+	assert.Equal(t, []Exclusion{
+		{Path: filepath.Join(tmpDir, "Other", "@eaDir"), Rule: rootIgnore + ":2: @eaDir/"},
+		{Path: filepath.Join(tmpDir, "Show", "Season 01", "ep2.mkv"), Rule: showIgnore + ":2: /Season 01/ep2.mkv"},
+		{Path: filepath.Join(tmpDir, "Show", "Specials", "sp1.mkv"), Rule: rootIgnore + ":3: sp*.mkv"},
+	}, d.Excluded)
+}
+
+func TestDiscoverer_ModifiedSince(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldFile := filepath.Join(tmpDir, "old.mkv")
+	newFile := filepath.Join(tmpDir, "new.mkv")
+	assert.NoError(t, os.WriteFile(oldFile, []byte("x"), 0644))
+	assert.NoError(t, os.WriteFile(newFile, []byte("x"), 0644))
+	since := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(oldFile, since.Add(-time.Hour), since.Add(-time.Hour)))
+
+	d := newTestDiscoverer(t, Config{ModifiedSince: since})
+	files, err := d.Find(tmpDir)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{newFile}, files)
+	if assert.Len(t, d.Excluded, 1) {
+		assert.Equal(t, oldFile, d.Excluded[0].Path)
+		assert.Contains(t, d.Excluded[0].Rule, "--modified-since")
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	since, err := ParseSince("7d", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, -7), since)
+
+	since, err = ParseSince("36h", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-36*time.Hour), since)
+
+	since, err = ParseSince("2025-01-02T03:04:05Z", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), since)
+
+	since, err = ParseSince("2025-01-02", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local), since)
+
+	_, err = ParseSince("last tuesday", now)
+	assert.Error(t, err)
+	_, err = ParseSince("-3d", now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package discovery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// tsPacket is the size of an MPEG transport stream packet, m2ts adds a 4 byte timecode in front
+const tsPacket = 188
+
+// sniffSize covers the longest signature - two m2ts packets
+const sniffSize = 2*(tsPacket+4) + 1
+
+var (
+	ebml = []byte{0x1A, 0x45, 0xDF, 0xA3}
+	asf  = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}
+	// boxes that can open an ISO BMFF / QuickTime file
+	mp4Boxes = [][]byte{[]byte("ftyp"), []byte("moov"), []byte("mdat"), []byte("free"), []byte("wide"), []byte("skip")}
+)
+
+// Sniff returns the container found in the first bytes of path, empty when it is not a known one
+func Sniff(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	header := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return SniffBytes(header[:n]), nil
+}
+
+// SniffBytes identifies a container from its header
+func SniffBytes(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, ebml):
+		return "matroska"
+	case len(header) >= 12 && bytes.Equal(header[:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("AVI ")):
+		return "avi"
+	case bytes.HasPrefix(header, asf):
+		return "asf"
+	case bytes.HasPrefix(header, []byte("FLV")):
+		return "flv"
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return "ogg"
+	case bytes.HasPrefix(header, []byte{0x00, 0x00, 0x01, 0xBA}):
+		return "mpeg"
+	case len(header) > tsPacket && header[0] == 0x47 && header[tsPacket] == 0x47:
+		return "mpegts"
+	case len(header) > tsPacket+8 && header[4] == 0x47 && header[tsPacket+8] == 0x47:
+		return "m2ts"
+	}
+	if len(header) >= 8 {
+		for _, box := range mp4Boxes {
+			if bytes.Equal(header[4:8], box) {
+				return "mp4"
+			}
+		}
+	}
+	return ""
+}
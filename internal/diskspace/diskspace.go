@@ -0,0 +1,187 @@
+package diskspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+// ErrNeverFits is returned when a job needs more than the filesystem could ever free up
+var ErrNeverFits = errors.New("not enough disk space")
+
+// Config controls the free space check before each remux
+type Config struct {
+	// Check holds jobs back until the space they need is free, and fails the ones that can never fit
+	Check bool `toml:"check"`
+	// MinFreeMB is left free on every filesystem on top of what the jobs need
+	MinFreeMB int64 `toml:"min_free_mb"`
+	// PollInterval is how often a waiting job looks at the free space again, releases wake it sooner
+	PollInterval time.Duration `toml:"poll_interval"`
+}
+
+// NewConfig returns the default config - checking, with 256MB of headroom
+func NewConfig() Config {
+	return Config{
+		Check:        true,
+		MinFreeMB:    256,
+		PollInterval: 10 * time.Second,
+	}
+}
+
+// Validate rejects negative headroom and intervals
+func (c Config) Validate() error {
+	if c.MinFreeMB < 0 {
+		return fmt.Errorf("min_free_mb must not be negative")
+	}
+	if c.PollInterval < 0 {
+		return fmt.Errorf("poll_interval must not be negative")
+	}
+	return nil
+}
+
+// Usage is what statfs reports for the filesystem holding a path
+type Usage struct {
+	// Device identifies the filesystem so jobs on the same share count against each other
+	Device uint64
+	// Free is the space available to vmu in bytes
+	Free uint64
+}
+
+// Need is space a job is about to write under Dir
+type Need struct {
+	Dir   string
+	Bytes uint64
+}
+
+// Reservations tracks the space promised to running jobs per filesystem
+type Reservations struct {
+	Config Config
+	// statfs is swapped out in tests
+	statfs   func(path string) (Usage, error)
+	mu       sync.Mutex
+	reserved map[uint64]uint64
+	changed  chan struct{}
+}
+
+// NewReservations creates a tracker with nothing reserved
+func NewReservations(config Config) *Reservations {
+	return &Reservations{
+		Config:   config,
+		statfs:   Statfs,
+		reserved: make(map[uint64]uint64),
+		changed:  make(chan struct{}),
+	}
+}
+
+// Reserve waits until every need fits next to what other jobs reserved, then reserves it until
+// release is called. waiting is called once when the job has to wait. A need that does not fit
+// even with every other reservation released fails right away with ErrNeverFits.
+func (r *Reservations) Reserve(ctx context.Context, needs []Need, waiting func()) (release func(), err error) {
+	notified := false
+	for {
+		r.mu.Lock()
+		want, free, err := r.usage(needs)
+		if errors.Is(err, errors.ErrUnsupported) {
+			r.mu.Unlock()
+			log.Debug().Msg("Free space cannot be checked on this platform")
+			return func() {}, nil
+		}
+		if err != nil {
+			r.mu.Unlock()
+			return nil, err
+		}
+		headroom := uint64(r.Config.MinFreeMB) << 20
+		fits := true
+		for device, bytes := range want {
+			if bytes+headroom > free[device].Free+r.reserved[device] {
+				r.mu.Unlock()
+				return nil, fmt.Errorf("%w: %s needs %dMB and %dMB headroom, %dMB free and %dMB reserved by other jobs",
+					ErrNeverFits, free[device].dir, bytes>>20, headroom>>20, free[device].Free>>20, r.reserved[device]>>20)
+			}
+			if bytes+headroom+r.reserved[device] > free[device].Free {
+				fits = false
+			}
+		}
+		if fits {
+			for device, bytes := range want {
+				r.reserved[device] += bytes
+			}
+			r.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(func() { r.release(want) }) }, nil
+		}
+		changed := r.changed
+		r.mu.Unlock()
+
+		if !notified && waiting != nil {
+			waiting()
+			notified = true
+		}
+		poll := r.Config.PollInterval
+		if poll <= 0 {
+			poll = NewConfig().PollInterval
+		}
+		timer := time.NewTimer(poll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("waiting for disk space: %w", ctx.Err())
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Reserved is the space currently promised to jobs on the filesystem holding dir
+func (r *Reservations) Reserved(dir string) uint64 {
+	usage, err := r.statfs(utils.ExistingDir(dir))
+	if err != nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reserved[usage.Device]
+}
+
+// deviceUsage is the usage of a filesystem and the first directory it was seen through
+type deviceUsage struct {
+	Usage
+	dir string
+}
+
+// usage sums the needs per filesystem
+func (r *Reservations) usage(needs []Need) (map[uint64]uint64, map[uint64]deviceUsage, error) {
+	want := make(map[uint64]uint64)
+	free := make(map[uint64]deviceUsage)
+	for _, need := range needs {
+		dir := utils.ExistingDir(need.Dir)
+		usage, err := r.statfs(dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error checking free space on %s: %w", dir, err)
+		}
+		want[usage.Device] += need.Bytes
+		if _, ok := free[usage.Device]; !ok {
+			free[usage.Device] = deviceUsage{Usage: usage, dir: dir}
+		}
+	}
+	return want, free, nil
+}
+
+// release gives the space back and wakes the waiting jobs
+func (r *Reservations) release(want map[uint64]uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for device, bytes := range want {
+		r.reserved[device] -= bytes
+		if r.reserved[device] == 0 {
+			delete(r.reserved, device)
+		}
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
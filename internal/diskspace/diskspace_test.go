@@ -0,0 +1,128 @@
+package diskspace
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDisk reports every path on one filesystem with a fixed amount of free space
+func fakeDisk(r *Reservations, free *atomic.Uint64) {
+	r.statfs = func(path string) (Usage, error) {
+		return Usage{Device: 1, Free: free.Load()}, nil
+	}
+}
+
+func TestReservations_Reserve(t *testing.T) {
+	var free atomic.Uint64
+	free.Store(100 << 20)
+	r := NewReservations(Config{Check: true, MinFreeMB: 10, PollInterval: time.Hour})
+	fakeDisk(r, &free)
+
+	release, err := r.Reserve(context.Background(), []Need{{Dir: "/tv", Bytes: 60 << 20}}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(60<<20), r.Reserved("/tv"))
+	release()
+	release()
+	assert.Equal(t, uint64(0), r.Reserved("/tv"))
+}
+
+func TestReservations_ReserveNeverFits(t *testing.T) {
+	var free atomic.Uint64
+	free.Store(100 << 20)
+	r := NewReservations(Config{Check: true, MinFreeMB: 10, PollInterval: time.Hour})
+	fakeDisk(r, &free)
+	waited := false
+
+	// 2 x 50MB plus the headroom can never be free
+	_, err := r.Reserve(context.Background(), []Need{{Dir: "/tv", Bytes: 50 << 20}, {Dir: "/tv/out", Bytes: 50 << 20}}, func() { waited = true })
+
+	assert.ErrorIs(t, err, ErrNeverFits)
+	assert.False(t, waited)
+	assert.Equal(t, uint64(0), r.Reserved("/tv"))
+}
+
+func TestReservations_ReserveWaitsForRelease(t *testing.T) {
+	var free atomic.Uint64
+	free.Store(100 << 20)
+	r := NewReservations(Config{Check: true, PollInterval: time.Hour})
+	fakeDisk(r, &free)
+	first, err := r.Reserve(context.Background(), []Need{{Dir: "/tv", Bytes: 60 << 20}}, nil)
+	assert.NoError(t, err)
+
+	waiting := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		release, err := r.Reserve(context.Background(), []Need{{Dir: "/tv", Bytes: 60 << 20}}, func() { close(waiting) })
+		if release != nil {
+			release()
+		}
+		done <- err
+	}()
+
+	// the second job fits once the first is done, but not next to it
+	<-waiting
+	first()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("second job was not woken up by the release")
+	}
+}
+
+func TestReservations_ReserveCancelled(t *testing.T) {
+	var free atomic.Uint64
+	free.Store(100 << 20)
+	r := NewReservations(Config{Check: true, PollInterval: time.Hour})
+	fakeDisk(r, &free)
+	_, err := r.Reserve(context.Background(), []Need{{Dir: "/tv", Bytes: 60 << 20}}, nil)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = r.Reserve(ctx, []Need{{Dir: "/tv", Bytes: 60 << 20}}, nil)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestReservations_ReservePolls(t *testing.T) {
+	var free atomic.Uint64
+	free.Store(10 << 20)
+	r := NewReservations(Config{Check: true, PollInterval: 10 * time.Millisecond})
+	fakeDisk(r, &free)
+	r.reserved[1] = 50 << 20
+
+	// space freed outside of vmu is noticed on the next poll
+	release, err := r.Reserve(context.Background(), []Need{{Dir: "/tv", Bytes: 40 << 20}}, func() { free.Store(200 << 20) })
+
+	assert.NoError(t, err)
+	assert.NotNil(t, release)
+}
+
+func TestStatfs(t *testing.T) {
+	dir := t.TempDir()
+
+	usage, err := Statfs(dir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("statfs is not available on this platform")
+	}
+
+	assert.NoError(t, err)
+	assert.NotZero(t, usage.Free)
+	other, err := Statfs(filepath.Join(dir, "."))
+	assert.NoError(t, err)
+	assert.Equal(t, usage.Device, other.Device)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, NewConfig().Validate())
+	assert.Error(t, Config{MinFreeMB: -1}.Validate())
+	assert.Error(t, Config{PollInterval: -time.Second}.Validate())
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package diskspace
+
+import "errors"
+
+// Statfs is not available here, Reserve lets every job through
+func Statfs(path string) (Usage, error) {
+	return Usage{}, errors.ErrUnsupported
+}
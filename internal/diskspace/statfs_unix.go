@@ -0,0 +1,21 @@
+//go:build unix
+
+package diskspace
+
+import "syscall"
+
+// Statfs reports the filesystem holding path and the space available to unprivileged users
+func Statfs(path string) (Usage, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return Usage{}, err
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return Usage{}, err
+	}
+	return Usage{
+		Device: uint64(stat.Dev),
+		Free:   uint64(fs.Bavail) * uint64(fs.Bsize),
+	}, nil
+}
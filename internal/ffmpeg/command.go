@@ -3,7 +3,9 @@ package ffmpeg
 import (
 	"fmt"
 	"github.com/bmj2728/go-vmu/internal/metadata"
+	"github.com/bmj2728/go-vmu/internal/tracks"
 	"github.com/rs/zerolog/log"
+	"path/filepath"
 	"strings"
 )
 
@@ -12,6 +14,16 @@ type FFmpegCommand struct {
 	outputFile string
 	metadata   map[string]interface{}
 	args       []string
+	// replaceMetadata drops the existing global tags instead of merging into them
+	replaceMetadata bool
+	// chaptersFile is an FFMETADATA file whose chapters replace the input's
+	chaptersFile string
+	// extraTracks are subtitle and audio sidecars muxed in after all streams of the input,
+	// firstTrack is the output index of the first one - the input's stream count
+	extraTracks []tracks.Track
+	firstTrack  int
+	// convert remuxes into a different container, so every stream is kept and missing timestamps are generated
+	convert bool
 	// Other options if we need them
 }
 
@@ -21,19 +33,29 @@ func NewFFmpegCommand() *FFmpegCommand {
 
 func (cmd *FFmpegCommand) WithInput(input string) *FFmpegCommand {
 	return &FFmpegCommand{
-		inputFile:  input,
-		outputFile: cmd.outputFile,
-		metadata:   cmd.metadata,
-		args:       cmd.args,
+		inputFile:       input,
+		outputFile:      cmd.outputFile,
+		metadata:        cmd.metadata,
+		args:            cmd.args,
+		replaceMetadata: cmd.replaceMetadata,
+		chaptersFile:    cmd.chaptersFile,
+		extraTracks:     cmd.extraTracks,
+		firstTrack:      cmd.firstTrack,
+		convert:         cmd.convert,
 	}
 }
 
 func (cmd *FFmpegCommand) WithOutput(output string) *FFmpegCommand {
 	return &FFmpegCommand{
-		inputFile:  cmd.inputFile,
-		outputFile: output,
-		metadata:   cmd.metadata,
-		args:       cmd.args,
+		inputFile:       cmd.inputFile,
+		outputFile:      output,
+		metadata:        cmd.metadata,
+		args:            cmd.args,
+		replaceMetadata: cmd.replaceMetadata,
+		chaptersFile:    cmd.chaptersFile,
+		extraTracks:     cmd.extraTracks,
+		firstTrack:      cmd.firstTrack,
+		convert:         cmd.convert,
 	}
 }
 
@@ -47,16 +69,147 @@ func (cmd *FFmpegCommand) WithMetadata(meta metadata.Metadata) (*FFmpegCommand,
 	}
 
 	return &FFmpegCommand{
-		inputFile:  cmd.inputFile,
-		outputFile: cmd.outputFile,
-		metadata:   metaFields,
-		args:       cmd.args,
+		inputFile:       cmd.inputFile,
+		outputFile:      cmd.outputFile,
+		metadata:        metaFields,
+		args:            cmd.args,
+		replaceMetadata: cmd.replaceMetadata,
+		chaptersFile:    cmd.chaptersFile,
+		extraTracks:     cmd.extraTracks,
+		firstTrack:      cmd.firstTrack,
+		convert:         cmd.convert,
 	}, nil
 }
 
+// WithMetadataFields merges already converted tags into the input's tags
+func (cmd *FFmpegCommand) WithMetadataFields(fields map[string]interface{}) *FFmpegCommand {
+	return &FFmpegCommand{
+		inputFile:       cmd.inputFile,
+		outputFile:      cmd.outputFile,
+		metadata:        fields,
+		args:            cmd.args,
+		replaceMetadata: cmd.replaceMetadata,
+		chaptersFile:    cmd.chaptersFile,
+		extraTracks:     cmd.extraTracks,
+		firstTrack:      cmd.firstTrack,
+		convert:         cmd.convert,
+	}
+}
+
+// WithTags sets the exact global tags of the output - tags that are not listed are dropped
+func (cmd *FFmpegCommand) WithTags(tags map[string]string) *FFmpegCommand {
+	metaFields := make(map[string]interface{}, len(tags))
+	for key, value := range tags {
+		metaFields[key] = value
+	}
+	return &FFmpegCommand{
+		inputFile:       cmd.inputFile,
+		outputFile:      cmd.outputFile,
+		metadata:        metaFields,
+		args:            cmd.args,
+		replaceMetadata: true,
+		chaptersFile:    cmd.chaptersFile,
+		extraTracks:     cmd.extraTracks,
+		firstTrack:      cmd.firstTrack,
+		convert:         cmd.convert,
+	}
+}
+
+// WithChapters replaces the input's chapters with those of an FFMETADATA file
+func (cmd *FFmpegCommand) WithChapters(chaptersFile string) *FFmpegCommand {
+	return &FFmpegCommand{
+		inputFile:       cmd.inputFile,
+		outputFile:      cmd.outputFile,
+		metadata:        cmd.metadata,
+		args:            cmd.args,
+		replaceMetadata: cmd.replaceMetadata,
+		chaptersFile:    chaptersFile,
+		extraTracks:     cmd.extraTracks,
+		firstTrack:      cmd.firstTrack,
+		convert:         cmd.convert,
+	}
+}
+
+// WithTracks muxes sidecar tracks into the output, inputStreams is the number of streams in the input
+func (cmd *FFmpegCommand) WithTracks(extraTracks []tracks.Track, inputStreams int) *FFmpegCommand {
+	return &FFmpegCommand{
+		inputFile:       cmd.inputFile,
+		outputFile:      cmd.outputFile,
+		metadata:        cmd.metadata,
+		args:            cmd.args,
+		replaceMetadata: cmd.replaceMetadata,
+		chaptersFile:    cmd.chaptersFile,
+		extraTracks:     extraTracks,
+		firstTrack:      inputStreams,
+		convert:         cmd.convert,
+	}
+}
+
+// WithConversion remuxes the input into the container of the output file
+func (cmd *FFmpegCommand) WithConversion() *FFmpegCommand {
+	return &FFmpegCommand{
+		inputFile:       cmd.inputFile,
+		outputFile:      cmd.outputFile,
+		metadata:        cmd.metadata,
+		args:            cmd.args,
+		replaceMetadata: cmd.replaceMetadata,
+		chaptersFile:    cmd.chaptersFile,
+		extraTracks:     cmd.extraTracks,
+		firstTrack:      cmd.firstTrack,
+		convert:         true,
+	}
+}
+
 func (cmd *FFmpegCommand) GenerateArgs() *FFmpegCommand {
 
-	args := []string{"-loglevel", "debug", "-i", cmd.inputFile, "-c", "copy"}
+	//every input has to come before the output options
+	args := []string{"-loglevel", "debug"}
+	if cmd.convert {
+		//avi and mpeg streams often lack the timestamps newer containers require
+		args = append(args, "-fflags", "+genpts")
+	}
+	args = append(args, "-i", cmd.inputFile)
+	nextInput := 1
+	if cmd.chaptersFile != "" {
+		args = append(args, "-f", "ffmetadata", "-i", cmd.chaptersFile)
+		nextInput++
+	}
+	for _, track := range cmd.extraTracks {
+		args = append(args, "-i", track.Path)
+	}
+
+	if cmd.chaptersFile != "" {
+		args = append(args, "-map_chapters", "1")
+	}
+	if len(cmd.extraTracks) > 0 || cmd.convert {
+		//keep every stream of the input, then the first stream of each sidecar
+		args = append(args, "-map", "0")
+		for i := range cmd.extraTracks {
+			args = append(args, "-map", fmt.Sprintf("%d:0", nextInput+i))
+		}
+	}
+	if cmd.replaceMetadata {
+		// only the global tags are dropped, stream tags such as language are still copied
+		args = append(args, "-map_metadata:g", "-1")
+	}
+	args = append(args, "-c", "copy")
+	if len(cmd.extraTracks) > 0 {
+		//mp4 only stores text subtitles as mov_text
+		switch strings.ToLower(filepath.Ext(cmd.outputFile)) {
+		case ".mp4", ".m4v", ".mov":
+			args = append(args, "-c:s", "mov_text")
+		}
+	}
+	for i, track := range cmd.extraTracks {
+		stream := cmd.firstTrack + i
+		if track.Language != "" {
+			args = append(args, fmt.Sprintf("-metadata:s:%d", stream), "language="+track.Language)
+		}
+		if track.Title != "" {
+			args = append(args, fmt.Sprintf("-metadata:s:%d", stream), "title="+track.Title)
+		}
+		args = append(args, fmt.Sprintf("-disposition:%d", stream), track.Disposition())
+	}
 
 	for key, value := range cmd.metadata {
 		args = append(args, "-metadata", fmt.Sprintf("%s=%v", key, value))
@@ -65,11 +218,28 @@ func (cmd *FFmpegCommand) GenerateArgs() *FFmpegCommand {
 	args = append(args, cmd.outputFile)
 
 	return &FFmpegCommand{
-		inputFile:  cmd.inputFile,
-		outputFile: cmd.outputFile,
-		metadata:   cmd.metadata,
-		args:       args,
+		inputFile:       cmd.inputFile,
+		outputFile:      cmd.outputFile,
+		metadata:        cmd.metadata,
+		args:            args,
+		replaceMetadata: cmd.replaceMetadata,
+		chaptersFile:    cmd.chaptersFile,
+		extraTracks:     cmd.extraTracks,
+		firstTrack:      cmd.firstTrack,
+		convert:         cmd.convert,
+	}
+}
+
+// Tags returns the global tags the command writes, as ffmpeg gets them
+func (cmd *FFmpegCommand) Tags() map[string]string {
+	if cmd.metadata == nil {
+		return nil
+	}
+	tags := make(map[string]string, len(cmd.metadata))
+	for key, value := range cmd.metadata {
+		tags[key] = fmt.Sprintf("%v", value)
 	}
+	return tags
 }
 
 func (cmd *FFmpegCommand) ArgsString() (string, error) {
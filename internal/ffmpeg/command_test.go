@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/bmj2728/go-vmu/internal/metadata"
+	"github.com/bmj2728/go-vmu/internal/tracks"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -241,3 +242,112 @@ func TestFFmpegCommand_Integration(t *testing.T) {
 	assert.Contains(t, argsString, "-metadata episode=2")
 	assert.Contains(t, argsString, "/path/to/output.mkv")
 }
+
+func TestFFmpegCommand_WithTags(t *testing.T) {
+	cmd := NewFFmpegCommand().
+		WithInput("/path/to/input.mkv").
+		WithOutput("/path/to/output.mkv").
+		WithTags(map[string]string{"title": "Old Title"}).
+		GenerateArgs()
+
+	assert.True(t, cmd.replaceMetadata)
+	assert.Equal(t, []string{
+		"-loglevel", "debug", "-i", "/path/to/input.mkv",
+		"-map_metadata:g", "-1", "-c", "copy",
+		"-metadata", "title=Old Title",
+		"/path/to/output.mkv",
+	}, cmd.args)
+}
+
+func TestFFmpegCommand_Tags(t *testing.T) {
+	assert.Nil(t, NewFFmpegCommand().Tags())
+
+	cmd := NewFFmpegCommand().WithMetadataFields(map[string]interface{}{"title": "Pilot", "episode_id": 3})
+	assert.Equal(t, map[string]string{"title": "Pilot", "episode_id": "3"}, cmd.Tags())
+}
+
+func TestFFmpegCommand_WithChapters(t *testing.T) {
+	meta := &metadata.Metadata{Title: "Test Title"}
+	cmd, err := NewFFmpegCommand().
+		WithInput("/path/to/input.mkv").
+		WithOutput("/path/to/output.mkv").
+		WithChapters("/path/to/output.mkv.ffmetadata").
+		WithMetadata(*meta)
+	assert.NoError(t, err)
+
+	argsString, err := cmd.GenerateArgs().ArgsString()
+
+	assert.NoError(t, err)
+	assert.Contains(t, argsString, "-i /path/to/input.mkv -f ffmetadata -i /path/to/output.mkv.ffmetadata -map_chapters 1 -c copy")
+}
+
+func TestFFmpegCommand_WithTracks(t *testing.T) {
+	cmd := NewFFmpegCommand().
+		WithInput("/path/to/input.mkv").
+		WithOutput("/path/to/output.mkv").
+		WithChapters("/path/to/output.mkv.ffmetadata").
+		WithTracks([]tracks.Track{
+			{Path: "/path/to/input.en.forced.srt", Kind: tracks.KindSubtitle, Language: "eng", Forced: true},
+			{Path: "/path/to/input.commentary.ac3", Kind: tracks.KindAudio, Title: "Commentary", Commentary: true},
+		}, 3).
+		WithTags(map[string]string{"title": "Pilot"}).
+		GenerateArgs()
+
+	assert.Equal(t, []string{
+		"-loglevel", "debug",
+		"-i", "/path/to/input.mkv",
+		"-f", "ffmetadata", "-i", "/path/to/output.mkv.ffmetadata",
+		"-i", "/path/to/input.en.forced.srt",
+		"-i", "/path/to/input.commentary.ac3",
+		"-map_chapters", "1",
+		"-map", "0", "-map", "2:0", "-map", "3:0",
+		"-map_metadata:g", "-1",
+		"-c", "copy",
+		"-metadata:s:3", "language=eng", "-disposition:3", "forced",
+		"-metadata:s:4", "title=Commentary", "-disposition:4", "comment",
+		"-metadata", "title=Pilot",
+		"/path/to/output.mkv",
+	}, cmd.args)
+
+	mp4 := NewFFmpegCommand().
+		WithInput("/path/to/input.mp4").
+		WithOutput("/path/to/output.mp4").
+		WithTracks([]tracks.Track{{Path: "/path/to/input.srt", Kind: tracks.KindSubtitle}}, 2).
+		WithTags(map[string]string{}).
+		GenerateArgs()
+	argsString, err := mp4.ArgsString()
+	assert.NoError(t, err)
+	assert.Contains(t, argsString, "-c copy -c:s mov_text -disposition:2 0")
+}
+
+func TestFFmpegCommand_WithConversion(t *testing.T) {
+	cmd := NewFFmpegCommand().
+		WithInput("/path/to/input.avi").
+		WithOutput("/path/to/input.govmu-edit.mkv").
+		WithConversion().
+		WithTags(map[string]string{"title": "Pilot"}).
+		GenerateArgs()
+
+	assert.Equal(t, []string{
+		"-loglevel", "debug",
+		"-fflags", "+genpts",
+		"-i", "/path/to/input.avi",
+		"-map", "0",
+		"-map_metadata:g", "-1",
+		"-c", "copy",
+		"-metadata", "title=Pilot",
+		"/path/to/input.govmu-edit.mkv",
+	}, cmd.args)
+
+	// sidecar tracks share the single -map 0
+	withTracks := NewFFmpegCommand().
+		WithInput("/path/to/input.avi").
+		WithOutput("/path/to/input.govmu-edit.mkv").
+		WithConversion().
+		WithTracks([]tracks.Track{{Path: "/path/to/input.srt", Kind: tracks.KindSubtitle}}, 2).
+		WithMetadataFields(map[string]interface{}{}).
+		GenerateArgs()
+	argsString, err := withTracks.ArgsString()
+	assert.NoError(t, err)
+	assert.Contains(t, argsString, "-map 0 -map 1:0 -c copy")
+}
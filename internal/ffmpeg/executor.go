@@ -2,23 +2,98 @@ package ffmpeg
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"github.com/bmj2728/go-vmu/internal/backup"
+	"github.com/bmj2728/go-vmu/internal/chapters"
+	"github.com/bmj2728/go-vmu/internal/metrics"
 	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/bmj2728/go-vmu/internal/tracks"
 	"github.com/bmj2728/go-vmu/internal/utils"
 	"github.com/bmj2728/go-vmu/internal/validator"
 	"github.com/rs/zerolog/log"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// The errors of Execute, ValidateNewFile and Cleanup wrap the sentinel of their step
+var (
+	ErrRemux      = errors.New("remux failed")
+	ErrValidation = errors.New("validation failed")
+	ErrCleanup    = errors.New("cleanup failed")
+)
+
+// stderrTailLines is how much of ffmpeg's stderr an FFmpegExitError keeps
+const stderrTailLines = 5
+
+// FFmpegExitError reports ffmpeg exiting unsuccessfully with the last lines it wrote to stderr
+type FFmpegExitError struct {
+	Code       int
+	StderrTail string
+}
+
+func (e *FFmpegExitError) Error() string {
+	if e.StderrTail == "" {
+		return fmt.Sprintf("ffmpeg exited with code %d", e.Code)
+	}
+	return fmt.Sprintf("ffmpeg exited with code %d: %s", e.Code, e.StderrTail)
+}
+
+// tail returns the last n non-empty lines of s joined by " | "
+func tail(s string, n int) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, " | ")
+}
+
 type Executor struct {
 	FFmpegCommand   *FFmpegCommand
 	Validator       *validator.Validator
 	ProgressTracker *tracker.ProgressTracker
+	// Destination is where the validated file is moved to - when empty the input is replaced.
+	// Setting it makes the run non-destructive, so no backup is taken.
+	Destination string
+	// Backups retains the backup after a successful run instead of deleting it
+	Backups *backup.Store
+	RunID   string
+	// Chapters replace the input's chapters, nil leaves them alone. The validator checks the count.
+	Chapters []chapters.Chapter
+	// ChapterWriter is chapters.WriterMkvpropedit to write Chapters into the output after the remux,
+	// otherwise the command is expected to carry them as an FFMETADATA input
+	ChapterWriter string
+	// Tracks are the sidecars muxed in by the command, the validator checks each one landed
+	Tracks []tracks.Track
+	// RemoveInput deletes the input once the validated file is at Destination - used when converting
+	// to another container. The input goes to the backup store first when one is configured.
+	RemoveInput bool
+	// Duration of the input as probed, progress percentages and ETAs are computed against it
+	Duration time.Duration
+	// Original is the library file the job is for when the input is a scratch copy of it - backups,
+	// progress and RemoveInput refer to it. Empty means the input itself.
+	Original string
+	// Context stops ffmpeg, mkvpropedit and the validation probes when it ends, nil never stops them
+	Context context.Context
+	// Timeout bounds the remux, ValidateTimeout the validation - zero leaves both to Context
+	Timeout         time.Duration
+	ValidateTimeout time.Duration
 	backup          string
+	backupEntry     *backup.Entry
+	// ffmpegState is how ffmpeg exited, nil until it ran
+	ffmpegState *os.ProcessState
 }
 
 func NewExecutor(cmd *FFmpegCommand, tracker *tracker.ProgressTracker) *Executor {
@@ -28,7 +103,52 @@ func NewExecutor(cmd *FFmpegCommand, tracker *tracker.ProgressTracker) *Executor
 	}
 }
 
+// trackProgress feeds ffmpeg's -progress output into the progress tracker until r is closed
+func (e *Executor) trackProgress(r *io.PipeReader, started time.Time) {
+	err := ParseProgress(r, func(progress Progress) {
+		e.ProgressTracker.UpdateProgress(e.original(), progress.Estimate(e.Duration, time.Since(started)))
+	})
+	if err != nil {
+		log.Debug().Err(err).Msg("Error reading ffmpeg progress")
+	}
+	//keep ffmpeg from blocking on a full pipe if parsing stopped early
+	_, _ = io.Copy(io.Discard, r)
+}
+
+// ExitCode returns ffmpeg's exit code, -1 when it was killed by a signal. ran is false when
+// ffmpeg never started.
+func (e *Executor) ExitCode() (code int, ran bool) {
+	if e.ffmpegState == nil {
+		return 0, false
+	}
+	return e.ffmpegState.ExitCode(), true
+}
+
+// original is the library file the job is for
+func (e *Executor) original() string {
+	if e.Original == "" {
+		return e.FFmpegCommand.inputFile
+	}
+	return e.Original
+}
+
+// context is the executor's Context, or one that never ends
+func (e *Executor) context() context.Context {
+	if e.Context == nil {
+		return context.Background()
+	}
+	return e.Context
+}
+
+// Execute backs up the input when it is replaced and runs ffmpeg, errors wrap ErrRemux
 func (e *Executor) Execute() error {
+	if err := e.execute(); err != nil {
+		return fmt.Errorf("%w: %w", ErrRemux, err)
+	}
+	return nil
+}
+
+func (e *Executor) execute() error {
 	//validate args
 	log.Debug().Msgf("Validating args: %v", e.FFmpegCommand.args)
 	ok, err := e.validArgs()
@@ -37,23 +157,40 @@ func (e *Executor) Execute() error {
 		return err
 	}
 
-	//backup the file
-	log.Debug().Msg("Backing up file")
-
-	//update the tracker
-	if e.ProgressTracker != nil {
-		e.ProgressTracker.UpdateStage(e.FFmpegCommand.inputFile, tracker.StageBackup)
+	//a file that ran out of time while probing is not worth a backup
+	if err := e.context().Err(); err != nil {
+		return fmt.Errorf("not running ffmpeg: %w", err)
 	}
 
-	err = e.backupFile()
-	if err != nil {
-		log.Error().Err(err).Msg("Error copying file")
-		return err
+	//backup the file - the input is never touched when writing to a destination
+	if e.Destination == "" {
+		log.Debug().Msg("Backing up file")
+
+		//update the tracker
+		if e.ProgressTracker != nil {
+			e.ProgressTracker.UpdateStage(e.original(), tracker.StageBackup)
+		}
+
+		err = e.backupFile()
+		if err != nil {
+			log.Error().Err(err).Msg("Error copying file")
+			return err
+		}
+		log.Debug().Msgf("File backed up to %s", e.backup)
 	}
-	log.Debug().Msgf("File backed up to %s", e.backup)
 
 	//execute the command
-	command := exec.Command("ffmpeg", e.FFmpegCommand.args...)
+	ctx, cancel := e.context(), context.CancelFunc(func() {})
+	if e.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+	}
+	defer cancel()
+	args := e.FFmpegCommand.args
+	if e.ProgressTracker != nil {
+		//machine-readable progress on stdout instead of the stats line on stderr
+		args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+	}
+	command := utils.CommandContext(ctx, "ffmpeg", args...)
 	//log.Debug().Msgf("Executing command: %v", command.Args)
 
 	quotedArgs := make([]string, len(e.FFmpegCommand.args))
@@ -68,13 +205,42 @@ func (e *Executor) Execute() error {
 	command.Stderr = &stderr
 
 	//update the tracker
+	started := time.Now()
 	if e.ProgressTracker != nil {
-		e.ProgressTracker.UpdateStage(e.FFmpegCommand.inputFile, tracker.StageProcess)
+		e.ProgressTracker.UpdateStage(e.original(), tracker.StageProcess)
+		reader, writer := io.Pipe()
+		command.Stdout = writer
+		progressDone := make(chan struct{})
+		go func() {
+			defer close(progressDone)
+			e.trackProgress(reader, started)
+		}()
+		defer func() {
+			_ = writer.Close()
+			<-progressDone
+		}()
 	}
 
 	err = command.Run()
+	e.ffmpegState = command.ProcessState
+	metrics.FFmpegDuration.Observe(metrics.Since(started))
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		err = &FFmpegExitError{Code: exitErr.ExitCode(), StderrTail: tail(stderr.String(), stderrTailLines)}
+	}
+	if err == nil && e.ChapterWriter == chapters.WriterMkvpropedit && e.Chapters != nil {
+		log.Debug().Msgf("Writing %d chapters with mkvpropedit", len(e.Chapters))
+		err = chapters.Mkvpropedit(ctx, e.FFmpegCommand.outputFile, e.Chapters)
+	}
+	//a killed process only reports the signal, keep the reason
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		err = fmt.Errorf("remux stopped: %w (%v)", ctxErr, err)
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Error running command\n")
+		if e.Destination != "" {
+			return errors.Join(err, e.discardPartialOutput())
+		}
 		//needs cleanup to revert file
 		clErr := e.revertToBackup()
 		if clErr != nil {
@@ -99,14 +265,23 @@ func (e *Executor) Execute() error {
 }
 
 func (e *Executor) ValidateNewFile() (bool, error) {
-	e.Validator = validator.NewValidator(e.FFmpegCommand.inputFile, e.FFmpegCommand.outputFile, 300)
+	e.Validator = validator.NewValidatorContext(e.context(), e.FFmpegCommand.inputFile, e.FFmpegCommand.outputFile, e.ValidateTimeout)
+	if e.Chapters != nil {
+		e.Validator = e.Validator.WithChapterCount(len(e.Chapters))
+	}
+	if len(e.Tracks) > 0 {
+		e.Validator = e.Validator.WithTracks(e.Tracks)
+	}
 	//update the tracker
 	if e.ProgressTracker != nil {
-		e.ProgressTracker.UpdateStage(e.FFmpegCommand.inputFile, tracker.StageValidate)
+		e.ProgressTracker.UpdateStage(e.original(), tracker.StageValidate)
 	}
 	err := e.Validator.Validate()
 	if err != nil {
 		log.Error().Err(err).Msg("Error validating new file")
+		if e.Destination != "" {
+			return false, fmt.Errorf("%w: %w", ErrValidation, errors.Join(err, e.discardPartialOutput()))
+		}
 		//needs cleanup to revert file
 		clErr := e.revertToBackup()
 		if clErr != nil {
@@ -120,15 +295,43 @@ func (e *Executor) ValidateNewFile() (bool, error) {
 		if clErr != nil {
 			log.Error().Err(clErr).Msg("Error cleaning up")
 		}
-		return false, errors.Join(err, clErr)
+		return false, fmt.Errorf("%w: %w", ErrValidation, errors.Join(err, clErr))
 	}
 	return true, nil
 }
 
+// Cleanup moves the validated file into place and retires the backup, errors wrap ErrCleanup
 func (e *Executor) Cleanup() error {
+	if err := e.cleanup(); err != nil {
+		return fmt.Errorf("%w: %w", ErrCleanup, err)
+	}
+	return nil
+}
+
+func (e *Executor) cleanup() error {
 	//update the tracker
 	if e.ProgressTracker != nil {
-		e.ProgressTracker.UpdateStage(e.FFmpegCommand.inputFile, tracker.StageCleanup)
+		e.ProgressTracker.UpdateStage(e.original(), tracker.StageCleanup)
+	}
+
+	if e.Destination != "" {
+		//a scratch copy replacing the original is the only chance to keep the original in the store
+		if e.Backups != nil && e.Original != "" && e.Destination == e.Original {
+			if err := e.retainBackup(); err != nil {
+				return err
+			}
+		}
+		log.Debug().Msgf("Moving %s to %s for cleanup.", e.FFmpegCommand.outputFile, e.Destination)
+		err := moveIntoPlace(e.FFmpegCommand.outputFile, e.Destination)
+		if err != nil {
+			log.Error().Err(err).Msgf("Error moving output file into place: %s to %s", e.FFmpegCommand.outputFile, e.Destination)
+			return fmt.Errorf("failed to move new file to destination during cleanup: %w", err)
+		}
+		if e.RemoveInput {
+			return e.retireInput()
+		}
+		log.Debug().Msg("Updated file written to destination, original left untouched.")
+		return nil
 	}
 
 	log.Debug().Msgf("Renaming %s to %s for cleanup.", e.FFmpegCommand.outputFile, e.FFmpegCommand.inputFile)
@@ -139,6 +342,21 @@ func (e *Executor) Cleanup() error {
 	}
 	log.Debug().Msg("Original file replaced with updated file.")
 
+	// hand the backup over to the store for retention
+	if e.Backups != nil && e.backupEntry != nil {
+		err = e.Backups.Add(*e.backupEntry)
+		if err != nil {
+			log.Error().Err(err).Msg("Error recording backup")
+			return fmt.Errorf("failed to record backup %s: %w", e.backup, err)
+		}
+		if err := e.Backups.Prune(); err != nil {
+			log.Warn().Err(err).Msg("Error pruning backups")
+		}
+		e.backup = ""
+		e.backupEntry = nil
+		return nil
+	}
+
 	// remove the backup file
 	err = e.removeBackupFile()
 	if err != nil {
@@ -203,6 +421,9 @@ func (e *Executor) validArgs() (bool, error) {
 }
 
 func (e *Executor) backupFile() error {
+	if e.Backups != nil {
+		return e.retainedBackupFile()
+	}
 
 	newPath := utils.InsertTagToFileName(e.FFmpegCommand.inputFile, "backup")
 
@@ -221,7 +442,9 @@ func (e *Executor) backupFile() error {
 	defer closeFile(destFile, "destination")
 
 	// Copy data from source to destination
-	if _, err := io.Copy(destFile, sourceFile); err != nil {
+	copied, err := io.Copy(destFile, sourceFile)
+	metrics.BytesCopied.Add(float64(copied))
+	if err != nil {
 		return fmt.Errorf("error copying file: %w", err)
 	}
 
@@ -239,6 +462,64 @@ func (e *Executor) backupFile() error {
 	return nil
 }
 
+// retainedBackupFile copies the input into the backup store, recording its checksum for restores
+func (e *Executor) retainedBackupFile() error {
+	newPath := e.Backups.Path(e.original(), e.RunID)
+	sum, size, err := backup.CopyWithChecksum(e.FFmpegCommand.inputFile, newPath)
+	metrics.BytesCopied.Add(float64(size))
+	if err != nil {
+		_ = os.Remove(newPath)
+		return fmt.Errorf("error copying file to backup store: %w", err)
+	}
+	original, err := filepath.Abs(e.original())
+	if err != nil {
+		original = e.original()
+	}
+	e.backup = newPath
+	e.backupEntry = &backup.Entry{
+		RunID:     e.RunID,
+		Original:  original,
+		Backup:    newPath,
+		Checksum:  sum,
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+	return nil
+}
+
+// retainBackup copies the input into the backup store and records it there
+func (e *Executor) retainBackup() error {
+	if err := e.retainedBackupFile(); err != nil {
+		log.Error().Err(err).Msg("Error backing up original file")
+		return err
+	}
+	if err := e.Backups.Add(*e.backupEntry); err != nil {
+		log.Error().Err(err).Msg("Error recording backup")
+		return fmt.Errorf("failed to record backup %s: %w", e.backup, err)
+	}
+	if err := e.Backups.Prune(); err != nil {
+		log.Warn().Err(err).Msg("Error pruning backups")
+	}
+	e.backup = ""
+	e.backupEntry = nil
+	return nil
+}
+
+// retireInput removes the converted input, keeping it in the backup store when there is one
+func (e *Executor) retireInput() error {
+	if e.Backups != nil {
+		if err := e.retainBackup(); err != nil {
+			return err
+		}
+	}
+	log.Debug().Msgf("Removing converted file %s", e.original())
+	if err := os.Remove(e.original()); err != nil {
+		log.Error().Err(err).Msg("Error removing converted file")
+		return fmt.Errorf("failed to remove %s after conversion: %w", e.original(), err)
+	}
+	return nil
+}
+
 func closeFile(file *os.File, fileType string) {
 	if err := file.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
 		log.Error().Err(err).Msgf("Error closing %s file", fileType)
@@ -263,6 +544,16 @@ func (e *Executor) removeOutputFile() error {
 	return nil
 }
 
+// discardPartialOutput removes whatever ffmpeg managed to write, a missing file is fine
+func (e *Executor) discardPartialOutput() error {
+	err := os.Remove(e.FFmpegCommand.outputFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Error().Err(err).Msg("Error removing output file")
+		return err
+	}
+	return nil
+}
+
 func (e *Executor) revertToBackup() error {
 	// Use os.Rename for atomic replacement if possible, safer than copy+overwrite
 	log.Debug().Msgf("Reverting to backup: Renaming %s to %s", e.backup, e.FFmpegCommand.inputFile)
@@ -285,7 +576,9 @@ func (e *Executor) revertToBackup() error {
 		defer closeFile(destFile, "original_dest_for_revert")
 
 		// Copy data from source to destination
-		if _, copyErr := io.Copy(destFile, sourceFile); copyErr != nil {
+		copied, copyErr := io.Copy(destFile, sourceFile)
+		metrics.BytesCopied.Add(float64(copied))
+		if copyErr != nil {
 			return fmt.Errorf("error copying file during revert: %w", errors.Join(err, copyErr))
 		}
 		log.Debug().Msg("Successfully reverted to backup via copy.")
@@ -305,3 +598,81 @@ func (e *Executor) revertToBackup() error {
 
 	return nil
 }
+
+// moveIntoPlace renames src to dst. Across filesystems, e.g. from a scratch directory to a share,
+// src is copied to a temporary name next to dst first so dst is still replaced in one step.
+func moveIntoPlace(src string, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	log.Debug().Msgf("%s and %s are on different filesystems, pushing a copy", src, dst)
+	if err := pushFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// pushing holds the temporary files of the pushes in progress, so an interrupted run can remove them
+var pushing sync.Map
+
+// RemovePushTemps removes the temporary files of the pushes still in progress and returns their names
+func RemovePushTemps() []string {
+	var removed []string
+	pushing.Range(func(key, _ interface{}) bool {
+		name := key.(string)
+		if err := os.Remove(name); err == nil {
+			removed = append(removed, name)
+		}
+		pushing.Delete(name)
+		return true
+	})
+	return removed
+}
+
+// pushFile copies src to a temporary file beside dst, syncs it and renames it over dst
+func pushFile(src string, dst string) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer closeFile(source, "push source")
+	info, err := source.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", src, err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".govmu-push-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file next to %s: %w", dst, err)
+	}
+	pushing.Store(temp.Name(), struct{}{})
+	//anything short of the final rename leaves dst alone
+	published := false
+	defer func() {
+		pushing.Delete(temp.Name())
+		if !published {
+			closeFile(temp, "push temporary")
+			_ = os.Remove(temp.Name())
+		}
+	}()
+	copied, err := io.Copy(temp, source)
+	metrics.BytesCopied.Add(float64(copied))
+	if err != nil {
+		return fmt.Errorf("error copying %s to %s: %w", src, temp.Name(), err)
+	}
+	if err := temp.Chmod(info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", temp.Name(), err)
+	}
+	if err := temp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", temp.Name(), err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", temp.Name(), err)
+	}
+	if err := os.Rename(temp.Name(), dst); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", temp.Name(), dst, err)
+	}
+	published = true
+	return nil
+}
@@ -1,10 +1,14 @@
 package ffmpeg
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/bmj2728/go-vmu/internal/backup"
 	"github.com/bmj2728/go-vmu/internal/metadata"
 	"github.com/bmj2728/go-vmu/internal/tracker"
 	"github.com/bmj2728/go-vmu/internal/utils"
@@ -148,6 +152,7 @@ func TestExecutor_Execute(t *testing.T) {
 		err := executor.Execute()
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "args is nil")
+		assert.ErrorIs(t, err, ErrRemux)
 	})
 
 	// Mock the command execution for the valid case
@@ -171,6 +176,55 @@ func TestExecutor_Execute(t *testing.T) {
 		err := executor.Execute()
 		assert.Error(t, err)
 	})
+
+	t.Run("Context ended", func(t *testing.T) {
+		cmd := NewFFmpegCommand().WithInput(inputFile).WithOutput(outputFile).WithMetadataFields(map[string]interface{}{"title": "Test Title"}).GenerateArgs()
+		executor := NewExecutor(cmd, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+		<-ctx.Done()
+		executor.Context = ctx
+
+		err := executor.Execute()
+
+		// nothing is backed up or run once the file is out of time
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.NoFileExists(t, utils.InsertTagToFileName(inputFile, "backup"))
+		_, ran := executor.ExitCode()
+		assert.False(t, ran)
+	})
+}
+
+func TestExecutor_Execute_ExitError(t *testing.T) {
+	//a stand-in ffmpeg that fails like a broken input does
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho 'Input #0, matroska' >&2\necho 'Invalid data found when processing input' >&2\nexit 1\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(script), 0755))
+	t.Setenv("PATH", bin)
+
+	dir := t.TempDir()
+	inputFile := filepath.Join(dir, "input.mkv")
+	assert.NoError(t, os.WriteFile(inputFile, []byte("test data"), 0644))
+	cmd := NewFFmpegCommand().WithInput(inputFile).WithOutput(filepath.Join(dir, "output.mkv")).
+		WithMetadataFields(map[string]interface{}{"title": "Test Title"}).GenerateArgs()
+	executor := NewExecutor(cmd, nil)
+	executor.Destination = filepath.Join(dir, "out", "input.mkv")
+
+	err := executor.Execute()
+
+	assert.ErrorIs(t, err, ErrRemux)
+	var exitErr *FFmpegExitError
+	assert.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 1, exitErr.Code)
+	assert.Equal(t, "Input #0, matroska | Invalid data found when processing input", exitErr.StderrTail)
+	code, ran := executor.ExitCode()
+	assert.True(t, ran)
+	assert.Equal(t, 1, code)
+}
+
+func TestTail(t *testing.T) {
+	assert.Equal(t, "", tail("", 5))
+	assert.Equal(t, "c | d", tail("a\nb\n\nc\r\nd\n", 2))
 }
 
 // We skip TestExecutor_ValidateNewFile because it requires a real validator
@@ -217,6 +271,16 @@ func TestExecutor_Cleanup(t *testing.T) {
 		_, err = os.Stat(backupFile)
 		assert.True(t, os.IsNotExist(err))
 	})
+
+	t.Run("Cleanup failure", func(t *testing.T) {
+		// an output that was never written
+		missing := NewFFmpegCommand().WithInput(inputFile).WithOutput(filepath.Join(tmpDir, "missing.mkv"))
+		executor := NewExecutor(missing, nil)
+
+		err := executor.Cleanup()
+		assert.ErrorIs(t, err, ErrCleanup)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
 }
 
 // TestExecutor_backupFile tests the backupFile method
@@ -331,3 +395,181 @@ func TestExecutor_revertToBackup(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "backup data", string(content))
 }
+
+func TestExecutor_CleanupDestination(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "input.mkv")
+	destination := filepath.Join(tmpDir, "out", "input.mkv")
+	outputFile := utils.InsertTagToFileName(destination, "govmu-edit")
+
+	assert.NoError(t, os.WriteFile(inputFile, []byte("original"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(destination), 0755))
+	assert.NoError(t, os.WriteFile(outputFile, []byte("tagged"), 0644))
+
+	cmd := NewFFmpegCommand().WithInput(inputFile).WithOutput(outputFile)
+	executor := NewExecutor(cmd, nil)
+	executor.Destination = destination
+
+	assert.NoError(t, executor.Cleanup())
+
+	// the tagged file lands in the output tree and the original is untouched
+	content, err := os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, "tagged", string(content))
+	content, err = os.ReadFile(inputFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "original", string(content))
+	_, err = os.Stat(outputFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExecutor_CleanupRemoveInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "input.avi")
+	destination := filepath.Join(tmpDir, "input.mkv")
+	outputFile := utils.InsertTagToFileName(destination, "govmu-edit")
+
+	assert.NoError(t, os.WriteFile(inputFile, []byte("original"), 0644))
+	assert.NoError(t, os.WriteFile(outputFile, []byte("converted"), 0644))
+
+	store, err := backup.NewStore(backup.Config{Mode: backup.ModeDir}, filepath.Join(tmpDir, "state"))
+	assert.NoError(t, err)
+
+	cmd := NewFFmpegCommand().WithInput(inputFile).WithOutput(outputFile)
+	executor := NewExecutor(cmd, nil)
+	executor.Destination = destination
+	executor.RemoveInput = true
+	executor.Backups = store
+	executor.RunID = "run-1"
+
+	assert.NoError(t, executor.Cleanup())
+
+	// the converted file replaces the original, which is only kept in the backup store
+	content, err := os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, "converted", string(content))
+	_, err = os.Stat(inputFile)
+	assert.True(t, os.IsNotExist(err))
+	entries, err := store.ForRun("run-1")
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		content, err = os.ReadFile(entries[0].Backup)
+		assert.NoError(t, err)
+		assert.Equal(t, "original", string(content))
+	}
+}
+
+func TestExecutor_discardPartialOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "output.govmu-edit.mkv")
+	executor := NewExecutor(NewFFmpegCommand().WithOutput(outputFile), nil)
+
+	// nothing written yet is not an error
+	assert.NoError(t, executor.discardPartialOutput())
+
+	assert.NoError(t, os.WriteFile(outputFile, []byte("partial"), 0644))
+	assert.NoError(t, executor.discardPartialOutput())
+	_, err := os.Stat(outputFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExecutor_CleanupScratch(t *testing.T) {
+	tmpDir := t.TempDir()
+	original := filepath.Join(tmpDir, "library", "input.mkv")
+	scratch := filepath.Join(tmpDir, "scratch")
+	inputFile := filepath.Join(scratch, "input.mkv")
+	outputFile := filepath.Join(scratch, "input.govmu-edit.mkv")
+
+	assert.NoError(t, os.MkdirAll(filepath.Dir(original), 0755))
+	assert.NoError(t, os.MkdirAll(scratch, 0755))
+	assert.NoError(t, os.WriteFile(original, []byte("original"), 0644))
+	assert.NoError(t, os.WriteFile(inputFile, []byte("original"), 0644))
+	assert.NoError(t, os.WriteFile(outputFile, []byte("tagged"), 0644))
+
+	store, err := backup.NewStore(backup.Config{Mode: backup.ModeDir}, filepath.Join(tmpDir, "state"))
+	assert.NoError(t, err)
+
+	cmd := NewFFmpegCommand().WithInput(inputFile).WithOutput(outputFile)
+	executor := NewExecutor(cmd, nil)
+	executor.Destination = original
+	executor.Original = original
+	executor.Backups = store
+	executor.RunID = "run-1"
+
+	assert.NoError(t, executor.Cleanup())
+
+	// the tagged scratch copy replaces the original, which the store keeps under its own name
+	content, err := os.ReadFile(original)
+	assert.NoError(t, err)
+	assert.Equal(t, "tagged", string(content))
+	assert.NoFileExists(t, outputFile)
+	entries, err := store.ForRun("run-1")
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, original, entries[0].Original)
+		content, err = os.ReadFile(entries[0].Backup)
+		assert.NoError(t, err)
+		assert.Equal(t, "original", string(content))
+	}
+}
+
+func TestPushFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "scratch.mkv")
+	dst := filepath.Join(tmpDir, "share", "episode.mkv")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(dst), 0755))
+	assert.NoError(t, os.WriteFile(src, []byte("tagged"), 0600))
+	assert.NoError(t, os.WriteFile(dst, []byte("original"), 0644))
+
+	assert.NoError(t, pushFile(src, dst))
+
+	content, err := os.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "tagged", string(content))
+	info, err := os.Stat(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	// no temporary file is left next to the destination
+	entries, err := os.ReadDir(filepath.Dir(dst))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// a failed push leaves the destination alone
+	assert.Error(t, pushFile(filepath.Join(tmpDir, "missing.mkv"), dst))
+	assert.Error(t, pushFile(src, filepath.Join(tmpDir, "missing", "episode.mkv")))
+	content, err = os.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "tagged", string(content))
+}
+
+func TestRemovePushTemps(t *testing.T) {
+	tmpDir := t.TempDir()
+	// a fifo keeps the push copying until the writer closes it
+	src := filepath.Join(tmpDir, "scratch.mkv")
+	assert.NoError(t, syscall.Mkfifo(src, 0600))
+	dst := filepath.Join(tmpDir, "share", "episode.mkv")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(dst), 0755))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- pushFile(src, dst)
+	}()
+	writer, err := os.OpenFile(src, os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("half"))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		entries, _ := os.ReadDir(filepath.Dir(dst))
+		return len(entries) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	removed := RemovePushTemps()
+	assert.Len(t, removed, 1)
+	assert.Contains(t, filepath.Base(removed[0]), ".govmu-push-")
+	assert.NoError(t, writer.Close())
+	assert.Error(t, <-done)
+	entries, err := os.ReadDir(filepath.Dir(dst))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Empty(t, RemovePushTemps())
+}
@@ -0,0 +1,80 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is one block of ffmpeg's -progress output
+type Progress struct {
+	// OutTime is how far into the media ffmpeg has written
+	OutTime time.Duration
+	// TotalSize is the bytes written so far
+	TotalSize int64
+	// Speed is the processing speed as a multiple of realtime, 0 while unknown
+	Speed float64
+	// Done is set on the last block
+	Done bool
+}
+
+// ParseProgress reads key=value lines as written by -progress and calls fn at the end of every
+// block. Values ffmpeg reports as N/A keep the previous value.
+func ParseProgress(r io.Reader, fn func(Progress)) error {
+	var progress Progress
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		//out_time_ms is in microseconds as well, older builds only write that one
+		case "out_time_us", "out_time_ms":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				progress.OutTime = time.Duration(us) * time.Microsecond
+			}
+		case "total_size":
+			if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+				progress.TotalSize = size
+			}
+		case "speed":
+			if speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "x"), 64); err == nil {
+				progress.Speed = speed
+			}
+		case "progress":
+			progress.Done = value == "end"
+			fn(progress)
+		}
+	}
+	return scanner.Err()
+}
+
+// Estimate turns a progress block into percentage, throughput and time left for a file of the
+// given duration, elapsed is the wall time since ffmpeg started
+func (p Progress) Estimate(duration time.Duration, elapsed time.Duration) tracker.Progress {
+	estimate := tracker.Progress{Speed: p.Speed}
+	if elapsed > 0 {
+		estimate.BytesPerSecond = float64(p.TotalSize) / elapsed.Seconds()
+	}
+	if p.Done {
+		estimate.Percent = 100
+		return estimate
+	}
+	if duration <= 0 {
+		return estimate
+	}
+	done := min(float64(p.OutTime)/float64(duration), 1)
+	estimate.Percent = done * 100
+	switch {
+	case p.Speed > 0:
+		estimate.ETASeconds = (duration - p.OutTime).Seconds() / p.Speed
+	case done > 0:
+		estimate.ETASeconds = elapsed.Seconds() * (1 - done) / done
+	}
+	estimate.ETASeconds = max(estimate.ETASeconds, 0)
+	return estimate
+}
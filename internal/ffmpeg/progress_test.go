@@ -0,0 +1,78 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const progressOutput = `frame=120
+fps=0.00
+bitrate=N/A
+total_size=1048576
+out_time_us=5000000
+out_time_ms=5000000
+out_time=00:00:05.000000
+speed=N/A
+progress=continue
+frame=600
+total_size=5242880
+out_time_us=25000000
+out_time_ms=25000000
+speed=12.5x
+progress=continue
+total_size=10485760
+out_time_us=N/A
+speed=13x
+progress=end
+`
+
+func TestParseProgress(t *testing.T) {
+	var blocks []Progress
+	err := ParseProgress(strings.NewReader(progressOutput), func(p Progress) {
+		blocks = append(blocks, p)
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 3)
+	assert.Equal(t, Progress{OutTime: 5 * time.Second, TotalSize: 1 << 20}, blocks[0])
+	assert.Equal(t, Progress{OutTime: 25 * time.Second, TotalSize: 5 << 20, Speed: 12.5}, blocks[1])
+	// N/A keeps the previous out time
+	assert.Equal(t, Progress{OutTime: 25 * time.Second, TotalSize: 10 << 20, Speed: 13, Done: true}, blocks[2])
+}
+
+func TestProgress_Estimate(t *testing.T) {
+	t.Run("With speed", func(t *testing.T) {
+		estimate := Progress{OutTime: 30 * time.Second, TotalSize: 4 << 20, Speed: 10}.Estimate(2*time.Minute, 2*time.Second)
+		assert.Equal(t, 25.0, estimate.Percent)
+		assert.Equal(t, 10.0, estimate.Speed)
+		assert.Equal(t, float64(2<<20), estimate.BytesPerSecond)
+		assert.Equal(t, 9.0, estimate.ETASeconds)
+	})
+
+	t.Run("Without speed", func(t *testing.T) {
+		estimate := Progress{OutTime: time.Minute}.Estimate(2*time.Minute, 10*time.Second)
+		assert.Equal(t, 50.0, estimate.Percent)
+		assert.Equal(t, 10.0, estimate.ETASeconds)
+	})
+
+	t.Run("Unknown duration", func(t *testing.T) {
+		estimate := Progress{OutTime: time.Minute, TotalSize: 100}.Estimate(0, time.Second)
+		assert.Zero(t, estimate.Percent)
+		assert.Zero(t, estimate.ETASeconds)
+		assert.Equal(t, 100.0, estimate.BytesPerSecond)
+	})
+
+	t.Run("Past the end", func(t *testing.T) {
+		estimate := Progress{OutTime: 3 * time.Minute, Speed: 2}.Estimate(2*time.Minute, time.Second)
+		assert.Equal(t, 100.0, estimate.Percent)
+		assert.Zero(t, estimate.ETASeconds)
+	})
+
+	t.Run("Done", func(t *testing.T) {
+		estimate := Progress{OutTime: time.Minute, Done: true}.Estimate(2*time.Minute, time.Second)
+		assert.Equal(t, 100.0, estimate.Percent)
+	})
+}
@@ -0,0 +1,162 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// Events a hook can run on
+const (
+	EventFileStarted  = tracker.EventFileStarted
+	EventFileFinished = tracker.EventFileFinished
+	EventRunFinished  = "run_finished"
+)
+
+// defaultTimeout stops a hook that neither finishes nor fails
+const defaultTimeout = 30 * time.Second
+
+// Config describes a command or webhook to run on an event
+type Config struct {
+	Name string `toml:"name"`
+	// Event is file_started, file_finished or run_finished
+	Event string `toml:"event"`
+	// Statuses limits file_finished hooks to results with these statuses, e.g. ["CleanupError"]
+	Statuses []string `toml:"statuses"`
+	// Command is run with the event in VMU_* environment variables and as JSON on stdin
+	Command []string `toml:"command"`
+	// URL gets a POST of Body, or of the event as JSON when Body is empty
+	URL string `toml:"url"`
+	// Body is a text/template over the Payload, e.g. {"content": {{json .Message}}}
+	Body    string            `toml:"body"`
+	Headers map[string]string `toml:"headers"`
+	// Timeout for a single run of the hook, defaults to 30s
+	Timeout time.Duration `toml:"timeout"`
+}
+
+// DisplayName returns the configured name or falls back to the command or URL
+func (c Config) DisplayName() string {
+	switch {
+	case c.Name != "":
+		return c.Name
+	case len(c.Command) > 0:
+		return c.Command[0]
+	default:
+		return c.URL
+	}
+}
+
+// Validate checks the event, the statuses, that the hook is either a command or a URL and the body template
+func (c Config) Validate() error {
+	switch c.Event {
+	case EventFileStarted, EventFileFinished, EventRunFinished:
+	default:
+		return fmt.Errorf("hook %s: unknown event %q - use %q, %q or %q", c.DisplayName(), c.Event,
+			EventFileStarted, EventFileFinished, EventRunFinished)
+	}
+	if len(c.Statuses) > 0 && c.Event != EventFileFinished {
+		return fmt.Errorf("hook %s: statuses only apply to %s hooks", c.DisplayName(), EventFileFinished)
+	}
+	for _, status := range c.Statuses {
+		if _, ok := tracker.ParseStatus(status); !ok {
+			return fmt.Errorf("hook %s: unknown status %q", c.DisplayName(), status)
+		}
+	}
+	if (len(c.Command) > 0) == (c.URL != "") {
+		return fmt.Errorf("hook %s: set either command or url", c.DisplayName())
+	}
+	if c.Body != "" && c.URL == "" {
+		return fmt.Errorf("hook %s: body only applies to url hooks", c.DisplayName())
+	}
+	if _, err := c.template(); err != nil {
+		return fmt.Errorf("hook %s: %w", c.DisplayName(), err)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("hook %s: timeout must not be negative", c.DisplayName())
+	}
+	return nil
+}
+
+// matches reports whether the hook runs for the payload
+func (c Config) matches(payload Payload) bool {
+	if c.Event != payload.Event {
+		return false
+	}
+	if len(c.Statuses) == 0 {
+		return true
+	}
+	status, _ := tracker.ParseStatus(payload.Status)
+	for _, name := range c.Statuses {
+		if wanted, _ := tracker.ParseStatus(name); wanted == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return defaultTimeout
+	}
+	return c.Timeout
+}
+
+// template parses the body, nil when the event is sent as JSON
+func (c Config) template() (*template.Template, error) {
+	if c.Body == "" {
+		return nil, nil
+	}
+	return template.New(c.DisplayName()).Funcs(template.FuncMap{
+		//json quotes and escapes a value for use inside a JSON body
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(c.Body)
+}
+
+// Payload is what a hook gets to know about an event
+type Payload struct {
+	Event string `json:"event"`
+	RunID string `json:"run_id"`
+	// Message is a one-line summary for chat webhooks
+	Message string `json:"message"`
+	// File events
+	File            string  `json:"file,omitempty"`
+	Status          string  `json:"status,omitempty"`
+	Error           string  `json:"error,omitempty"`
+	Retries         int     `json:"retries,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	// Run events
+	Total     int            `json:"total,omitempty"`
+	Succeeded int            `json:"succeeded,omitempty"`
+	Failed    int            `json:"failed,omitempty"`
+	Statuses  map[string]int `json:"statuses,omitempty"`
+	Time      time.Time      `json:"time"`
+}
+
+// Env returns the payload as VMU_* environment variables for command hooks
+func (p Payload) Env() []string {
+	env := []string{
+		"VMU_EVENT=" + p.Event,
+		"VMU_RUN_ID=" + p.RunID,
+		"VMU_MESSAGE=" + p.Message,
+	}
+	if p.Event == EventRunFinished {
+		return append(env,
+			"VMU_TOTAL="+strconv.Itoa(p.Total),
+			"VMU_SUCCEEDED="+strconv.Itoa(p.Succeeded),
+			"VMU_FAILED="+strconv.Itoa(p.Failed),
+		)
+	}
+	return append(env,
+		"VMU_FILE="+p.File,
+		"VMU_STATUS="+p.Status,
+		"VMU_ERROR="+p.Error,
+		"VMU_RETRIES="+strconv.Itoa(p.Retries),
+		"VMU_DURATION="+strconv.FormatFloat(p.DurationSeconds, 'f', 3, 64),
+	)
+}
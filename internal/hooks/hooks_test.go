@@ -0,0 +1,191 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		hook  Config
+		valid bool
+	}{
+		{name: "Command", hook: Config{Event: EventFileFinished, Command: []string{"true"}}, valid: true},
+		{name: "Webhook", hook: Config{Event: EventRunFinished, URL: "http://localhost", Body: `{"content": {{json .Message}}}`}, valid: true},
+		{name: "Statuses", hook: Config{Event: EventFileFinished, Statuses: []string{"CleanupError"}, URL: "http://localhost"}, valid: true},
+		{name: "Unknown event", hook: Config{Event: "file_exploded", Command: []string{"true"}}},
+		{name: "Unknown status", hook: Config{Event: EventFileFinished, Statuses: []string{"Exploded"}, Command: []string{"true"}}},
+		{name: "Statuses on run hook", hook: Config{Event: EventRunFinished, Statuses: []string{"Success"}, Command: []string{"true"}}},
+		{name: "Neither command nor url", hook: Config{Event: EventFileStarted}},
+		{name: "Command and url", hook: Config{Event: EventFileStarted, Command: []string{"true"}, URL: "http://localhost"}},
+		{name: "Body on command", hook: Config{Event: EventFileStarted, Command: []string{"true"}, Body: "x"}},
+		{name: "Broken template", hook: Config{Event: EventRunFinished, URL: "http://localhost", Body: "{{.Message"}},
+		{name: "Negative timeout", hook: Config{Event: EventRunFinished, URL: "http://localhost", Timeout: -time.Second}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.hook.Validate()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestConfig_matches(t *testing.T) {
+	hook := Config{Event: EventFileFinished, Statuses: []string{"cleanuperror", "Timeout"}}
+
+	assert.True(t, hook.matches(Payload{Event: EventFileFinished, Status: "CleanupError"}))
+	assert.True(t, hook.matches(Payload{Event: EventFileFinished, Status: "Timeout"}))
+	assert.False(t, hook.matches(Payload{Event: EventFileFinished, Status: "Success"}))
+	assert.False(t, hook.matches(Payload{Event: EventRunFinished}))
+	assert.True(t, Config{Event: EventFileFinished}.matches(Payload{Event: EventFileFinished, Status: "Success"}))
+}
+
+func TestRunner_Command(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	runner := NewRunner([]Config{{
+		Event:   EventFileFinished,
+		Command: []string{"sh", "-c", `echo "$VMU_RUN_ID $VMU_STATUS $VMU_FILE" > "$0"; cat >> "$0"`, out},
+	}}, "run-1")
+
+	runner.Listener(tracker.Event{Type: tracker.EventFileStarted, File: "/videos/ep1.mkv", Time: time.Now()})
+	runner.FileFinished(&tracker.ProcessResult{FilePath: "/videos/ep1.mkv", Status: tracker.StatusSuccess, Success: true})
+	runner.RunFinished(nil)
+
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	first, stdin, _ := strings.Cut(string(data), "\n")
+	assert.Equal(t, "run-1 Success /videos/ep1.mkv", first)
+	var payload Payload
+	assert.NoError(t, json.Unmarshal([]byte(stdin), &payload))
+	assert.Equal(t, EventFileFinished, payload.Event)
+	assert.Equal(t, "ep1.mkv: Success", payload.Message)
+	assert.Greater(t, payload.DurationSeconds, 0.0)
+}
+
+func TestRunner_Webhook(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "vmu", r.Header.Get("Title"))
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	runner := NewRunner([]Config{
+		{Event: EventFileFinished, Statuses: []string{"CleanupError"}, URL: server.URL, Headers: map[string]string{"Title": "vmu"},
+			Body: `{"content": {{json .Message}}}`},
+		{Event: EventRunFinished, URL: server.URL, Headers: map[string]string{"Title": "vmu"}},
+	}, "run-2")
+
+	runner.FileFinished(&tracker.ProcessResult{FilePath: "/videos/ep1.mkv", Status: tracker.StatusSuccess, Success: true})
+	runner.FileFinished(&tracker.ProcessResult{FilePath: "/videos/ep2.mkv", Status: tracker.StatusCleanupError,
+		Error: errors.New(`rename "a" failed`)})
+	runner.RunFinished([]*tracker.ProcessResult{
+		{FilePath: "/videos/ep1.mkv", Status: tracker.StatusSuccess, Success: true},
+		{FilePath: "/videos/ep2.mkv", Status: tracker.StatusCleanupError},
+	})
+
+	assert.Len(t, bodies, 2)
+	assert.Contains(t, bodies, `{"content": "ep2.mkv: CleanupError - rename \"a\" failed"}`)
+	for _, body := range bodies {
+		var payload Payload
+		if json.Unmarshal([]byte(body), &payload) != nil || payload.Event != EventRunFinished {
+			continue
+		}
+		assert.Equal(t, "run-2", payload.RunID)
+		assert.Equal(t, 2, payload.Total)
+		assert.Equal(t, 1, payload.Succeeded)
+		assert.Equal(t, 1, payload.Failed)
+		assert.Equal(t, map[string]int{"Success": 1, "CleanupError": 1}, payload.Statuses)
+	}
+}
+
+func TestRunner_FailuresAndTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	runner := NewRunner([]Config{
+		{Event: EventRunFinished, URL: server.URL},
+		{Event: EventRunFinished, Command: []string{"sh", "-c", "exit 3"}},
+		{Event: EventRunFinished, Command: []string{"sleep", "30"}, Timeout: 100 * time.Millisecond},
+	}, "run-3")
+
+	assert.ErrorContains(t, runner.run(runner.Hooks[0], Payload{Event: EventRunFinished}), "500")
+	assert.ErrorContains(t, runner.run(runner.Hooks[1], Payload{Event: EventRunFinished}), "exit status 3")
+	assert.ErrorIs(t, runner.run(runner.Hooks[2], Payload{Event: EventRunFinished}), context.DeadlineExceeded)
+
+	// failing hooks are only logged, the timeout stops the sleep
+	started := time.Now()
+	runner.RunFinished(nil)
+	assert.Less(t, time.Since(started), 10*time.Second)
+}
+
+func TestRunner_FileStartedOnce(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	runner := NewRunner([]Config{{
+		Event:   EventFileStarted,
+		Command: []string{"sh", "-c", `echo "$VMU_FILE" >> "$0"`, out},
+	}}, "run-4")
+
+	// a retry starts the file again
+	runner.Listener(tracker.Event{Type: tracker.EventFileStarted, File: "/videos/ep1.mkv", Time: time.Now()})
+	runner.Listener(tracker.Event{Type: tracker.EventStageChanged, File: "/videos/ep1.mkv", Stage: tracker.StageProcess})
+	runner.Listener(tracker.Event{Type: tracker.EventFileStarted, File: "/videos/ep1.mkv", Time: time.Now()})
+	runner.RunFinished(nil)
+
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "/videos/ep1.mkv\n", string(data))
+}
+
+func TestRunner_Wait(t *testing.T) {
+	dir := t.TempDir()
+	runner := NewRunner([]Config{
+		{Event: EventFileStarted, Command: []string{"sh", "-c", `sleep 0.1; echo "$VMU_FILE" > "$0"`, filepath.Join(dir, "started")}},
+		{Event: EventRunFinished, Command: []string{"sh", "-c", `echo done > "$0"`, filepath.Join(dir, "finished")}},
+	}, "run-5")
+
+	runner.Listener(tracker.Event{Type: tracker.EventFileStarted, File: "/videos/ep1.mkv", Time: time.Now()})
+	runner.Wait()
+
+	data, err := os.ReadFile(filepath.Join(dir, "started"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/videos/ep1.mkv\n", string(data))
+	assert.NoFileExists(t, filepath.Join(dir, "finished"))
+}
+
+func TestPayload_Env(t *testing.T) {
+	env := Payload{Event: EventFileFinished, RunID: "run", File: "/videos/ep1.mkv", Status: "Success", DurationSeconds: 1.5}.Env()
+	assert.Contains(t, env, "VMU_FILE=/videos/ep1.mkv")
+	assert.Contains(t, env, "VMU_STATUS=Success")
+	assert.Contains(t, env, "VMU_DURATION=1.500")
+
+	env = Payload{Event: EventRunFinished, RunID: "run", Total: 3, Failed: 1}.Env()
+	assert.Contains(t, env, "VMU_TOTAL=3")
+	assert.Contains(t, env, "VMU_FAILED=1")
+	assert.NotContains(t, env, "VMU_FILE=")
+}
@@ -0,0 +1,207 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxParallel caps the hooks running at once so a burst of finished files does not fork a process each
+const maxParallel = 4
+
+// Runner runs the configured hooks in the background. A hook that fails or times out is logged
+// and never changes the outcome of the run.
+type Runner struct {
+	Hooks  []Config
+	RunID  string
+	Client *http.Client
+	slots  chan struct{}
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	// started holds when each file was first started, retries keep the first time
+	started map[string]time.Time
+}
+
+// NewRunner creates a runner for the hooks of a run
+func NewRunner(hooks []Config, runID string) *Runner {
+	return &Runner{
+		Hooks:   hooks,
+		RunID:   runID,
+		Client:  &http.Client{},
+		slots:   make(chan struct{}, maxParallel),
+		started: make(map[string]time.Time),
+	}
+}
+
+// Listener runs the file_started hooks, only for the first attempt of a file
+func (r *Runner) Listener(event tracker.Event) {
+	if event.Type != tracker.EventFileStarted {
+		return
+	}
+	r.mu.Lock()
+	_, retried := r.started[event.File]
+	if !retried {
+		r.started[event.File] = event.Time
+	}
+	r.mu.Unlock()
+	if retried {
+		return
+	}
+	r.fire(Payload{
+		Event:   EventFileStarted,
+		RunID:   r.RunID,
+		Message: fmt.Sprintf("%s: started", filepath.Base(event.File)),
+		File:    event.File,
+		Time:    event.Time,
+	})
+}
+
+// FileFinished runs the file_finished hooks for the final result of a file
+func (r *Runner) FileFinished(result *tracker.ProcessResult) {
+	now := time.Now()
+	payload := Payload{
+		Event:   EventFileFinished,
+		RunID:   r.RunID,
+		File:    result.FilePath,
+		Status:  result.Status.String(),
+		Retries: result.Retries,
+		Time:    now,
+	}
+	payload.Message = fmt.Sprintf("%s: %s", filepath.Base(result.FilePath), payload.Status)
+	if result.Error != nil {
+		payload.Error = result.Error.Error()
+		payload.Message += " - " + payload.Error
+	}
+	r.mu.Lock()
+	if started, ok := r.started[result.FilePath]; ok {
+		payload.DurationSeconds = now.Sub(started).Seconds()
+	}
+	r.mu.Unlock()
+	r.fire(payload)
+}
+
+// RunFinished runs the run_finished hooks with a summary of the results and waits for every hook
+// of the run to end
+func (r *Runner) RunFinished(results []*tracker.ProcessResult) {
+	payload := Payload{
+		Event:    EventRunFinished,
+		RunID:    r.RunID,
+		Total:    len(results),
+		Statuses: make(map[string]int),
+		Time:     time.Now(),
+	}
+	for _, result := range results {
+		if result.Success {
+			payload.Succeeded++
+		} else {
+			payload.Failed++
+		}
+		payload.Statuses[result.Status.String()]++
+	}
+	payload.Message = fmt.Sprintf("Run %s finished: %d files, %d succeeded, %d failed",
+		r.RunID, payload.Total, payload.Succeeded, payload.Failed)
+	r.fire(payload)
+	r.Wait()
+}
+
+// Wait waits for the hooks already started to end, without running the run_finished hooks
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// fire starts every hook matching the payload in the background
+func (r *Runner) fire(payload Payload) {
+	for _, hook := range r.Hooks {
+		if !hook.matches(payload) {
+			continue
+		}
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.slots <- struct{}{}
+			defer func() { <-r.slots }()
+			if err := r.run(hook, payload); err != nil {
+				log.Warn().Err(err).Msgf("Hook %s failed on %s", hook.DisplayName(), payload.Event)
+				return
+			}
+			log.Debug().Msgf("Hook %s ran on %s", hook.DisplayName(), payload.Event)
+		}()
+	}
+}
+
+// run runs a single hook within its timeout
+func (r *Runner) run(hook Config, payload Payload) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hook.timeout())
+	defer cancel()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if len(hook.Command) > 0 {
+		return runCommand(ctx, hook, payload, data)
+	}
+	return r.post(ctx, hook, payload, data)
+}
+
+// runCommand runs a command hook with the payload in its environment and on stdin
+func runCommand(ctx context.Context, hook Config, payload Payload, data []byte) error {
+	cmd := utils.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+	cmd.Env = append(os.Environ(), payload.Env()...)
+	cmd.Stdin = bytes.NewReader(data)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("command stopped: %w", ctx.Err())
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// post sends the rendered body, or the payload as JSON, to a webhook
+func (r *Runner) post(ctx context.Context, hook Config, payload Payload, data []byte) error {
+	tmpl, err := hook.template()
+	if err != nil {
+		return err
+	}
+	if tmpl != nil {
+		var body bytes.Buffer
+		if err := tmpl.Execute(&body, payload); err != nil {
+			return fmt.Errorf("error rendering body: %w", err)
+		}
+		data = body.Bytes()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range hook.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if err := resp.Body.Close(); err != nil {
+			log.Debug().Err(err).Msg("Error closing hook response body")
+		}
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status from %s: %s", hook.URL, resp.Status)
+	}
+	return nil
+}
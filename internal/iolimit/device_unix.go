@@ -0,0 +1,14 @@
+//go:build unix
+
+package iolimit
+
+import "syscall"
+
+// Device identifies the filesystem holding path
+func Device(path string) (uint64, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Dev), nil
+}
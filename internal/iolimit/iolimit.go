@@ -0,0 +1,239 @@
+package iolimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/metrics"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	"github.com/rs/zerolog/log"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoSlot is wrapped by the errors of an Acquire that did not get its slots
+var ErrNoSlot = errors.New("no concurrency slot")
+
+// Config limits how many files are processed at once on each filesystem
+type Config struct {
+	// Default is the limit for filesystems without a mount entry, 0 leaves them to the worker count
+	Default int `toml:"default"`
+	// Mounts set the limit of the filesystem holding each path
+	Mounts []Mount `toml:"mount"`
+	// Adaptive raises and lowers the limits by the throughput and error rate of finished files
+	Adaptive bool `toml:"adaptive"`
+	// MaxLimit caps what adaptive mode raises a limit to
+	MaxLimit int `toml:"max_limit"`
+}
+
+// Mount is the limit of a single filesystem, e.g. 2 for an NFS share
+type Mount struct {
+	Path  string `toml:"path"`
+	Limit int    `toml:"limit"`
+}
+
+// NewConfig returns the default config - no limits beyond the worker count
+func NewConfig() Config {
+	return Config{MaxLimit: 16}
+}
+
+// Enabled reports whether any filesystem is limited
+func (c Config) Enabled() bool {
+	return c.Default > 0 || len(c.Mounts) > 0 || c.Adaptive
+}
+
+// Validate checks the limits
+func (c Config) Validate() error {
+	if c.Default < 0 {
+		return fmt.Errorf("default concurrency must not be negative")
+	}
+	if c.MaxLimit < 1 {
+		return fmt.Errorf("max_limit must be at least 1")
+	}
+	for _, mount := range c.Mounts {
+		if mount.Path == "" {
+			return fmt.Errorf("concurrency mount needs a path")
+		}
+		if mount.Limit < 1 {
+			return fmt.Errorf("concurrency limit of %s must be at least 1", mount.Path)
+		}
+	}
+	return nil
+}
+
+// Workers is how many workers it takes to reach every configured limit at once,
+// 0 when the limits do not call for more than the default worker count
+func (c Config) Workers() int {
+	workers := c.Default
+	for _, mount := range c.Mounts {
+		workers += mount.Limit
+	}
+	if c.Adaptive {
+		workers = c.MaxLimit * (len(c.Mounts) + 1)
+	}
+	return workers
+}
+
+// Outcome is what a finished file tells the limiter
+type Outcome struct {
+	// Bytes is the size of the file that was processed
+	Bytes int64
+	// Failed is set for failures that hint at an overloaded filesystem, such as timeouts
+	Failed bool
+}
+
+// Limiter hands out the concurrency slots of each filesystem
+type Limiter struct {
+	Config Config
+	// device is swapped out in tests
+	device func(path string) (uint64, error)
+	mu     sync.Mutex
+	mounts map[uint64]Mount
+	groups map[uint64]*group
+}
+
+// group is the state of one filesystem
+type group struct {
+	name    string
+	limit   int
+	active  int
+	changed chan struct{}
+	tuner   *tuner
+}
+
+// NewLimiter resolves the configured mount paths to their filesystems
+func NewLimiter(config Config) (*Limiter, error) {
+	l := &Limiter{
+		Config: config,
+		device: Device,
+		mounts: make(map[uint64]Mount),
+		groups: make(map[uint64]*group),
+	}
+	for _, mount := range config.Mounts {
+		device, err := l.device(mount.Path)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving concurrency mount %s: %w", mount.Path, err)
+		}
+		l.mounts[device] = mount
+	}
+	return l, nil
+}
+
+// Acquire waits for a slot on the filesystem of every path, which need not exist yet. waiting is
+// called once if it has to wait. The slots are taken in a fixed order so jobs touching two filesystems cannot deadlock.
+func (l *Limiter) Acquire(ctx context.Context, paths []string, waiting func()) (release func(Outcome), err error) {
+	devices := make(map[uint64]string)
+	for _, path := range paths {
+		device, err := l.device(utils.ExistingDir(path))
+		if err != nil {
+			return nil, fmt.Errorf("%w: error finding the filesystem of %s: %w", ErrNoSlot, path, err)
+		}
+		if _, ok := devices[device]; !ok {
+			devices[device] = path
+		}
+	}
+	order := make([]uint64, 0, len(devices))
+	for device := range devices {
+		order = append(order, device)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+
+	var held []*group
+	releaseAll := func(outcome Outcome) {
+		for _, g := range held {
+			l.release(g, outcome)
+		}
+	}
+	notified := false
+	for _, device := range order {
+		g, err := l.acquire(ctx, device, devices[device], func() {
+			if !notified && waiting != nil {
+				waiting()
+				notified = true
+			}
+		})
+		if err != nil {
+			releaseAll(Outcome{})
+			return nil, err
+		}
+		held = append(held, g)
+	}
+	var once sync.Once
+	return func(outcome Outcome) { once.Do(func() { releaseAll(outcome) }) }, nil
+}
+
+// acquire takes a slot of a single filesystem
+func (l *Limiter) acquire(ctx context.Context, device uint64, path string, waiting func()) (*group, error) {
+	for {
+		l.mu.Lock()
+		g := l.group(device, path)
+		if g.limit == 0 || g.active < g.limit {
+			g.active++
+			l.mu.Unlock()
+			return g, nil
+		}
+		changed := g.changed
+		l.mu.Unlock()
+
+		waiting()
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: waiting for a slot on %s: %w", ErrNoSlot, g.name, ctx.Err())
+		case <-changed:
+		}
+	}
+}
+
+// group returns the state of a filesystem, creating it on first use
+func (l *Limiter) group(device uint64, path string) *group {
+	if g, ok := l.groups[device]; ok {
+		return g
+	}
+	g := &group{name: filepath.Dir(path), limit: l.Config.Default, changed: make(chan struct{})}
+	if mount, ok := l.mounts[device]; ok {
+		g.name = mount.Path
+		g.limit = mount.Limit
+	}
+	if l.Config.Adaptive {
+		if g.limit == 0 {
+			g.limit = min(2, l.Config.MaxLimit)
+		}
+		g.tuner = newTuner(time.Now())
+	}
+	log.Debug().Msgf("Concurrency limit of %s is %d", g.name, g.limit)
+	metrics.ConcurrencyLimit.Set(float64(g.limit), g.name)
+	l.groups[device] = g
+	return g
+}
+
+// release frees a slot, lets adaptive mode tune the limit and wakes the waiting jobs
+func (l *Limiter) release(g *group, outcome Outcome) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	g.active--
+	if g.tuner != nil {
+		if limit := g.tuner.observe(outcome, g.limit, l.Config.MaxLimit, time.Now()); limit != g.limit {
+			log.Info().Msgf("Adjusting concurrency on %s from %d to %d", g.name, g.limit, limit)
+			g.limit = limit
+			metrics.ConcurrencyLimit.Set(float64(limit), g.name)
+		}
+	}
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// Limit is the current limit of the filesystem holding path, 0 when it is unlimited or unused
+func (l *Limiter) Limit(path string) int {
+	device, err := l.device(utils.ExistingDir(path))
+	if err != nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if g, ok := l.groups[device]; ok {
+		return g.limit
+	}
+	return 0
+}
@@ -0,0 +1,149 @@
+package iolimit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDevices puts paths under an nfs directory on device 2 and everything else on device 1
+func fakeDevices(path string) (uint64, error) {
+	if strings.Contains(path, string(filepath.Separator)+"nfs") {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+// newTestLimiter returns a limiter and a root holding an nfs and an ssd directory
+func newTestLimiter(t *testing.T, config Config) (*Limiter, string) {
+	root := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "nfs"), 0755))
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "ssd"), 0755))
+	for i := range config.Mounts {
+		config.Mounts[i].Path = filepath.Join(root, config.Mounts[i].Path)
+	}
+	l := &Limiter{Config: config, device: fakeDevices, mounts: make(map[uint64]Mount), groups: make(map[uint64]*group)}
+	for _, mount := range config.Mounts {
+		device, err := l.device(mount.Path)
+		assert.NoError(t, err)
+		l.mounts[device] = mount
+	}
+	return l, root
+}
+
+func TestLimiter_Acquire(t *testing.T) {
+	l, root := newTestLimiter(t, Config{Default: 8, Mounts: []Mount{{Path: "nfs", Limit: 1}}, MaxLimit: 16})
+
+	first, err := l.Acquire(context.Background(), []string{filepath.Join(root, "nfs", "tv", "a.mkv")}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, l.Limit(filepath.Join(root, "nfs", "tv", "a.mkv")))
+
+	// other filesystems are not held up by the share
+	local, err := l.Acquire(context.Background(), []string{filepath.Join(root, "ssd", "tv", "b.mkv")}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, l.Limit(filepath.Join(root, "ssd")))
+	local(Outcome{})
+
+	waiting := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		release, err := l.Acquire(context.Background(), []string{filepath.Join(root, "nfs", "tv", "c.mkv")}, func() { close(waiting) })
+		if release != nil {
+			release(Outcome{})
+		}
+		done <- err
+	}()
+	<-waiting
+	first(Outcome{})
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting job was not woken up by the release")
+	}
+}
+
+func TestLimiter_AcquireCancelled(t *testing.T) {
+	l, root := newTestLimiter(t, Config{Mounts: []Mount{{Path: "nfs", Limit: 1}}, MaxLimit: 16})
+	_, err := l.Acquire(context.Background(), []string{filepath.Join(root, "nfs", "a.mkv")}, nil)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// a job writing from the local disk to the share gives its local slot back when it gives up
+	_, err = l.Acquire(ctx, []string{filepath.Join(root, "ssd", "a.mkv"), filepath.Join(root, "nfs", "out", "a.mkv")}, nil)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, ErrNoSlot)
+	assert.Equal(t, 0, l.groups[1].active)
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	l, root := newTestLimiter(t, NewConfig())
+
+	for i := 0; i < 50; i++ {
+		_, err := l.Acquire(context.Background(), []string{filepath.Join(root, "ssd", "a.mkv")}, func() { t.Fatal("unlimited filesystem made a job wait") })
+		assert.NoError(t, err)
+	}
+}
+
+func TestTuner(t *testing.T) {
+	start := time.Now()
+	tuner := newTuner(start)
+	limit := 2
+
+	// the first window only measures and probes upwards
+	for i := 0; i < 4; i++ {
+		limit = tuner.observe(Outcome{Bytes: 100}, limit, 8, start.Add(time.Second))
+	}
+	assert.Equal(t, 3, limit)
+
+	// more throughput keeps climbing
+	for i := 0; i < 6; i++ {
+		limit = tuner.observe(Outcome{Bytes: 100}, limit, 8, start.Add(2*time.Second))
+	}
+	assert.Equal(t, 4, limit)
+
+	// less throughput turns around
+	for i := 0; i < 8; i++ {
+		limit = tuner.observe(Outcome{Bytes: 10}, limit, 8, start.Add(3*time.Second))
+	}
+	assert.Equal(t, 3, limit)
+
+	// failures halve the limit
+	for i := 0; i < 6; i++ {
+		limit = tuner.observe(Outcome{Bytes: 10, Failed: i%2 == 0}, limit, 8, start.Add(4*time.Second))
+	}
+	assert.Equal(t, 1, limit)
+}
+
+func TestConfig(t *testing.T) {
+	assert.NoError(t, NewConfig().Validate())
+	assert.False(t, NewConfig().Enabled())
+	assert.Error(t, Config{Default: -1, MaxLimit: 16}.Validate())
+	assert.Error(t, Config{MaxLimit: 16, Mounts: []Mount{{Path: "nfs"}}}.Validate())
+	assert.Error(t, Config{MaxLimit: 16, Mounts: []Mount{{Limit: 2}}}.Validate())
+
+	config := Config{Default: 8, Mounts: []Mount{{Path: "nfs", Limit: 2}}, MaxLimit: 16}
+	assert.True(t, config.Enabled())
+	assert.Equal(t, 10, config.Workers())
+	config.Adaptive = true
+	assert.Equal(t, 32, config.Workers())
+}
+
+func TestDevice(t *testing.T) {
+	dir := t.TempDir()
+
+	device, err := Device(dir)
+	assert.NoError(t, err)
+	other, err := Device(dir + "/.")
+	assert.NoError(t, err)
+	assert.Equal(t, device, other)
+	_, err = Device(dir + "/missing")
+	assert.Error(t, err)
+}
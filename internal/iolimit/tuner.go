@@ -0,0 +1,60 @@
+package iolimit
+
+import "time"
+
+// windowSize is how many finished files make up one measurement, at least
+const windowSize = 4
+
+// tuner climbs towards the limit with the best throughput. After each window of finished files
+// it keeps moving the limit in the direction that raised throughput and turns around when
+// throughput dropped. A window where more than a fifth of the files failed halves the limit.
+type tuner struct {
+	started   time.Time
+	bytes     int64
+	files     int
+	failures  int
+	lastRate  float64
+	direction int
+}
+
+func newTuner(now time.Time) *tuner {
+	return &tuner{started: now, direction: 1}
+}
+
+// observe records a finished file and returns the limit to use from now on
+func (t *tuner) observe(outcome Outcome, limit int, maxLimit int, now time.Time) int {
+	t.bytes += outcome.Bytes
+	t.files++
+	if outcome.Failed {
+		t.failures++
+	}
+	if t.files < max(windowSize, 2*limit) {
+		return limit
+	}
+
+	elapsed := now.Sub(t.started).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(t.bytes) / elapsed
+	}
+	switch {
+	case t.failures*5 > t.files:
+		limit /= 2
+		t.direction = -1
+	case t.lastRate == 0:
+		limit += t.direction
+	case rate >= t.lastRate*1.05:
+		limit += t.direction
+	case rate <= t.lastRate*0.95:
+		t.direction = -t.direction
+		limit += t.direction
+	}
+	limit = min(max(limit, 1), maxLimit)
+
+	t.lastRate = rate
+	t.started = now
+	t.bytes = 0
+	t.files = 0
+	t.failures = 0
+	return limit
+}
@@ -0,0 +1,110 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry records the tags a file had before a run rewrote them
+type Entry struct {
+	RunID string            `json:"run_id"`
+	Path  string            `json:"path"`
+	Tags  map[string]string `json:"tags"`
+	// Changes is informational - undo only needs Tags
+	Changes []tracker.TagChange `json:"changes,omitempty"`
+	Time    time.Time           `json:"time"`
+}
+
+// Journal appends entries to one NDJSON file per run
+type Journal struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+// NewJournal creates a journal that keeps its files in dir
+func NewJournal(dir string) *Journal {
+	return &Journal{Dir: dir}
+}
+
+// Path returns the journal file of a run
+func (j *Journal) Path(runID string) string {
+	return filepath.Join(j.Dir, runID+".ndjson")
+}
+
+// Record appends an entry to its run's journal
+func (j *Journal) Record(entry Entry) error {
+	if entry.RunID == "" {
+		return errors.New("journal entry has no run id")
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshalling journal entry: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := os.MkdirAll(j.Dir, 0755); err != nil {
+		return fmt.Errorf("error creating journal directory %s: %w", j.Dir, err)
+	}
+	file, err := os.OpenFile(j.Path(entry.RunID), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening journal: %w", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("error writing journal: %w", err)
+	}
+	return file.Close()
+}
+
+// Entries reads back everything recorded for a run
+func (j *Journal) Entries(runID string) ([]Entry, error) {
+	file, err := os.Open(j.Path(runID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no journal found for run %s", runID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening journal: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	// tags can hold long plot summaries
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("error parsing journal line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading journal: %w", err)
+	}
+	return entries, nil
+}
+
+// TagsToStrings converts probed tags into the string map stored in the journal
+func TagsToStrings(tags map[string]interface{}) map[string]string {
+	converted := make(map[string]string, len(tags))
+	for key, value := range tags {
+		converted[key] = fmt.Sprintf("%v", value)
+	}
+	return converted
+}
@@ -0,0 +1,45 @@
+package journal
+
+import (
+	"testing"
+
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal_RecordAndEntries(t *testing.T) {
+	j := NewJournal(t.TempDir())
+
+	assert.NoError(t, j.Record(Entry{
+		RunID:   "run1",
+		Path:    "/tv/ep1.mkv",
+		Tags:    map[string]string{"title": "Old Title"},
+		Changes: []tracker.TagChange{{Key: "title", Old: "Old Title", New: "New Title"}},
+	}))
+	assert.NoError(t, j.Record(Entry{RunID: "run1", Path: "/tv/ep2.mkv", Tags: map[string]string{}}))
+	assert.NoError(t, j.Record(Entry{RunID: "run2", Path: "/tv/ep3.mkv", Tags: map[string]string{}}))
+
+	entries, err := j.Entries("run1")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "/tv/ep1.mkv", entries[0].Path)
+	assert.Equal(t, "Old Title", entries[0].Tags["title"])
+	assert.Len(t, entries[0].Changes, 1)
+	assert.False(t, entries[0].Time.IsZero())
+	assert.Equal(t, "/tv/ep2.mkv", entries[1].Path)
+
+	_, err = j.Entries("missing")
+	assert.Error(t, err)
+}
+
+func TestJournal_RecordRequiresRunID(t *testing.T) {
+	j := NewJournal(t.TempDir())
+
+	assert.Error(t, j.Record(Entry{Path: "/tv/ep1.mkv"}))
+}
+
+func TestTagsToStrings(t *testing.T) {
+	converted := TagsToStrings(map[string]interface{}{"title": "Pilot", "season": 1})
+
+	assert.Equal(t, map[string]string{"title": "Pilot", "season": "1"}, converted)
+}
@@ -0,0 +1,37 @@
+package journal
+
+import (
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/backup"
+	"github.com/bmj2728/go-vmu/internal/ffmpeg"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// Revert rewrites entry.Path with exactly the tags recorded before the run changed them.
+// The rewrite goes through the usual backup, validate and cleanup steps.
+func Revert(entry Entry, backups *backup.Store, runID string) error {
+	outputFile := utils.InsertTagToFileName(entry.Path, "govmu-edit")
+	cmd := ffmpeg.NewFFmpegCommand().
+		WithInput(entry.Path).
+		WithOutput(outputFile).
+		WithTags(entry.Tags).
+		GenerateArgs()
+
+	executor := ffmpeg.NewExecutor(cmd, nil)
+	executor.Backups = backups
+	executor.RunID = runID
+
+	if err := executor.Execute(); err != nil {
+		return fmt.Errorf("error restoring tags of %s: %w", entry.Path, err)
+	}
+	ok, err := executor.ValidateNewFile()
+	if err != nil || !ok {
+		return fmt.Errorf("error validating %s after restoring tags: %w", entry.Path, err)
+	}
+	if err := executor.Cleanup(); err != nil {
+		return fmt.Errorf("error replacing %s after restoring tags: %w", entry.Path, err)
+	}
+	log.Info().Msgf("Restored %d tags of %s", len(entry.Tags), entry.Path)
+	return nil
+}
@@ -0,0 +1,115 @@
+package mediaserver
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Supported media server types
+const (
+	TypeJellyfin = "jellyfin"
+	TypeEmby     = "emby"
+	TypePlex     = "plex"
+)
+
+// Refresh granularity - refresh the changed file itself or the folder holding it
+const (
+	GranularityItem   = "item"
+	GranularityFolder = "folder"
+)
+
+// ServerConfig describes a media server that should be told about rewritten files
+type ServerConfig struct {
+	Name        string `toml:"name"`
+	Type        string `toml:"type"`
+	URL         string `toml:"url"`
+	Token       string `toml:"token"`
+	Granularity string `toml:"granularity"`
+	// Section is the Plex library section id, defaults to all sections
+	Section string `toml:"section"`
+	// PathFrom/PathTo rewrite local paths into the paths the server sees
+	// e.g. /videos -> /data/tv when vmu runs in docker
+	PathFrom       string `toml:"path_from"`
+	PathTo         string `toml:"path_to"`
+	Retries        int    `toml:"retries"`
+	RetryDelaySecs int    `toml:"retry_delay_secs"`
+	TimeoutSecs    int    `toml:"timeout_secs"`
+}
+
+// RefreshResult records the outcome of a single refresh call
+type RefreshResult struct {
+	Server      string   `json:"server"`
+	Type        string   `json:"type"`
+	Granularity string   `json:"granularity"`
+	Targets     []string `json:"targets"`
+	Attempts    int      `json:"attempts"`
+	StatusCode  int      `json:"status_code,omitempty"`
+	Success     bool     `json:"success"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// DisplayName returns the configured name or falls back to the server type
+func (s ServerConfig) DisplayName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Type
+}
+
+// granularity returns the effective granularity - plex can only refresh folders
+func (s ServerConfig) granularity() string {
+	if strings.ToLower(s.Type) == TypePlex {
+		return GranularityFolder
+	}
+	if strings.ToLower(s.Granularity) == GranularityFolder {
+		return GranularityFolder
+	}
+	return GranularityItem
+}
+
+func (s ServerConfig) retryDelay() time.Duration {
+	if s.RetryDelaySecs <= 0 {
+		return 2 * time.Second
+	}
+	return time.Duration(s.RetryDelaySecs) * time.Second
+}
+
+func (s ServerConfig) timeout() time.Duration {
+	if s.TimeoutSecs <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.TimeoutSecs) * time.Second
+}
+
+// mapPath translates a local path into the server's view of the library
+func (s ServerConfig) mapPath(path string) string {
+	if s.PathFrom == "" {
+		return path
+	}
+	from := filepath.Clean(s.PathFrom)
+	if path != from && !strings.HasPrefix(path, from+string(filepath.Separator)) {
+		return path
+	}
+	return s.PathTo + strings.TrimPrefix(path, from)
+}
+
+// targets builds the de-duplicated, server-mapped list of paths to refresh
+func (s ServerConfig) targets(paths []string) []string {
+	seen := make(map[string]bool)
+	var targets []string
+	for _, p := range paths {
+		if s.granularity() == GranularityFolder {
+			p = filepath.Dir(p)
+		}
+		p = s.mapPath(p)
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		targets = append(targets, p)
+	}
+	sort.Strings(targets)
+	return targets
+}
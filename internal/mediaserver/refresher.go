@@ -0,0 +1,169 @@
+package mediaserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// batchSize caps the number of paths sent in a single Jellyfin/Emby update call
+const batchSize = 100
+
+// Refresher notifies the configured media servers about rewritten files
+type Refresher struct {
+	Servers []ServerConfig
+	Client  *http.Client
+}
+
+// NewRefresher creates a refresher for the given servers
+func NewRefresher(servers []ServerConfig) *Refresher {
+	return &Refresher{
+		Servers: servers,
+		Client:  &http.Client{},
+	}
+}
+
+// Refresh sends the changed paths to every configured server and returns one result per call
+func (r *Refresher) Refresh(ctx context.Context, paths []string) []*RefreshResult {
+	var results []*RefreshResult
+	if len(paths) == 0 {
+		log.Debug().Msg("No changed files, skipping media server refresh")
+		return results
+	}
+	for _, server := range r.Servers {
+		targets := server.targets(paths)
+		switch strings.ToLower(server.Type) {
+		case TypeJellyfin, TypeEmby:
+			for start := 0; start < len(targets); start += batchSize {
+				end := min(start+batchSize, len(targets))
+				results = append(results, r.refreshMediaUpdated(ctx, server, targets[start:end]))
+			}
+		case TypePlex:
+			for _, target := range targets {
+				results = append(results, r.refreshPlex(ctx, server, target))
+			}
+		default:
+			log.Error().Msgf("Unknown media server type %q for %s", server.Type, server.DisplayName())
+			results = append(results, &RefreshResult{
+				Server:  server.DisplayName(),
+				Type:    server.Type,
+				Targets: targets,
+				Error:   fmt.Sprintf("unknown media server type %q", server.Type),
+			})
+		}
+	}
+	return results
+}
+
+type mediaUpdate struct {
+	Path       string `json:"Path"`
+	UpdateType string `json:"UpdateType"`
+}
+
+type mediaUpdatedRequest struct {
+	Updates []mediaUpdate `json:"Updates"`
+}
+
+// refreshMediaUpdated uses the Jellyfin/Emby /Library/Media/Updated endpoint, which accepts files and folders
+func (r *Refresher) refreshMediaUpdated(ctx context.Context, server ServerConfig, targets []string) *RefreshResult {
+	body := mediaUpdatedRequest{}
+	for _, target := range targets {
+		body.Updates = append(body.Updates, mediaUpdate{Path: target, UpdateType: "Modified"})
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return &RefreshResult{Server: server.DisplayName(), Type: server.Type, Targets: targets, Error: err.Error()}
+	}
+	endpoint := strings.TrimRight(server.URL, "/") + "/Library/Media/Updated"
+	return r.do(ctx, server, targets, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Emby-Token", server.Token)
+		return req, nil
+	})
+}
+
+// refreshPlex triggers a partial scan of a single folder
+func (r *Refresher) refreshPlex(ctx context.Context, server ServerConfig, target string) *RefreshResult {
+	section := server.Section
+	if section == "" {
+		section = "all"
+	}
+	endpoint := fmt.Sprintf("%s/library/sections/%s/refresh?path=%s",
+		strings.TrimRight(server.URL, "/"), url.PathEscape(section), url.QueryEscape(target))
+	return r.do(ctx, server, []string{target}, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Plex-Token", server.Token)
+		return req, nil
+	})
+}
+
+// do performs the request with retries on network errors, 429s and 5xx responses
+func (r *Refresher) do(ctx context.Context, server ServerConfig, targets []string, newRequest func() (*http.Request, error)) *RefreshResult {
+	result := &RefreshResult{
+		Server:      server.DisplayName(),
+		Type:        server.Type,
+		Granularity: server.granularity(),
+		Targets:     targets,
+	}
+	attempts := max(server.Retries, 0) + 1
+	for attempt := 1; attempt <= attempts; attempt++ {
+		result.Attempts = attempt
+		retry, err := r.attempt(ctx, server, result, newRequest)
+		if err == nil {
+			result.Success = true
+			result.Error = ""
+			log.Info().Msgf("Refreshed %d path(s) on %s", len(targets), server.DisplayName())
+			return result
+		}
+		result.Error = err.Error()
+		log.Warn().Err(err).Msgf("Refresh attempt %d/%d on %s failed", attempt, attempts, server.DisplayName())
+		if !retry || attempt == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			result.Error = ctx.Err().Error()
+			return result
+		case <-time.After(server.retryDelay() * time.Duration(attempt)):
+		}
+	}
+	return result
+}
+
+// attempt runs a single request and reports whether a failure is worth retrying
+func (r *Refresher) attempt(ctx context.Context, server ServerConfig, result *RefreshResult, newRequest func() (*http.Request, error)) (bool, error) {
+	req, err := newRequest()
+	if err != nil {
+		return false, err
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, server.timeout())
+	defer cancel()
+	resp, err := r.Client.Do(req.WithContext(reqCtx))
+	if err != nil {
+		return true, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Debug().Err(err).Msg("Error closing refresh response body")
+		}
+	}()
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status from %s: %s", server.DisplayName(), resp.Status)
+}
@@ -0,0 +1,136 @@
+package mediaserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefresher_Refresh_Jellyfin(t *testing.T) {
+	var received mediaUpdatedRequest
+	var token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/Library/Media/Updated", r.URL.Path)
+		token = r.Header.Get("X-Emby-Token")
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	refresher := NewRefresher([]ServerConfig{{
+		Type:     TypeJellyfin,
+		URL:      server.URL,
+		Token:    "secret",
+		PathFrom: "/videos",
+		PathTo:   "/data/tv",
+	}})
+
+	results := refresher.Refresh(context.Background(), []string{
+		"/videos/Show/Season 1/ep1.mkv",
+		"/videos/Show/Season 1/ep2.mkv",
+	})
+
+	assert.Len(t, results, 1)
+	assert.True(t, results[0].Success)
+	assert.Equal(t, 1, results[0].Attempts)
+	assert.Equal(t, http.StatusNoContent, results[0].StatusCode)
+	assert.Equal(t, GranularityItem, results[0].Granularity)
+	assert.Equal(t, "secret", token)
+	assert.Len(t, received.Updates, 2)
+	assert.Equal(t, "/data/tv/Show/Season 1/ep1.mkv", received.Updates[0].Path)
+	assert.Equal(t, "Modified", received.Updates[0].UpdateType)
+}
+
+func TestRefresher_Refresh_PlexFolders(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "/library/sections/3/refresh", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("X-Plex-Token"))
+		paths = append(paths, r.URL.Query().Get("path"))
+	}))
+	defer server.Close()
+
+	refresher := NewRefresher([]ServerConfig{{
+		Type:        TypePlex,
+		URL:         server.URL,
+		Token:       "secret",
+		Section:     "3",
+		Granularity: GranularityItem, // plex is always folder based
+	}})
+
+	results := refresher.Refresh(context.Background(), []string{
+		"/videos/Show/Season 1/ep1.mkv",
+		"/videos/Show/Season 1/ep2.mkv",
+		"/videos/Show/Season 2/ep1.mkv",
+	})
+
+	assert.Len(t, results, 2)
+	for _, r := range results {
+		assert.True(t, r.Success)
+		assert.Equal(t, GranularityFolder, r.Granularity)
+	}
+	assert.ElementsMatch(t, []string{"/videos/Show/Season 1", "/videos/Show/Season 2"}, paths)
+}
+
+func TestRefresher_Refresh_Retries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	refresher := NewRefresher([]ServerConfig{{
+		Type:           TypeEmby,
+		URL:            server.URL,
+		Granularity:    GranularityFolder,
+		Retries:        2,
+		RetryDelaySecs: 1,
+	}})
+
+	results := refresher.Refresh(context.Background(), []string{"/videos/Show/ep1.mkv"})
+
+	assert.Len(t, results, 1)
+	assert.True(t, results[0].Success)
+	assert.Equal(t, 2, results[0].Attempts)
+	assert.Equal(t, []string{"/videos/Show"}, results[0].Targets)
+}
+
+func TestRefresher_Refresh_ClientErrorNotRetried(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	refresher := NewRefresher([]ServerConfig{{Type: TypeJellyfin, URL: server.URL, Retries: 3}})
+
+	results := refresher.Refresh(context.Background(), []string{"/videos/ep1.mkv"})
+
+	assert.Len(t, results, 1)
+	assert.False(t, results[0].Success)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusUnauthorized, results[0].StatusCode)
+	assert.Contains(t, results[0].Error, "401")
+}
+
+func TestRefresher_Refresh_NoPaths(t *testing.T) {
+	refresher := NewRefresher([]ServerConfig{{Type: TypeJellyfin, URL: "http://127.0.0.1:1"}})
+
+	results := refresher.Refresh(context.Background(), nil)
+
+	assert.Empty(t, results)
+}
@@ -2,7 +2,9 @@ package metadata
 
 import (
 	"fmt"
+	"github.com/bmj2728/go-vmu/internal/tracker"
 	"github.com/rs/zerolog/log"
+	"sort"
 	"strings"
 )
 
@@ -13,15 +15,24 @@ type Checker interface {
 type MetaChecker struct {
 	ExistingMetadata map[string]interface{}
 	CompareMetadata  map[string]interface{}
+	Policy           TagPolicy
 }
 
 func NewMetaChecker(existing map[string]interface{}, compare map[string]interface{}) *MetaChecker {
 	return &MetaChecker{
 		ExistingMetadata: existing,
 		CompareMetadata:  compare,
+		Policy:           NewTagPolicy(),
 	}
 }
 
+// WithPolicy returns a copy of the checker that also flags existing tags the policy removes
+func (m *MetaChecker) WithPolicy(policy TagPolicy) *MetaChecker {
+	checker := *m
+	checker.Policy = policy
+	return &checker
+}
+
 func (m *MetaChecker) Compare() bool {
 	//compare is new data since we want this to be the data we check each value
 	//normalize the data
@@ -40,7 +51,37 @@ func (m *MetaChecker) Compare() bool {
 			return false
 		}
 	}
+	//leftover tags the policy removes are reason enough to rewrite
+	if unwanted := m.Policy.Unwanted(m.ExistingMetadata, m.CompareMetadata); len(unwanted) > 0 {
+		log.Info().Msgf("Unwanted tags found: %s", strings.Join(unwanted, ", "))
+		return false
+	}
 	//if map processes without a false return true
 	log.Info().Msg("No inconsistencies found - skipping file")
 	return true
 }
+
+// Diff returns every tag whose existing value differs from the compare value and every
+// existing tag the policy removes, sorted by key
+func (m *MetaChecker) Diff() []tracker.TagChange {
+	normalizedExisting := make(map[string]string)
+	for k, v := range m.ExistingMetadata {
+		normalizedExisting[strings.ToUpper(k)] = fmt.Sprintf("%v", v)
+	}
+
+	changes := make([]tracker.TagChange, 0)
+	for k, v := range m.CompareMetadata {
+		newValue := fmt.Sprintf("%v", v)
+		oldValue := normalizedExisting[strings.ToUpper(k)]
+		if oldValue != newValue {
+			changes = append(changes, tracker.TagChange{Key: k, Old: oldValue, New: newValue})
+		}
+	}
+	for _, k := range m.Policy.Unwanted(m.ExistingMetadata, m.CompareMetadata) {
+		changes = append(changes, tracker.TagChange{Key: k, Old: fmt.Sprintf("%v", m.ExistingMetadata[k]), New: ""})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
@@ -0,0 +1,51 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaChecker_Compare(t *testing.T) {
+	existing := map[string]interface{}{"TITLE": "Pilot", "SEASON": "1"}
+
+	assert.True(t, NewMetaChecker(existing, map[string]interface{}{"title": "Pilot", "season": 1}).Compare())
+	assert.False(t, NewMetaChecker(existing, map[string]interface{}{"title": "Pilot", "episode": 2}).Compare())
+}
+
+func TestMetaChecker_Diff(t *testing.T) {
+	existing := map[string]interface{}{"TITLE": "Old Title", "SEASON": "1", "ENCODER": "libebml"}
+	compare := map[string]interface{}{"title": "Pilot", "season": 1, "episode": 2}
+
+	changes := NewMetaChecker(existing, compare).Diff()
+
+	assert.Equal(t, []tracker.TagChange{
+		{Key: "episode", Old: "", New: "2"},
+		{Key: "title", Old: "Old Title", New: "Pilot"},
+	}, changes)
+}
+
+func TestMetaChecker_Diff_NoChanges(t *testing.T) {
+	existing := map[string]interface{}{"title": "Pilot"}
+
+	changes := NewMetaChecker(existing, map[string]interface{}{"title": "Pilot"}).Diff()
+
+	assert.Empty(t, changes)
+}
+
+func TestMetaChecker_WithPolicy(t *testing.T) {
+	existing := map[string]interface{}{"TITLE": "Pilot", "WRITING_FRONTEND": "HandBrake"}
+	compare := map[string]interface{}{"title": "Pilot"}
+	checker := NewMetaChecker(existing, compare)
+
+	assert.True(t, checker.Compare())
+
+	strict := checker.WithPolicy(TagPolicy{Mode: TagModeMerge, Drop: []string{"writing_*"}})
+	assert.False(t, strict.Compare())
+	assert.Equal(t, []tracker.TagChange{
+		{Key: "WRITING_FRONTEND", Old: "HandBrake", New: ""},
+	}, strict.Diff())
+	// the original checker is left unchanged
+	assert.True(t, checker.Compare())
+}
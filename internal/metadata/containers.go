@@ -0,0 +1,95 @@
+package metadata
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Container describes which global tags ffmpeg can store in a container with -c copy
+type Container struct {
+	Name string
+	// AnyKey containers store arbitrary tags
+	AnyKey bool
+	// Keys are the tags stored when AnyKey is false - none means the container has no tags at all
+	Keys []string
+}
+
+// mp4Keys are the tags the mov muxer maps to iTunes atoms, anything else is silently dropped
+var mp4Keys = []string{
+	"title", "artist", "album_artist", "album", "composer", "date", "comment", "genre", "copyright",
+	"grouping", "lyrics", "description", "synopsis", "show", "episode_id", "network", "keywords",
+}
+
+// Containers is the capability matrix keyed by file extension
+var Containers = map[string]Container{
+	".mkv":  {Name: "matroska", AnyKey: true},
+	".webm": {Name: "webm", AnyKey: true},
+	".mp4":  {Name: "mp4", Keys: mp4Keys},
+	".m4v":  {Name: "mp4", Keys: mp4Keys},
+	".mov":  {Name: "mov", Keys: mp4Keys},
+	// RIFF INFO chunks
+	".avi": {Name: "avi", Keys: []string{"title", "artist", "album", "comment", "copyright", "date", "genre", "language", "track"}},
+	// ASF content description
+	".wmv":  {Name: "asf", Keys: []string{"title", "artist", "comment", "copyright", "genre"}},
+	".mpg":  {Name: "mpeg"},
+	".mpeg": {Name: "mpeg"},
+	".flv":  {Name: "flv"},
+	// the mpegts muxer only turns title into a service name, which is not read back as a tag
+	".ts":   {Name: "mpegts"},
+	".m2ts": {Name: "mpegts"},
+	// the ogg muxer keeps comments per stream only and cannot copy most OGM codecs
+	".ogm": {Name: "ogg"},
+}
+
+// ContainerFor looks up the container of a file, unknown extensions are assumed to store any tag
+func ContainerFor(path string) Container {
+	ext := strings.ToLower(filepath.Ext(path))
+	if container, ok := Containers[ext]; ok {
+		return container
+	}
+	return Container{Name: strings.TrimPrefix(ext, "."), AnyKey: true}
+}
+
+// UnsupportedContainerError reports a container that cannot store tags at all
+type UnsupportedContainerError struct {
+	Container string
+}
+
+func (e *UnsupportedContainerError) Error() string {
+	return fmt.Sprintf("%s files cannot store tags", e.Container)
+}
+
+// Supported reports whether the container can hold any tags
+func (c Container) Supported() bool {
+	return c.AnyKey || len(c.Keys) > 0
+}
+
+// Stores reports whether the container keeps a tag
+func (c Container) Stores(key string) bool {
+	if c.AnyKey {
+		return true
+	}
+	for _, k := range c.Keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter splits fields into the ones the container stores and the sorted keys it would drop
+func (c Container) Filter(fields map[string]interface{}) (map[string]interface{}, []string) {
+	kept := make(map[string]interface{}, len(fields))
+	var dropped []string
+	for k, v := range fields {
+		if c.Stores(k) {
+			kept[k] = v
+			continue
+		}
+		dropped = append(dropped, k)
+	}
+	sort.Strings(dropped)
+	return kept, dropped
+}
@@ -0,0 +1,39 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerFor(t *testing.T) {
+	assert.True(t, ContainerFor("/tv/ep1.MKV").AnyKey)
+	assert.Equal(t, "mp4", ContainerFor("/tv/ep1.m4v").Name)
+	assert.False(t, ContainerFor("/tv/ep1.mpg").Supported())
+	assert.True(t, ContainerFor("/tv/ep1.avi").Supported())
+	assert.True(t, ContainerFor("/tv/ep1.webm").AnyKey)
+	// every default extension has an entry
+	assert.Equal(t, ContainerFor("/tv/ep1.mpg"), ContainerFor("/tv/ep1.mpeg"))
+	for _, ext := range []string{".ts", ".m2ts", ".ogm"} {
+		assert.False(t, ContainerFor("/tv/ep1"+ext).Supported(), ext)
+	}
+	// unknown containers keep the old behaviour of writing everything
+	assert.True(t, ContainerFor("/tv/ep1.divx").AnyKey)
+}
+
+func TestUnsupportedContainerError(t *testing.T) {
+	var err error = &UnsupportedContainerError{Container: ContainerFor("/tv/ep1.mpg").Name}
+	assert.EqualError(t, err, "mpeg files cannot store tags")
+}
+
+func TestContainer_Filter(t *testing.T) {
+	fields := map[string]interface{}{"title": "Pilot", "genre": "Drama", "season": 1, "actor": "Someone"}
+
+	kept, dropped := ContainerFor("ep1.mp4").Filter(fields)
+	assert.Equal(t, map[string]interface{}{"title": "Pilot", "genre": "Drama"}, kept)
+	assert.Equal(t, []string{"actor", "season"}, dropped)
+
+	kept, dropped = ContainerFor("ep1.mkv").Filter(fields)
+	assert.Equal(t, fields, kept)
+	assert.Empty(t, dropped)
+}
@@ -0,0 +1,124 @@
+package metadata
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Tag modes control what happens to global tags that vmu does not write itself
+const (
+	// TagModeMerge keeps existing tags unless a drop pattern matches them
+	TagModeMerge = "merge"
+	// TagModeReplace removes existing tags unless a keep pattern matches them
+	TagModeReplace = "replace"
+)
+
+// muxerTags are written by the muxer on every remux, so they can never be removed
+// and must not trigger a rewrite on their own
+var muxerTags = []string{"ENCODER", "MAJOR_BRAND", "MINOR_VERSION", "COMPATIBLE_BRANDS"}
+
+// TagPolicy decides which existing global tags survive a rewrite. Patterns are
+// case-insensitive globs such as "writing_*". Tags written from the NFO always win.
+type TagPolicy struct {
+	Mode string `toml:"mode"`
+	// Keep is an allowlist - when set, only matching existing tags are kept in either mode
+	Keep []string `toml:"keep"`
+	// Drop is a denylist that always removes matching existing tags
+	Drop []string `toml:"drop"`
+}
+
+// NewTagPolicy returns the default policy - merge everything, like a plain ffmpeg remux
+func NewTagPolicy() TagPolicy {
+	return TagPolicy{Mode: TagModeMerge}
+}
+
+// Restricts reports whether the policy can remove tags, which requires writing the full tag set
+func (p TagPolicy) Restricts() bool {
+	return p.Mode == TagModeReplace || len(p.Keep) > 0 || len(p.Drop) > 0
+}
+
+// Validate checks the mode and patterns
+func (p TagPolicy) Validate() error {
+	switch p.Mode {
+	case "", TagModeMerge, TagModeReplace:
+	default:
+		return fmt.Errorf("unknown tag mode %q - use %q or %q", p.Mode, TagModeMerge, TagModeReplace)
+	}
+	for _, pattern := range append(append([]string{}, p.Keep...), p.Drop...) {
+		if _, err := path.Match(strings.ToUpper(pattern), ""); err != nil {
+			return fmt.Errorf("invalid tag pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Retains reports whether an existing tag survives the rewrite
+func (p TagPolicy) Retains(key string) bool {
+	if isMuxerTag(key) {
+		return true
+	}
+	if matchesAny(p.Drop, key) {
+		return false
+	}
+	if len(p.Keep) > 0 || p.Mode == TagModeReplace {
+		return matchesAny(p.Keep, key)
+	}
+	return true
+}
+
+// Unwanted returns the existing tags the policy removes, sorted by key.
+// Tags that are overwritten from the NFO are not reported.
+func (p TagPolicy) Unwanted(existing map[string]interface{}, compare map[string]interface{}) []string {
+	written := make(map[string]bool, len(compare))
+	for k := range compare {
+		written[strings.ToUpper(k)] = true
+	}
+	var unwanted []string
+	for k := range existing {
+		if written[strings.ToUpper(k)] || p.Retains(k) {
+			continue
+		}
+		unwanted = append(unwanted, k)
+	}
+	sort.Strings(unwanted)
+	return unwanted
+}
+
+// Apply returns the complete set of global tags the rewritten file should carry
+func (p TagPolicy) Apply(existing map[string]interface{}, compare map[string]interface{}) map[string]string {
+	tags := make(map[string]string, len(existing)+len(compare))
+	written := make(map[string]bool, len(compare))
+	for k, v := range compare {
+		tags[k] = fmt.Sprintf("%v", v)
+		written[strings.ToUpper(k)] = true
+	}
+	for k, v := range existing {
+		// the muxer writes its own tags, passing them on would only duplicate them
+		if written[strings.ToUpper(k)] || isMuxerTag(k) || !p.Retains(k) {
+			continue
+		}
+		tags[k] = fmt.Sprintf("%v", v)
+	}
+	return tags
+}
+
+func isMuxerTag(key string) bool {
+	for _, tag := range muxerTags {
+		if strings.EqualFold(tag, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns []string, key string) bool {
+	key = strings.ToUpper(key)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToUpper(pattern), key); ok {
+			return true
+		}
+	}
+	return false
+}
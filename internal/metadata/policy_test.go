@@ -0,0 +1,61 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagPolicy_Retains(t *testing.T) {
+	merge := TagPolicy{Mode: TagModeMerge, Drop: []string{"writing_*", "comment"}}
+	assert.True(t, merge.Retains("TITLE"))
+	assert.False(t, merge.Retains("WRITING_FRONTEND"))
+	assert.False(t, merge.Retains("Comment"))
+	// the muxer rewrites its own tags, so they are never considered removable
+	assert.True(t, merge.Retains("ENCODER"))
+
+	replace := TagPolicy{Mode: TagModeReplace, Keep: []string{"language", "handler_*"}}
+	assert.True(t, replace.Retains("LANGUAGE"))
+	assert.True(t, replace.Retains("handler_name"))
+	assert.False(t, replace.Retains("comment"))
+
+	allowlist := TagPolicy{Mode: TagModeMerge, Keep: []string{"title"}}
+	assert.True(t, allowlist.Retains("title"))
+	assert.False(t, allowlist.Retains("comment"))
+
+	assert.True(t, TagPolicy{}.Retains("anything"))
+}
+
+func TestTagPolicy_Restricts(t *testing.T) {
+	assert.False(t, TagPolicy{}.Restricts())
+	assert.False(t, NewTagPolicy().Restricts())
+	assert.True(t, TagPolicy{Mode: TagModeReplace}.Restricts())
+	assert.True(t, TagPolicy{Drop: []string{"comment"}}.Restricts())
+}
+
+func TestTagPolicy_Validate(t *testing.T) {
+	assert.NoError(t, TagPolicy{}.Validate())
+	assert.NoError(t, TagPolicy{Mode: TagModeReplace, Keep: []string{"handler_*"}}.Validate())
+	assert.Error(t, TagPolicy{Mode: "overwrite"}.Validate())
+	assert.Error(t, TagPolicy{Drop: []string{"[comment"}}.Validate())
+}
+
+func TestTagPolicy_Unwanted(t *testing.T) {
+	policy := TagPolicy{Mode: TagModeMerge, Drop: []string{"comment", "genre"}}
+	existing := map[string]interface{}{"COMMENT": "old", "GENRE": "Drama", "TITLE": "Pilot", "ENCODER": "Lavf"}
+	// genre is written from the NFO, so it is replaced rather than removed
+	compare := map[string]interface{}{"title": "Pilot", "genre": "Comedy"}
+
+	assert.Equal(t, []string{"COMMENT"}, policy.Unwanted(existing, compare))
+}
+
+func TestTagPolicy_Apply(t *testing.T) {
+	existing := map[string]interface{}{"TITLE": "Old", "COMMENT": "old", "LANGUAGE": "eng", "ENCODER": "Lavf"}
+	compare := map[string]interface{}{"title": "Pilot", "season": 1}
+
+	merged := TagPolicy{Mode: TagModeMerge, Drop: []string{"comment"}}.Apply(existing, compare)
+	assert.Equal(t, map[string]string{"title": "Pilot", "season": "1", "LANGUAGE": "eng"}, merged)
+
+	replaced := TagPolicy{Mode: TagModeReplace}.Apply(existing, compare)
+	assert.Equal(t, map[string]string{"title": "Pilot", "season": "1"}, replaced)
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import "time"
+
+var (
+	durationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+	probeBuckets    = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+)
+
+// Default is the registry used by the vmu pipeline
+var Default = NewRegistry()
+
+// Pipeline metrics
+var (
+	FilesProcessed = Default.NewCounter("vmu_files_processed_total",
+		"Files processed, by final status.", "status")
+	StageDuration = Default.NewHistogram("vmu_stage_duration_seconds",
+		"Time spent in each processing stage.", durationBuckets, "stage")
+	BytesCopied = Default.NewCounter("vmu_bytes_copied_total",
+		"Bytes copied while backing up and restoring files.")
+	FFmpegDuration = Default.NewHistogram("vmu_ffmpeg_duration_seconds",
+		"Wall time of ffmpeg invocations.", durationBuckets)
+	FFprobeDuration = Default.NewHistogram("vmu_ffprobe_duration_seconds",
+		"Wall time of ffprobe invocations.", probeBuckets)
+	Retries = Default.NewCounter("vmu_retries_total",
+		"Files that were retried after a failure.")
+	ActiveWorkers = Default.NewGauge("vmu_active_workers",
+		"Workers currently processing a file.")
+	ConcurrencyLimit = Default.NewGauge("vmu_concurrency_limit",
+		"Files processed at once on each filesystem.", "mount")
+	LastRunTimestamp = Default.NewGauge("vmu_last_run_timestamp_seconds",
+		"Unix time the last run finished.")
+)
+
+// Since returns the seconds elapsed since start, for use with Observe
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// ObserveStages records the time a file spent in each stage of an attempt
+func ObserveStages(stages map[string]time.Duration) {
+	for stage, duration := range stages {
+		StageDuration.Observe(duration.Seconds(), stage)
+	}
+}
@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveStages(t *testing.T) {
+	validateBefore := StageDuration.Count(tracker.StageValidate)
+	cleanupBefore := StageDuration.Count(tracker.StageCleanup)
+
+	ObserveStages(map[string]time.Duration{tracker.StageValidate: 2 * time.Second, tracker.StageCleanup: time.Second})
+
+	assert.Equal(t, validateBefore+1, StageDuration.Count(tracker.StageValidate))
+	assert.Equal(t, cleanupBefore+1, StageDuration.Count(tracker.StageCleanup))
+
+	// files that fail before reaching a stage have nothing to observe
+	ObserveStages(nil)
+	assert.Equal(t, validateBefore+1, StageDuration.Count(tracker.StageValidate))
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	registry := NewRegistry()
+	files := registry.NewCounter("test_files_total", "Files.", "status")
+	workers := registry.NewGauge("test_workers", "Workers.")
+	latency := registry.NewHistogram("test_latency_seconds", "Latency.", []float64{1, 0.5}, "stage")
+
+	files.Inc("Success")
+	files.Add(2, "Success")
+	files.Inc("FFmpegError")
+	workers.Inc()
+	workers.Inc()
+	workers.Dec()
+	latency.Observe(0.25, "Backup")
+	latency.Observe(0.75, "Backup")
+	latency.Observe(3, "Backup")
+
+	var buf bytes.Buffer
+	assert.NoError(t, registry.WriteText(&buf))
+
+	expected := `# HELP test_files_total Files.
+# TYPE test_files_total counter
+test_files_total{status="FFmpegError"} 1
+test_files_total{status="Success"} 3
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{stage="Backup",le="0.5"} 1
+test_latency_seconds_bucket{stage="Backup",le="1"} 2
+test_latency_seconds_bucket{stage="Backup",le="+Inf"} 3
+test_latency_seconds_sum{stage="Backup"} 4
+test_latency_seconds_count{stage="Backup"} 3
+# HELP test_workers Workers.
+# TYPE test_workers gauge
+test_workers 1
+`
+	assert.Equal(t, expected, buf.String())
+	assert.Equal(t, float64(3), files.Value("Success"))
+	assert.Equal(t, uint64(3), latency.Count("Backup"))
+}
+
+func TestRegistry_UnlabelledZeroValue(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("test_bytes_total", "Bytes.")
+
+	var buf bytes.Buffer
+	assert.NoError(t, registry.WriteText(&buf))
+
+	assert.Contains(t, buf.String(), "test_bytes_total 0\n")
+}
+
+func TestRegistry_WrongLabelCount(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("test_total", "Test.", "status")
+
+	assert.Panics(t, func() { counter.Inc() })
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewGauge("test_workers", "Workers.").Set(4)
+
+	recorder := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, recorder.Body.String(), "test_workers 4\n")
+}
+
+func TestRegistry_WriteTextfile(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("test_total", "Test.").Inc()
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "vmu.prom")
+
+	assert.NoError(t, registry.WriteTextfile(path))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "test_total 1\n")
+
+	// only the final file is left behind
+	entries, err := os.ReadDir(tmpDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -3,28 +3,36 @@ package nfo
 import "encoding/xml"
 
 type EpisodeDetails struct {
-	XMLName   xml.Name `xml:"episodedetails"`
-	Plot      string   `xml:"plot"`
-	LockData  bool     `xml:"lockdata"`
-	DateAdded string   `xml:"dateadded"`
-	Title     string   `xml:"title"`
-	Director  []string `xml:"director"`
-	Writer    string   `xml:"writer"`
-	Credits   string   `xml:"credits"`
-	Rating    float64  `xml:"rating"`
-	Year      int      `xml:"year"`
-	MPAA      string   `xml:"mpaa,omitempty"`
-	IMDBID    string   `xml:"imdbid"`
-	TVDBID    string   `xml:"tvdbid"`
-	Runtime   int      `xml:"runtime"`
-	Genre     []string `xml:"genre"`
-	Art       Art      `xml:"art"`
-	Actor     []Actor  `xml:"actor"`
-	ShowTitle string   `xml:"showtitle"`
-	Episode   int      `xml:"episode"`
-	Season    int      `xml:"season"`
-	Aired     string   `xml:"aired"`
-	FileInfo  FileInfo `xml:"fileinfo"`
+	XMLName   xml.Name  `xml:"episodedetails"`
+	Plot      string    `xml:"plot"`
+	LockData  bool      `xml:"lockdata"`
+	DateAdded string    `xml:"dateadded"`
+	Title     string    `xml:"title"`
+	Director  []string  `xml:"director"`
+	Writer    string    `xml:"writer"`
+	Credits   string    `xml:"credits"`
+	Rating    float64   `xml:"rating"`
+	Year      int       `xml:"year"`
+	MPAA      string    `xml:"mpaa,omitempty"`
+	IMDBID    string    `xml:"imdbid"`
+	TVDBID    string    `xml:"tvdbid"`
+	Runtime   int       `xml:"runtime"`
+	Genre     []string  `xml:"genre"`
+	Art       Art       `xml:"art"`
+	Actor     []Actor   `xml:"actor"`
+	ShowTitle string    `xml:"showtitle"`
+	Episode   int       `xml:"episode"`
+	Season    int       `xml:"season"`
+	Aired     string    `xml:"aired"`
+	FileInfo  FileInfo  `xml:"fileinfo"`
+	Chapters  []Chapter `xml:"chapters>chapter"`
+}
+
+// Chapter times are "HH:MM:SS.fff" or plain seconds, a missing end runs to the next chapter
+type Chapter struct {
+	Title string `xml:"title"`
+	Start string `xml:"start"`
+	End   string `xml:"end,omitempty"`
 }
 
 type Art struct {
@@ -2,6 +2,7 @@ package nfo
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/bmj2728/go-vmu/internal/utils"
 	"github.com/rs/zerolog/log"
@@ -11,10 +12,20 @@ import (
 // NFONotFoundError represents an error message when an NFO file cannot be located.
 // NFOReadError represents an error message for issues reading an NFO file.
 // NFOUnMarshallError represents an error message when unmarshalling an NFO file fails.
+// NFOTranslateError represents an error message when a parsed NFO cannot be turned into metadata.
 const (
 	NFONotFoundError   = "error locating nfo file"
 	NFOReadError       = "error reading nfo file"
 	NFOUnMarshallError = "error unmarshalling nfo file"
+	NFOTranslateError  = "error translating nfo file"
+)
+
+// The errors of this package wrap one of these, test for them with errors.Is
+var (
+	ErrNFONotFound  = errors.New(NFONotFoundError)
+	ErrNFORead      = errors.New(NFOReadError)
+	ErrNFOUnmarshal = errors.New(NFOUnMarshallError)
+	ErrNFOTranslate = errors.New(NFOTranslateError)
 )
 
 // ParseEpisodeNFO parses the given NFO file path into an EpisodeDetails struct.
@@ -26,7 +37,7 @@ func ParseEpisodeNFO(path string) (*EpisodeDetails, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		log.Error().Err(err).Msg(NFOReadError)
-		return nil, fmt.Errorf(NFOReadError+": %v", err)
+		return nil, fmt.Errorf("%w: %w", ErrNFORead, err)
 	}
 	defer func(file *os.File) {
 		err := file.Close()
@@ -39,7 +50,7 @@ func ParseEpisodeNFO(path string) (*EpisodeDetails, error) {
 	decoder := xml.NewDecoder(file)
 	if err := decoder.Decode(details); err != nil {
 		log.Error().Err(err).Msg(NFOUnMarshallError)
-		return nil, fmt.Errorf(NFOUnMarshallError+": %v", err)
+		return nil, fmt.Errorf("%w: %w", ErrNFOUnmarshal, err)
 	}
 	return details, nil
 }
@@ -52,7 +63,7 @@ func MatchEpisodeFile(path string) (string, error) {
 	//validate existence or just give up
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		log.Error().Err(err).Msg(NFONotFoundError)
-		return "", fmt.Errorf(NFONotFoundError+": %v", err)
+		return "", fmt.Errorf("%w: %w", ErrNFONotFound, err)
 	}
 	//get working directory
 	/*old
@@ -66,5 +77,9 @@ func MatchEpisodeFile(path string) (string, error) {
 	//	return "", fmt.Errorf(NFONotFoundError+": %v", err)
 	//}
 	*/
-	return utils.NFOPath(path)
+	nfoPath, err := utils.NFOPath(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrNFONotFound, err)
+	}
+	return nfoPath, nil
 }
@@ -56,7 +56,7 @@ func TestParseEpisodeNFO_InvalidFile(t *testing.T) {
 	// Assertions
 	assert.Error(t, err)
 	assert.Nil(t, details)
-	assert.Contains(t, err.Error(), NFOUnMarshallError)
+	assert.ErrorIs(t, err, ErrNFOUnmarshal)
 }
 
 func TestParseEpisodeNFO_NonExistentFile(t *testing.T) {
@@ -66,7 +66,8 @@ func TestParseEpisodeNFO_NonExistentFile(t *testing.T) {
 	// Assertions
 	assert.Error(t, err)
 	assert.Nil(t, details)
-	assert.Contains(t, err.Error(), NFOReadError)
+	assert.ErrorIs(t, err, ErrNFORead)
+	assert.ErrorIs(t, err, os.ErrNotExist)
 }
 
 func TestMatchEpisodeFile_ValidFile(t *testing.T) {
@@ -110,6 +111,7 @@ func TestMatchEpisodeFile_MissingNFO(t *testing.T) {
 	// Assertions
 	assert.Error(t, err)
 	assert.Empty(t, matchedPath)
+	assert.ErrorIs(t, err, ErrNFONotFound)
 	assert.Contains(t, err.Error(), "does not exist")
 }
 
@@ -120,5 +122,26 @@ func TestMatchEpisodeFile_NonExistentFile(t *testing.T) {
 	// Assertions
 	assert.Error(t, err)
 	assert.Empty(t, matchedPath)
-	assert.Contains(t, err.Error(), NFONotFoundError)
+	assert.ErrorIs(t, err, ErrNFONotFound)
+}
+
+func TestParseEpisodeNFO_Chapters(t *testing.T) {
+	nfoPath := filepath.Join(t.TempDir(), "episode.nfo")
+	err := os.WriteFile(nfoPath, []byte(`<?xml version="1.0" encoding="utf-8"?>
+<episodedetails>
+  <title>Pilot</title>
+  <chapters>
+    <chapter><title>Intro</title><start>00:00:00.000</start><end>00:01:00.000</end></chapter>
+    <chapter><title>Episode</title><start>60</start></chapter>
+  </chapters>
+</episodedetails>`), 0644)
+	assert.NoError(t, err)
+
+	details, err := ParseEpisodeNFO(nfoPath)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Chapter{
+		{Title: "Intro", Start: "00:00:00.000", End: "00:01:00.000"},
+		{Title: "Episode", Start: "60"},
+	}, details.Chapters)
 }
@@ -0,0 +1,79 @@
+package pool
+
+import (
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/backup"
+	"github.com/bmj2728/go-vmu/internal/chapters"
+	"github.com/bmj2728/go-vmu/internal/convert"
+	"github.com/bmj2728/go-vmu/internal/diskspace"
+	"github.com/bmj2728/go-vmu/internal/iolimit"
+	"github.com/bmj2728/go-vmu/internal/journal"
+	"github.com/bmj2728/go-vmu/internal/metadata"
+	"github.com/bmj2728/go-vmu/internal/tracks"
+	"path/filepath"
+	"strings"
+)
+
+// Sidecar modes for the output-tree mode
+const (
+	SidecarsNone     = "none"
+	SidecarsCopy     = "copy"
+	SidecarsHardlink = "hardlink"
+)
+
+// Options configures how workers process files
+type Options struct {
+	// InputRoot is the directory the run was started on, used to mirror paths into OutputDir
+	InputRoot string
+	// OutputDir switches to non-destructive mode - tagged files are written to a mirrored
+	// tree under this root and the originals are never modified
+	OutputDir string
+	// Sidecars controls whether NFO and image sidecars are copied or hardlinked into OutputDir
+	Sidecars string
+	// RunID identifies the run in backups and journals
+	RunID string
+	// Backups retains backups according to the configured policy, nil deletes them after success
+	Backups *backup.Store
+	// Journal records the tags each file had before it was rewritten so a run can be undone
+	Journal *journal.Journal
+	// TagPolicy decides which existing global tags survive a rewrite, the zero value merges everything
+	TagPolicy metadata.TagPolicy
+	// Chapters imports chapters from the NFO and chapter sidecars
+	Chapters chapters.Config
+	// Tracks muxes subtitle and audio sidecars into the container
+	Tracks tracks.Config
+	// Convert remuxes legacy containers into MKV or MP4 while tagging
+	Convert convert.Config
+	// Timeouts bound each stage and the whole file, the zero value never times out
+	Timeouts Timeouts
+	// Space holds jobs back until their backup and output fit on disk, nil skips the check
+	Space *diskspace.Reservations
+	// ScratchDir is a local directory files are copied to, remuxed and validated in before the
+	// result is pushed back, so a network share sees one read and one write per file
+	ScratchDir string
+	// Limiter caps how many files are remuxed at once per filesystem, nil leaves it to the worker count
+	Limiter *iolimit.Limiter
+}
+
+// OutputPath returns where the tagged copy of path lives in the output tree
+func (o Options) OutputPath(path string) (string, error) {
+	root := o.InputRoot
+	//several inputs share an absolute root while the files may still be relative
+	if filepath.IsAbs(root) != filepath.IsAbs(path) {
+		root, _ = filepath.Abs(root)
+		path, _ = filepath.Abs(path)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", fmt.Errorf("error mirroring %s into %s: %w", path, o.OutputDir, err)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the input root %s", path, o.InputRoot)
+	}
+	return filepath.Join(o.OutputDir, rel), nil
+}
+
+// RunScratchDir is where the jobs of this run keep their scratch copies, it is removed when the run ends
+func (o Options) RunScratchDir() string {
+	return filepath.Join(o.ScratchDir, "vmu-"+o.RunID)
+}
@@ -0,0 +1,31 @@
+package pool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions_OutputPath(t *testing.T) {
+	options := Options{InputRoot: "/videos", OutputDir: "/tagged"}
+
+	path, err := options.OutputPath("/videos/Show/Season 1/ep1.mkv")
+	assert.NoError(t, err)
+	assert.Equal(t, "/tagged/Show/Season 1/ep1.mkv", path)
+
+	_, err = options.OutputPath("/elsewhere/ep1.mkv")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "outside of the input root")
+}
+
+func TestOptions_OutputPathRelative(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	options := Options{InputRoot: wd, OutputDir: "/tagged"}
+
+	path, err := options.OutputPath(filepath.Join("Show", "ep1.mkv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/tagged/Show/ep1.mkv", path)
+}
@@ -16,6 +16,7 @@ type Pool struct {
 	Ctx             context.Context
 	CancelFunc      context.CancelFunc
 	ProgressTracker *tracker.ProgressTracker
+	Options         Options
 }
 
 // NewPool creates a new worker pool
@@ -32,6 +33,7 @@ func NewPool(workerCount int) *Pool {
 func (p *Pool) Start(tracker *tracker.ProgressTracker) {
 	for i := 0; i < p.Workers; i++ {
 		worker := NewWorker(i, p.Jobs, p.Results, &p.Wg, p.Ctx, tracker)
+		worker.Options = p.Options
 		log.Debug().Msgf("Starting worker %d", i)
 		p.Wg.Add(1)
 		go worker.Start()
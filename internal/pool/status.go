@@ -0,0 +1,55 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"github.com/bmj2728/go-vmu/internal/chapters"
+	"github.com/bmj2728/go-vmu/internal/convert"
+	"github.com/bmj2728/go-vmu/internal/diskspace"
+	"github.com/bmj2728/go-vmu/internal/ffmpeg"
+	"github.com/bmj2728/go-vmu/internal/iolimit"
+	"github.com/bmj2728/go-vmu/internal/metadata"
+	"github.com/bmj2728/go-vmu/internal/nfo"
+	"github.com/bmj2728/go-vmu/internal/retry"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/bmj2728/go-vmu/internal/validator"
+)
+
+// ErrFileNotFound is wrapped by the error of a file that cannot be read at all
+var ErrFileNotFound = errors.New("file not found")
+
+// Status derives the status of a file from the error it failed with. Running out of time and
+// filesystem or network blips win over the step the error came from, a filesystem that gave no
+// concurrency slot counts as a blip and errors of no known class are StatusUnknownError.
+func Status(err error) tracker.ProcessStatus {
+	var unsupported *metadata.UnsupportedContainerError
+	var mismatch *validator.ValidationMismatchError
+	var exit *ffmpeg.FFmpegExitError
+	switch {
+	case err == nil:
+		return tracker.StatusSuccess
+	case errors.Is(err, context.DeadlineExceeded):
+		return tracker.StatusTimeout
+	case errors.Is(err, diskspace.ErrNeverFits):
+		return tracker.StatusInsufficientSpace
+	case retry.Transient(err), errors.Is(err, iolimit.ErrNoSlot):
+		return tracker.StatusNetworkError
+	case errors.Is(err, ErrFileNotFound):
+		return tracker.StatusFileNotFound
+	case errors.Is(err, nfo.ErrNFONotFound):
+		return tracker.StatusNFONotFound
+	case errors.Is(err, nfo.ErrNFORead), errors.Is(err, nfo.ErrNFOUnmarshal), errors.Is(err, nfo.ErrNFOTranslate),
+		errors.Is(err, chapters.ErrInvalid), errors.Is(err, chapters.ErrUnreadable):
+		return tracker.StatusNFOParseError
+	case errors.As(err, &unsupported), errors.Is(err, convert.ErrCannotConvert):
+		return tracker.StatusUnsupportedContainer
+	case errors.As(err, &mismatch), errors.Is(err, ffmpeg.ErrValidation):
+		return tracker.StatusValidationError
+	case errors.Is(err, ffmpeg.ErrCleanup):
+		return tracker.StatusCleanupError
+	case errors.As(err, &exit), errors.Is(err, ffmpeg.ErrRemux):
+		return tracker.StatusFFmpegError
+	default:
+		return tracker.StatusUnknownError
+	}
+}
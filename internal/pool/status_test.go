@@ -0,0 +1,58 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/bmj2728/go-vmu/internal/chapters"
+	"github.com/bmj2728/go-vmu/internal/convert"
+	"github.com/bmj2728/go-vmu/internal/diskspace"
+	"github.com/bmj2728/go-vmu/internal/ffmpeg"
+	"github.com/bmj2728/go-vmu/internal/iolimit"
+	"github.com/bmj2728/go-vmu/internal/metadata"
+	"github.com/bmj2728/go-vmu/internal/nfo"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/bmj2728/go-vmu/internal/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		status tracker.ProcessStatus
+	}{
+		{name: "No error", err: nil, status: tracker.StatusSuccess},
+		{name: "File not found", err: fmt.Errorf("%w: %w", ErrFileNotFound, os.ErrNotExist), status: tracker.StatusFileNotFound},
+		{name: "NFO not found", err: fmt.Errorf("%w: /tv/ep1.nfo does not exist", nfo.ErrNFONotFound), status: tracker.StatusNFONotFound},
+		{name: "NFO unreadable", err: fmt.Errorf("%w: permission denied", nfo.ErrNFORead), status: tracker.StatusNFOParseError},
+		{name: "NFO broken", err: fmt.Errorf("%w: EOF", nfo.ErrNFOUnmarshal), status: tracker.StatusNFOParseError},
+		{name: "NFO untranslatable", err: fmt.Errorf("%w: invalid aired date", nfo.ErrNFOTranslate), status: tracker.StatusNFOParseError},
+		{name: "Chapters broken", err: fmt.Errorf("%w in NFO: invalid timestamp", chapters.ErrInvalid), status: tracker.StatusNFOParseError},
+		{name: "Chapters unreadable", err: fmt.Errorf("%w: error opening /tv/ep1.chapters.xml: permission denied", chapters.ErrUnreadable), status: tracker.StatusNFOParseError},
+		{name: "Chapters probe failed", err: fmt.Errorf("%w: error probing duration of /tv/ep1.mkv: %w", chapters.ErrUnreadable, errors.New("exit status 1")), status: tracker.StatusNFOParseError},
+		{name: "Unsupported container", err: &metadata.UnsupportedContainerError{Container: "mpeg"}, status: tracker.StatusUnsupportedContainer},
+		{name: "Cannot convert", err: fmt.Errorf("%w to mp4 without re-encoding", convert.ErrCannotConvert), status: tracker.StatusUnsupportedContainer},
+		{name: "ffmpeg exit", err: fmt.Errorf("%w: %w", ffmpeg.ErrRemux, &ffmpeg.FFmpegExitError{Code: 1}), status: tracker.StatusFFmpegError},
+		{name: "Remux step", err: fmt.Errorf("%w: permission denied", ffmpeg.ErrRemux), status: tracker.StatusFFmpegError},
+		{name: "Mismatch", err: &validator.ValidationMismatchError{Field: "height", Old: 1080, New: 720}, status: tracker.StatusValidationError},
+		{name: "Validation step", err: fmt.Errorf("%w: %w", ffmpeg.ErrValidation, errors.New("probe failed")), status: tracker.StatusValidationError},
+		{name: "Cleanup", err: fmt.Errorf("%w: rename failed", ffmpeg.ErrCleanup), status: tracker.StatusCleanupError},
+		{name: "Never fits", err: fmt.Errorf("%w: /tv needs 10MB", diskspace.ErrNeverFits), status: tracker.StatusInsufficientSpace},
+		{name: "Deadline wins", err: fmt.Errorf("%w: %w", ffmpeg.ErrRemux, context.DeadlineExceeded), status: tracker.StatusTimeout},
+		{name: "Blip wins", err: fmt.Errorf("%w: %w", ffmpeg.ErrCleanup, syscall.ESTALE), status: tracker.StatusNetworkError},
+		{name: "Slot wait timed out", err: fmt.Errorf("%w: waiting for a slot on /nfs: %w", iolimit.ErrNoSlot, context.DeadlineExceeded), status: tracker.StatusTimeout},
+		{name: "Slot wait cancelled", err: fmt.Errorf("%w: waiting for a slot on /nfs: %w", iolimit.ErrNoSlot, context.Canceled), status: tracker.StatusNetworkError},
+		{name: "Slot filesystem unknown", err: fmt.Errorf("%w: error finding the filesystem of /nfs/ep1.mkv: %w", iolimit.ErrNoSlot, os.ErrPermission), status: tracker.StatusNetworkError},
+		{name: "Unknown", err: errors.New("something else"), status: tracker.StatusUnknownError},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.status, Status(tc.err))
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Timeouts bound how long a file may take, zero means no limit. A stage that runs out fails the
+// file with StatusTimeout and its ffmpeg or ffprobe process is killed.
+type Timeouts struct {
+	// File is the deadline for the whole file, probing, remuxing and validating together
+	File time.Duration `toml:"file"`
+	// Probe bounds each ffprobe call before the remux
+	Probe time.Duration `toml:"probe"`
+	// FFmpeg bounds the remux, including writing chapters with mkvpropedit
+	FFmpeg time.Duration `toml:"ffmpeg"`
+	// Validation bounds probing the input and the output to compare them
+	Validation time.Duration `toml:"validate"`
+}
+
+// NewTimeouts returns the default timeouts - the remux is only bounded by the file deadline
+// because large files legitimately take a while on slow storage
+func NewTimeouts() Timeouts {
+	return Timeouts{
+		Probe:      30 * time.Second,
+		Validation: 5 * time.Minute,
+	}
+}
+
+// Validate rejects negative timeouts
+func (t Timeouts) Validate() error {
+	if t.File < 0 || t.Probe < 0 || t.FFmpeg < 0 || t.Validation < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	return nil
+}
+
+// fileContext derives the context a single file is processed under
+func (t Timeouts) fileContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if t.File > 0 {
+		return context.WithTimeout(parent, t.File)
+	}
+	return context.WithCancel(parent)
+}
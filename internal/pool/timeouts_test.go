@@ -0,0 +1,35 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeouts_Validate(t *testing.T) {
+	assert.NoError(t, NewTimeouts().Validate())
+	assert.NoError(t, Timeouts{}.Validate())
+	assert.Error(t, Timeouts{FFmpeg: -time.Second}.Validate())
+}
+
+func TestTimeouts_fileContext(t *testing.T) {
+	ctx, cancel := Timeouts{}.fileContext(context.Background())
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	cancel()
+
+	ctx, cancel = Timeouts{File: time.Minute}.fileContext(context.Background())
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	// stopping the pool ends the file too
+	parent, stop := context.WithCancel(context.Background())
+	ctx, cancel = Timeouts{File: time.Minute}.fileContext(parent)
+	defer cancel()
+	stop()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
@@ -2,16 +2,25 @@ package pool
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"github.com/bmj2728/go-vmu/internal/chapters"
+	"github.com/bmj2728/go-vmu/internal/convert"
+	"github.com/bmj2728/go-vmu/internal/diskspace"
 	"github.com/bmj2728/go-vmu/internal/ffmpeg"
+	"github.com/bmj2728/go-vmu/internal/iolimit"
+	"github.com/bmj2728/go-vmu/internal/journal"
 	"github.com/bmj2728/go-vmu/internal/metadata"
+	"github.com/bmj2728/go-vmu/internal/metrics"
 	"github.com/bmj2728/go-vmu/internal/nfo"
+	"github.com/bmj2728/go-vmu/internal/retry"
 	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/bmj2728/go-vmu/internal/tracks"
 	"github.com/bmj2728/go-vmu/internal/utils"
 	"github.com/bmj2728/go-vmu/internal/validator"
 	"github.com/rs/zerolog/log"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -24,6 +33,7 @@ type Worker struct {
 	Wg              *sync.WaitGroup
 	Ctx             context.Context
 	ProgressTracker *tracker.ProgressTracker
+	Options         Options
 }
 
 // NewWorker creates a new worker
@@ -50,7 +60,15 @@ func (w *Worker) Start() {
 				log.Debug().Msgf("Worker %d finished. Channel closed & no more jobs", w.Id)
 				return
 			}
+			//a stopped pool takes no more files
+			if w.Ctx.Err() != nil {
+				return
+			}
+			metrics.ActiveWorkers.Inc()
+			started := time.Now()
 			result := w.processFile(filePath)
+			metrics.ActiveWorkers.Dec()
+			result = result.WithWorker(w.Id).WithTimings(started, time.Since(started), w.ProgressTracker.StageTimings(filePath))
 			w.ProgressTracker.AppendResult(result) // this is universally usable by the progress tracker
 			w.Results <- result                    //what was this channel for - it's local to the worker
 			log.Debug().Msgf("Result sent to channel. Completed files: %d", len(w.Results))
@@ -66,52 +84,43 @@ func (w *Worker) Start() {
 }
 
 // processFile handles the actual file processing
-func (w *Worker) processFile(filePath string) *tracker.ProcessResult {
+func (w *Worker) processFile(filePath string) (processed *tracker.ProcessResult) {
 	result := tracker.ProcessResult{FilePath: filePath}
 	var success bool
 	var err error
 
 	log.Debug().Strs(fmt.Sprintf("Processing file %s", filePath), []string{"worker", "id", fmt.Sprintf("%d", w.Id)}).Msg("Processing file")
 
+	//every ffprobe and ffmpeg run for the file stops at the file deadline or when the pool stops
+	ctx, cancel := w.Options.Timeouts.fileContext(w.Ctx)
+	defer cancel()
+
 	//validate existence
-	_, err = os.Stat(filePath)
+	info, err := os.Stat(filePath)
 	if err != nil {
 		log.Error().Err(err).Msg("File does not exist")
-		success = false
-		if w.ProgressTracker != nil {
-			w.ProgressTracker.CompleteFile(filePath)
-		}
-		return result.WithResult(success, err).WithStatus(tracker.StatusFileNotFound)
+		return w.fail(&result, filePath, fmt.Errorf("%w: %w", ErrFileNotFound, err))
 	}
+	result.InputSize = info.Size()
 
 	//get nfo file
 	nfoPath, err := nfo.MatchEpisodeFile(filePath)
 	if err != nil {
 		log.Error().Err(err).Msg("Error matching NFO file")
-		success = false
-		if w.ProgressTracker != nil {
-			w.ProgressTracker.CompleteFile(filePath)
-		}
-		return result.WithResult(success, err).WithStatus(tracker.StatusNFONotFound)
+		return w.fail(&result, filePath, err)
 	}
 	if nfoPath == "" {
 		log.Error().Msg("NFO file not found")
-		success = false
-		if w.ProgressTracker != nil {
-			w.ProgressTracker.CompleteFile(filePath)
-		}
-		return result.WithResult(success, errors.New("NFO file not found")).WithStatus(tracker.StatusNFONotFound)
+		return w.fail(&result, filePath, nfo.ErrNFONotFound)
 	}
 
+	result.NFOPath = nfoPath
+
 	//parse nfo file
 	data, err := nfo.ParseEpisodeNFO(nfoPath)
 	if err != nil {
 		log.Error().Err(err).Msg("Error parsing NFO file")
-		success = false
-		if w.ProgressTracker != nil {
-			w.ProgressTracker.CompleteFile(filePath)
-		}
-		return result.WithResult(success, err).WithStatus(tracker.StatusNFOParseError)
+		return w.fail(&result, filePath, err)
 	}
 
 	//process into metadata
@@ -119,99 +128,289 @@ func (w *Worker) processFile(filePath string) *tracker.ProcessResult {
 	meta, err := adapter.TranslateNFO()
 	if err != nil {
 		log.Error().Err(err).Msg("Error translating NFO file")
-		success = false
-		if w.ProgressTracker != nil {
-			w.ProgressTracker.CompleteFile(filePath)
+		return w.fail(&result, filePath, fmt.Errorf("%w: %w", nfo.ErrNFOTranslate, err))
+	}
+
+	//only write and compare the keys the container can hold
+	metaMap, err := meta.ToMap()
+	if err != nil {
+		log.Error().Err(err).Msg("Error converting metadata to map")
+		return w.fail(&result, filePath, fmt.Errorf("%w: %w", nfo.ErrNFOTranslate, err))
+	}
+	//a converted file is tagged as the container it becomes
+	target, converting := w.Options.Convert.Target(filePath)
+	container := metadata.ContainerFor(target)
+	result.Container = container.Name
+	metaMap, result.DroppedKeys = container.Filter(metaMap)
+	if !container.Supported() {
+		err = &metadata.UnsupportedContainerError{Container: container.Name}
+		log.Warn().Err(err).Msgf("Skipping %s", filePath)
+		return w.fail(&result, filePath, err)
+	}
+	if len(result.DroppedKeys) > 0 {
+		log.Debug().Msgf("%s cannot store %s", container.Name, strings.Join(result.DroppedKeys, ", "))
+	}
+
+	//non-destructive mode writes to a mirrored tree and compares against the copy there
+	destination := ""
+	probeTarget := filePath
+	if converting {
+		destination = target
+	}
+	if w.Options.OutputDir != "" {
+		destination, err = w.Options.OutputPath(target)
+		if err != nil {
+			log.Error().Err(err).Msg("Error resolving output path")
+			return w.fail(&result, filePath, err)
 		}
-		return result.WithResult(success, err).WithStatus(tracker.StatusNFOParseError)
+		probeTarget = destination
 	}
 
 	//use media prober to access ffprobe data
-	checker := validator.NewMediaProber(30 * time.Second)
-	err = checker.Probe(filePath)
-	if err != nil {
-		log.Error().Err(err).Msg("Error probing file")
+	checker := validator.NewMediaProberContext(ctx, w.Options.Timeouts.Probe)
+	if _, statErr := os.Stat(probeTarget); statErr == nil {
+		err = checker.Probe(probeTarget)
+		if err != nil {
+			log.Error().Err(err).Msg("Error probing file")
+		}
+	} else {
+		log.Debug().Msgf("No existing output at %s", probeTarget)
 	}
+	//the conversion has to be a plain remux and must not overwrite anything
+	if converting {
+		err = w.checkConversion(ctx, filePath, checker, destination)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Not converting %s", filePath)
+			return w.fail(&result, filePath, err)
+		}
+	}
+
 	//grab the existing tags
 	existingTags, err := checker.Tags()
 	if err != nil {
 		log.Debug().Str("prober", filePath).Msg("No existing tags found")
 	}
-	//make it easier to compare the data
-	metaMap, err := meta.ToMap()
-	if err != nil {
-		log.Error().Err(err).Msg("Error converting metadata to map")
-	}
 	//create a checker and compare
-	metaChecker := metadata.NewMetaChecker(existingTags, metaMap)
+	metaChecker := metadata.NewMetaChecker(existingTags, metaMap).WithPolicy(w.Options.TagPolicy)
 	metaMatch := metaChecker.Compare()
 	log.Debug().Msgf("Metadata match: %v", metaMatch)
+
+	//chapters from the nfo or sidecar files replace the existing ones
+	var chapterList []chapters.Chapter
+	if w.Options.Chapters.Enabled {
+		chapterList, err = w.findChapters(ctx, filePath, data, checker)
+		if err != nil {
+			log.Error().Err(err).Msg("Error reading chapters")
+			return w.fail(&result, filePath, err)
+		}
+	}
+	var existingChapters []chapters.Chapter
+	if checker.Data != nil {
+		existingChapters = chapters.FromProbe(checker.Data.Chapters)
+	}
+	chaptersMatch := chapterList == nil || chapters.Equal(chapterList, existingChapters)
+	log.Debug().Msgf("Chapters match: %v", chaptersMatch)
+
+	//subtitle and audio sidecars that are not in the container yet
+	var pendingTracks []tracks.Track
+	inputStreams := 0
+	if w.Options.Tracks.Enabled {
+		pendingTracks, inputStreams, err = w.findTracks(ctx, filePath, checker, destination)
+		if err != nil {
+			log.Error().Err(err).Msg("Error finding sidecar tracks")
+			return w.fail(&result, filePath, fmt.Errorf("%w: %w", ffmpeg.ErrRemux, err))
+		}
+	}
+
+	//in output-dir mode the output may already hold the tracks the original still lacks
+	tracksMatch := len(pendingTracks) == 0 || (checker.Data != nil && len(tracks.Pending(pendingTracks, checker.Data.Streams)) == 0)
+	log.Debug().Msgf("Tracks match: %v", tracksMatch)
+
 	//if we match we're done and onto the next thing
-	if metaMatch {
+	if metaMatch && chaptersMatch && tracksMatch && (!converting || w.Options.OutputDir != "") {
 		log.Debug().Msg("Existing tags match, skipping")
 		success = true
 		if w.ProgressTracker != nil {
 			w.ProgressTracker.CompleteFile(filePath)
 		}
-		return result.WithResult(success, err).WithStatus(tracker.StatusSkipped)
+		return result.WithResult(success, nil).WithStatus(tracker.StatusSkipped)
+	}
+	result.Changes = metaChecker.Diff()
+	result.TagsBefore = stringTags(existingTags)
+	if !chaptersMatch {
+		result.Changes = append(result.Changes, tracker.TagChange{
+			Key: "chapters",
+			Old: fmt.Sprintf("%d chapters", len(existingChapters)),
+			New: fmt.Sprintf("%d chapters", len(chapterList)),
+		})
+	}
+	for _, track := range pendingTracks {
+		result.Changes = append(result.Changes, tracker.TagChange{Key: track.Kind + " track", New: filepath.Base(track.Path)})
+	}
+	if converting {
+		result.Changes = append(result.Changes, tracker.TagChange{Key: "container", Old: filepath.Ext(filePath), New: filepath.Ext(target)})
+	}
+
+	//the remux waits for a slot on the filesystems it reads from and writes to
+	if w.Options.Limiter != nil {
+		release, err := w.acquireSlot(ctx, filePath, destination)
+		if err != nil {
+			log.Error().Err(err).Msgf("Not processing %s", filePath)
+			return w.fail(&result, filePath, err)
+		}
+		defer func() { release(slotOutcome(info.Size(), processed)) }()
+	}
+
+	//hold the job until its backup and new file fit next to what the other workers reserved
+	if w.Options.Space != nil {
+		release, err := w.reserveSpace(ctx, filePath, destination, converting, pendingTracks)
+		if err != nil {
+			log.Error().Err(err).Msgf("Not processing %s", filePath)
+			return w.fail(&result, filePath, err)
+		}
+		defer release()
 	}
 
 	//create ffmpeg command
 	outputFile := utils.InsertTagToFileName(filePath, "govmu-edit")
-	cmd, err := ffmpeg.NewFFmpegCommand().WithInput(filePath).WithOutput(outputFile).WithMetadata(*meta)
-	if err != nil {
-		log.Error().Err(err).Msg("Error creating ffmpeg command")
-		success = false
-		if w.ProgressTracker != nil {
-			w.ProgressTracker.CompleteFile(filePath)
+	if destination != "" {
+		outputFile = utils.InsertTagToFileName(destination, "govmu-edit")
+		if err = os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+			log.Error().Err(err).Msg("Error creating output directory")
+			return w.fail(&result, filePath, fmt.Errorf("%w: %w", ffmpeg.ErrRemux, err))
+		}
+	}
+	//in scratch mode ffmpeg and the validator only touch local copies
+	input := filePath
+	if w.Options.ScratchDir != "" {
+		jobDir, staged, err := w.stageInput(filePath)
+		if err != nil {
+			log.Error().Err(err).Msg("Error copying file to scratch directory")
+			return w.fail(&result, filePath, fmt.Errorf("%w: %w", ffmpeg.ErrRemux, err))
 		}
-		return result.WithResult(success, err).WithStatus(tracker.StatusFFmpegError)
+		defer func() {
+			if err := os.RemoveAll(jobDir); err != nil {
+				log.Warn().Err(err).Msgf("Error removing scratch directory %s", jobDir)
+			}
+		}()
+		input = staged
+		outputFile = filepath.Join(jobDir, filepath.Base(outputFile))
+		if destination == "" {
+			destination = filePath
+		}
+	}
+	cmd := w.buildCommand(ctx, input, outputFile, metaMap, checker, destination)
+	//mkvpropedit only handles matroska, everything else gets the chapters through ffmpeg
+	chapterWriter := w.Options.Chapters.Writer
+	if chapterWriter == chapters.WriterMkvpropedit && !strings.EqualFold(filepath.Ext(outputFile), ".mkv") {
+		chapterWriter = chapters.WriterFFMetadata
+	}
+	if chapterList != nil && chapterWriter != chapters.WriterMkvpropedit {
+		chapterFile := outputFile + ".ffmetadata"
+		err = chapters.WriteFFMetadata(chapterFile, chapterList)
+		if err != nil {
+			log.Error().Err(err).Msg("Error writing chapter file")
+			return w.fail(&result, filePath, fmt.Errorf("%w: %w", ffmpeg.ErrRemux, err))
+		}
+		defer func() {
+			if err := os.Remove(chapterFile); err != nil {
+				log.Debug().Err(err).Msgf("Error removing chapter file %s", chapterFile)
+			}
+		}()
+		cmd = cmd.WithChapters(chapterFile)
+	}
+	if len(pendingTracks) > 0 {
+		cmd = cmd.WithTracks(pendingTracks, inputStreams)
+	}
+	if converting {
+		cmd = cmd.WithConversion()
 	}
 	cmd = cmd.GenerateArgs()
 	log.Debug().Msgf("FFmpeg command: %v", cmd)
+	result.TagsWritten = cmd.Tags()
 
 	//create executor
 	executor := ffmpeg.NewExecutor(cmd, w.ProgressTracker)
+	executor.Destination = destination
+	executor.Backups = w.Options.Backups
+	executor.RunID = w.Options.RunID
+	executor.Chapters = chapterList
+	executor.ChapterWriter = chapterWriter
+	executor.Tracks = pendingTracks
+	executor.RemoveInput = converting && w.Options.OutputDir == ""
+	executor.Original = filePath
+	if w.ProgressTracker != nil {
+		executor.Duration = w.inputDuration(ctx, filePath, checker)
+	}
+	executor.Context = ctx
+	executor.Timeout = w.Options.Timeouts.FFmpeg
+	executor.ValidateTimeout = w.Options.Timeouts.Validation
 
 	//execute
 	err = executor.Execute()
+	if code, ran := executor.ExitCode(); ran {
+		result.FFmpegExitCode = &code
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Error executing ffmpeg command")
-		success = false
-		if w.ProgressTracker != nil {
-			w.ProgressTracker.CompleteFile(filePath)
-		}
-		return result.WithResult(success, err).WithStatus(tracker.StatusFFmpegError)
+		return w.fail(&result, filePath, err)
 	}
 
 	//validate
 	ok, err := executor.ValidateNewFile()
 	if err != nil {
 		log.Error().Err(err).Msg("Error validating new file")
-		success = false
-		if w.ProgressTracker != nil {
-			w.ProgressTracker.CompleteFile(filePath)
-		}
-		return result.WithResult(success, err).WithStatus(tracker.StatusValidationError)
+		return w.fail(&result, filePath, err)
 	}
 	if !ok {
 		log.Error().Msg("New file is invalid")
-		success = false
-		if w.ProgressTracker != nil {
-			w.ProgressTracker.CompleteFile(filePath)
-		}
-		return result.WithResult(success, err).WithStatus(tracker.StatusValidationError)
+		return w.fail(&result, filePath, fmt.Errorf("%w: new file is invalid", ffmpeg.ErrValidation))
 	}
 
 	//cleanup
 	err = executor.Cleanup()
 	if err != nil {
 		log.Error().Err(err).Msg("Error cleaning up")
-		success = false
-		if w.ProgressTracker != nil {
-			w.ProgressTracker.CompleteFile(filePath)
+		return w.fail(&result, filePath, err)
+	}
+
+	//remember the old tags so the run can be undone - only when the file existed and was probed
+	written := filePath
+	if destination != "" {
+		written = destination
+	}
+	result.OutputPath = written
+	if writtenInfo, statErr := os.Stat(written); statErr == nil {
+		result.OutputSize = writtenInfo.Size()
+	}
+	if w.Options.Journal != nil && checker.Data != nil {
+		w.recordJournal(written, existingTags, result.Changes)
+	}
+
+	//the nfo and artwork follow a converted file
+	if converting && w.Options.OutputDir == "" {
+		w.renameSidecars(filePath, destination)
+	}
+
+	//move muxed sidecars aside so the library does not show them twice - never in output-dir mode
+	if w.Options.OutputDir == "" && w.Options.Tracks.ArchiveDir != "" {
+		for _, track := range pendingTracks {
+			archived, archiveErr := tracks.Archive(track, w.Options.InputRoot, w.Options.Tracks.ArchiveDir)
+			if archiveErr != nil {
+				log.Warn().Err(archiveErr).Msgf("Error archiving muxed sidecar %s", track.Path)
+				continue
+			}
+			log.Debug().Msgf("Archived muxed sidecar %s to %s", track.Path, archived)
+		}
+	}
+
+	//bring the nfo and artwork along to the output tree
+	if w.Options.OutputDir != "" && w.Options.Sidecars != "" && w.Options.Sidecars != SidecarsNone {
+		err = w.mirrorSidecars(filePath, destination)
+		if err != nil {
+			log.Error().Err(err).Msg("Error mirroring sidecar files")
+			return w.fail(&result, filePath, fmt.Errorf("%w: %w", ffmpeg.ErrCleanup, err))
 		}
-		return result.WithResult(success, err).WithStatus(tracker.StatusCleanupError)
 	}
 
 	success = true
@@ -225,3 +424,293 @@ func (w *Worker) processFile(filePath string) *tracker.ProcessResult {
 	//share results
 	return result.WithResult(success, err).WithStatus(tracker.StatusSuccess)
 }
+
+// fail ends filePath with err, the status is derived from the error
+func (w *Worker) fail(result *tracker.ProcessResult, filePath string, err error) *tracker.ProcessResult {
+	if w.ProgressTracker != nil {
+		w.ProgressTracker.CompleteFile(filePath)
+	}
+	return result.WithResult(false, err).WithStatus(Status(err))
+}
+
+// stringTags turns probed tags into plain strings, nil when there are none
+func stringTags(tags map[string]interface{}) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	strs := make(map[string]string, len(tags))
+	for key, value := range tags {
+		strs[key] = fmt.Sprintf("%v", value)
+	}
+	return strs
+}
+
+// buildCommand merges the new tags into the input's tags, or writes the complete tag set when
+// the tag policy removes tags. A failed probe falls back to merging so tags are never lost blindly.
+func (w *Worker) buildCommand(ctx context.Context, filePath string, outputFile string, metaMap map[string]interface{}, checker *validator.MediaProber, destination string) *ffmpeg.FFmpegCommand {
+	cmd := ffmpeg.NewFFmpegCommand().WithInput(filePath).WithOutput(outputFile)
+	if !w.Options.TagPolicy.Restricts() {
+		return cmd.WithMetadataFields(metaMap)
+	}
+
+	//the tags carried over come from the input, which is not what was probed in output-dir mode
+	source := checker
+	if destination != "" {
+		source = validator.NewMediaProberContext(ctx, w.Options.Timeouts.Probe)
+		if err := source.Probe(filePath); err != nil {
+			log.Error().Err(err).Msg("Error probing input file")
+		}
+	}
+	if source.Data == nil {
+		log.Warn().Msgf("Tags of %s unknown, merging instead of applying the tag policy", filePath)
+		return cmd.WithMetadataFields(metaMap)
+	}
+	sourceTags, err := source.Tags()
+	if err != nil {
+		log.Debug().Str("prober", filePath).Msg("No existing tags found")
+	}
+	return cmd.WithTags(w.Options.TagPolicy.Apply(sourceTags, metaMap))
+}
+
+// inputDuration is what ffmpeg's progress is measured against. The probe that already ran is
+// reused, an existing copy in the output tree has the same duration as the input.
+func (w *Worker) inputDuration(ctx context.Context, filePath string, checker *validator.MediaProber) time.Duration {
+	prober := checker
+	if prober.Data == nil || prober.Data.Format == nil {
+		prober = validator.NewMediaProberContext(ctx, w.Options.Timeouts.Probe)
+		if err := prober.Probe(filePath); err != nil || prober.Data.Format == nil {
+			log.Debug().Err(err).Msg("Error probing duration for progress")
+			return 0
+		}
+	}
+	return prober.Data.Format.Duration()
+}
+
+// findChapters looks up the chapters for filePath, using the probed duration to close the last chapter
+func (w *Worker) findChapters(ctx context.Context, filePath string, episode *nfo.EpisodeDetails, checker *validator.MediaProber) ([]chapters.Chapter, error) {
+	prober := checker
+	if prober.Data == nil {
+		prober = validator.NewMediaProberContext(ctx, w.Options.Timeouts.Probe)
+		if err := prober.Probe(filePath); err != nil {
+			return nil, fmt.Errorf("%w: error probing duration of %s: %w", chapters.ErrUnreadable, filePath, err)
+		}
+	}
+	var duration time.Duration
+	if prober.Data != nil && prober.Data.Format != nil {
+		duration = prober.Data.Format.Duration()
+	}
+	chapterList, source, err := chapters.Find(filePath, episode, duration)
+	if err != nil {
+		return nil, err
+	}
+	if chapterList != nil {
+		log.Debug().Msgf("Found %d chapters in %s", len(chapterList), source)
+	}
+	return chapterList, nil
+}
+
+// findTracks returns the sidecars that still need muxing and the stream count of the input.
+// Tracks are compared against the file ffmpeg reads, the original in output-dir mode, so a
+// regenerated output keeps every sidecar.
+func (w *Worker) findTracks(ctx context.Context, filePath string, checker *validator.MediaProber, destination string) ([]tracks.Track, int, error) {
+	found, err := tracks.Find(filePath)
+	if err != nil || len(found) == 0 {
+		return nil, 0, err
+	}
+
+	//the container the tracks are muxed into
+	output := filePath
+	if destination != "" {
+		output = destination
+	}
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".mkv":
+	case ".mp4", ".m4v", ".mov":
+		//mp4 cannot hold bitmap subtitles
+		supported := found[:0]
+		for _, track := range found {
+			if track.ImageBased() {
+				log.Warn().Msgf("Skipping %s, image subtitles cannot be muxed into %s", track.Path, filePath)
+				continue
+			}
+			supported = append(supported, track)
+		}
+		found = supported
+	default:
+		log.Warn().Msgf("Skipping %d sidecar tracks, muxing into %s is not supported", len(found), filePath)
+		return nil, 0, nil
+	}
+
+	input := checker
+	if destination != "" || input.Data == nil {
+		input = validator.NewMediaProberContext(ctx, w.Options.Timeouts.Probe)
+		if err := input.Probe(filePath); err != nil {
+			return nil, 0, fmt.Errorf("error probing %s for its streams: %w", filePath, err)
+		}
+	}
+	pending := tracks.Pending(found, input.Data.Streams)
+	if len(pending) == 0 {
+		return nil, 0, nil
+	}
+	return pending, len(input.Data.Streams), nil
+}
+
+// stageInput copies filePath into a directory of its own under the run's scratch directory
+func (w *Worker) stageInput(filePath string) (string, string, error) {
+	if w.ProgressTracker != nil {
+		w.ProgressTracker.UpdateStage(filePath, tracker.StageScratch)
+	}
+	if err := os.MkdirAll(w.Options.RunScratchDir(), 0700); err != nil {
+		return "", "", fmt.Errorf("error creating scratch directory: %w", err)
+	}
+	jobDir, err := os.MkdirTemp(w.Options.RunScratchDir(), "job-*")
+	if err != nil {
+		return "", "", fmt.Errorf("error creating scratch directory: %w", err)
+	}
+	staged := filepath.Join(jobDir, filepath.Base(filePath))
+	copied, err := utils.CopyFile(filePath, staged)
+	metrics.BytesCopied.Add(float64(copied))
+	if err != nil {
+		_ = os.RemoveAll(jobDir)
+		return "", "", fmt.Errorf("error copying %s to scratch: %w", filePath, err)
+	}
+	log.Debug().Msgf("Copied %s to %s", filePath, staged)
+	return jobDir, staged, nil
+}
+
+// acquireSlot waits until the filesystems of the input and of the destination have room for
+// another remux
+func (w *Worker) acquireSlot(ctx context.Context, filePath string, destination string) (func(iolimit.Outcome), error) {
+	paths := []string{filePath}
+	if destination != "" {
+		paths = append(paths, destination)
+	}
+	return w.Options.Limiter.Acquire(ctx, paths, func() {
+		log.Debug().Msgf("Waiting for a concurrency slot to process %s", filePath)
+		if w.ProgressTracker != nil {
+			w.ProgressTracker.UpdateStage(filePath, tracker.StageWaitSlot)
+		}
+	})
+}
+
+// slotOutcome tells adaptive concurrency how much was moved and whether the filesystem struggled
+func slotOutcome(size int64, result *tracker.ProcessResult) iolimit.Outcome {
+	return iolimit.Outcome{Bytes: size, Failed: !result.Success && retry.Transient(result.Error)}
+}
+
+// reserveSpace waits until the files the remux writes fit: the new file, which may gain sidecar
+// tracks, a backup copy of the input when it is replaced or retired into the backup store, and
+// the scratch copies
+func (w *Worker) reserveSpace(ctx context.Context, filePath string, destination string, converting bool, pendingTracks []tracks.Track) (func(), error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(info.Size())
+	output := size
+	for _, track := range pendingTracks {
+		if trackInfo, err := os.Stat(track.Path); err == nil {
+			output += uint64(trackInfo.Size())
+		}
+	}
+	written := filePath
+	if destination != "" {
+		written = destination
+	}
+	needs := []diskspace.Need{{Dir: filepath.Dir(written), Bytes: output}}
+	backedUp := destination == "" || (converting && w.Options.OutputDir == "" && w.Options.Backups != nil)
+	//a scratch copy stands in for the backup unless the store keeps one
+	if w.Options.ScratchDir != "" {
+		needs = append(needs, diskspace.Need{Dir: w.Options.ScratchDir, Bytes: size + output})
+		backedUp = w.Options.OutputDir == "" && w.Options.Backups != nil
+	}
+	if backedUp {
+		backupDir := filepath.Dir(filePath)
+		if w.Options.Backups != nil {
+			backupDir = filepath.Dir(w.Options.Backups.Path(filePath, w.Options.RunID))
+		}
+		needs = append(needs, diskspace.Need{Dir: backupDir, Bytes: size})
+	}
+	return w.Options.Space.Reserve(ctx, needs, func() {
+		log.Info().Msgf("Waiting for disk space to process %s", filePath)
+		if w.ProgressTracker != nil {
+			w.ProgressTracker.UpdateStage(filePath, tracker.StageWaitSpace)
+		}
+	})
+}
+
+// recordJournal writes the pre-change tags of path, a failure only costs the ability to undo
+func (w *Worker) recordJournal(path string, tags map[string]interface{}, changes []tracker.TagChange) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	err = w.Options.Journal.Record(journal.Entry{
+		RunID:   w.Options.RunID,
+		Path:    abs,
+		Tags:    journal.TagsToStrings(tags),
+		Changes: changes,
+	})
+	if err != nil {
+		log.Warn().Err(err).Msgf("Error recording old tags of %s, undo will not cover it", path)
+	}
+}
+
+// mirrorSidecars copies or hardlinks the sidecars of filePath next to destination
+func (w *Worker) mirrorSidecars(filePath string, destination string) error {
+	sidecars, err := utils.SidecarFiles(filePath)
+	if err != nil {
+		return err
+	}
+	for _, sidecar := range sidecars {
+		target := utils.SidecarName(sidecar, filePath, destination)
+		log.Debug().Msgf("Mirroring sidecar %s to %s", sidecar, target)
+		if w.Options.Sidecars == SidecarsHardlink {
+			err = utils.LinkOrCopyFile(sidecar, target)
+		} else {
+			_, err = utils.CopyFile(sidecar, target)
+		}
+		if err != nil {
+			return fmt.Errorf("error mirroring sidecar %s: %w", sidecar, err)
+		}
+	}
+	return nil
+}
+
+// checkConversion makes sure filePath can be remuxed into destination without re-encoding.
+// The input is probed again unless the checker already holds it.
+func (w *Worker) checkConversion(ctx context.Context, filePath string, checker *validator.MediaProber, destination string) error {
+	if w.Options.OutputDir == "" {
+		if _, err := os.Stat(destination); err == nil {
+			return fmt.Errorf("%w %s, %s already exists", convert.ErrCannotConvert, filePath, destination)
+		}
+	}
+	input := checker
+	if w.Options.OutputDir != "" || input.Data == nil {
+		input = validator.NewMediaProberContext(ctx, w.Options.Timeouts.Probe)
+		if err := input.Probe(filePath); err != nil {
+			return fmt.Errorf("%w %s, error probing its codecs: %w", convert.ErrCannotConvert, filePath, err)
+		}
+	}
+	return convert.Check(input.Data.Streams, w.Options.Convert.To)
+}
+
+// renameSidecars moves the sidecars of a converted file to the names of the new file,
+// the video is already converted so a failure is only logged
+func (w *Worker) renameSidecars(filePath string, converted string) {
+	sidecars, err := utils.SidecarFiles(filePath)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Error finding sidecars of %s", filePath)
+		return
+	}
+	for _, sidecar := range sidecars {
+		target := utils.SidecarName(sidecar, filePath, converted)
+		if target == sidecar {
+			continue
+		}
+		log.Debug().Msgf("Renaming sidecar %s to %s", sidecar, target)
+		if err := os.Rename(sidecar, target); err != nil {
+			log.Warn().Err(err).Msgf("Error renaming sidecar %s", sidecar)
+		}
+	}
+}
@@ -8,8 +8,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bmj2728/go-vmu/internal/convert"
+	"github.com/bmj2728/go-vmu/internal/diskspace"
+	"github.com/bmj2728/go-vmu/internal/metadata"
 	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/bmj2728/go-vmu/internal/tracks"
+	"github.com/bmj2728/go-vmu/internal/validator"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/vansante/go-ffprobe.v2"
 )
 
 func TestNewWorker(t *testing.T) {
@@ -158,9 +164,173 @@ func TestWorker_Start(t *testing.T) {
 		// Verify the result
 		assert.Equal(t, "/non/existent/file.mkv", result.FilePath)
 		assert.False(t, result.Success)
-		assert.Error(t, result.Error)
+		assert.ErrorIs(t, result.Error, ErrFileNotFound)
+		assert.Equal(t, "FileNotFound", result.Status.String())
+		assert.Equal(t, 1, result.WorkerID)
+		assert.False(t, result.Started.IsZero())
+		assert.Positive(t, result.Duration)
 
 		// Wait for the worker to finish
 		wg.Wait()
 	})
 }
+
+func TestWorker_processFile_UnsupportedContainer(t *testing.T) {
+	tmpDir := t.TempDir()
+	video := filepath.Join(tmpDir, "episode.mpg")
+	assert.NoError(t, os.WriteFile(video, []byte("not really mpeg"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "episode.nfo"), []byte(`<episodedetails><title>Pilot</title><season>1</season></episodedetails>`), 0644))
+
+	worker := NewWorker(1, nil, nil, nil, context.Background(), nil)
+	result := worker.processFile(video)
+
+	assert.Equal(t, tracker.StatusUnsupportedContainer, result.Status)
+	assert.False(t, result.Success)
+	assert.Equal(t, "mpeg", result.Container)
+	var unsupported *metadata.UnsupportedContainerError
+	assert.ErrorAs(t, result.Error, &unsupported)
+	assert.Contains(t, result.DroppedKeys, "title")
+	assert.Equal(t, filepath.Join(tmpDir, "episode.nfo"), result.NFOPath)
+	assert.Equal(t, int64(len("not really mpeg")), result.InputSize)
+	assert.Nil(t, result.FFmpegExitCode)
+}
+
+func TestStringTags(t *testing.T) {
+	assert.Nil(t, stringTags(nil))
+	assert.Equal(t, map[string]string{"title": "Pilot", "track": "3"}, stringTags(map[string]interface{}{"title": "Pilot", "track": 3}))
+}
+
+func TestWorker_processFile_ConvertTargetExists(t *testing.T) {
+	tmpDir := t.TempDir()
+	video := filepath.Join(tmpDir, "episode.mpg")
+	assert.NoError(t, os.WriteFile(video, []byte("not really mpeg"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "episode.mkv"), []byte("already converted"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "episode.nfo"), []byte(`<episodedetails><title>Pilot</title><season>1</season></episodedetails>`), 0644))
+
+	worker := NewWorker(1, nil, nil, nil, context.Background(), nil)
+	worker.Options.Convert = convert.Config{To: convert.FormatMKV}
+	result := worker.processFile(video)
+
+	// the target container is reported and nothing is overwritten
+	assert.Equal(t, tracker.StatusUnsupportedContainer, result.Status)
+	assert.False(t, result.Success)
+	assert.Equal(t, "matroska", result.Container)
+	assert.Empty(t, result.DroppedKeys)
+	assert.ErrorContains(t, result.Error, "already exists")
+	assert.ErrorIs(t, result.Error, convert.ErrCannotConvert)
+	content, err := os.ReadFile(video)
+	assert.NoError(t, err)
+	assert.Equal(t, "not really mpeg", string(content))
+}
+
+func TestWorker_reserveSpace(t *testing.T) {
+	tmpDir := t.TempDir()
+	video := filepath.Join(tmpDir, "episode.mkv")
+	assert.NoError(t, os.WriteFile(video, make([]byte, 1000), 0644))
+	subtitle := filepath.Join(tmpDir, "episode.en.srt")
+	assert.NoError(t, os.WriteFile(subtitle, make([]byte, 100), 0644))
+
+	worker := NewWorker(1, nil, nil, nil, context.Background(), nil)
+	worker.Options.Space = diskspace.NewReservations(diskspace.Config{Check: true})
+
+	// replacing the input needs its backup and the new file with the muxed track
+	release, err := worker.reserveSpace(context.Background(), video, "", false, []tracks.Track{{Path: subtitle}})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2100), worker.Options.Space.Reserved(tmpDir))
+	release()
+
+	// writing to an output tree leaves the input alone
+	release, err = worker.reserveSpace(context.Background(), video, filepath.Join(tmpDir, "out", "episode.mkv"), false, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1000), worker.Options.Space.Reserved(tmpDir))
+	release()
+}
+
+func TestWorker_reserveSpace_NeverFits(t *testing.T) {
+	tmpDir := t.TempDir()
+	video := filepath.Join(tmpDir, "episode.mkv")
+	assert.NoError(t, os.WriteFile(video, make([]byte, 1000), 0644))
+
+	worker := NewWorker(1, nil, nil, nil, context.Background(), nil)
+	worker.Options.Space = diskspace.NewReservations(diskspace.Config{Check: true, MinFreeMB: 1 << 40})
+
+	_, err := worker.reserveSpace(context.Background(), video, "", false, nil)
+
+	assert.ErrorIs(t, err, diskspace.ErrNeverFits)
+}
+
+func TestWorker_stageInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	video := filepath.Join(tmpDir, "library", "episode.mkv")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(video), 0755))
+	assert.NoError(t, os.WriteFile(video, []byte("original"), 0644))
+
+	worker := NewWorker(1, nil, nil, nil, context.Background(), nil)
+	worker.Options.ScratchDir = filepath.Join(tmpDir, "scratch")
+	worker.Options.RunID = "run-1"
+
+	jobDir, staged, err := worker.stageInput(video)
+	assert.NoError(t, err)
+	// every job gets a directory of its own under the run
+	assert.Equal(t, filepath.Join(tmpDir, "scratch", "vmu-run-1"), filepath.Dir(jobDir))
+	assert.Equal(t, filepath.Join(jobDir, "episode.mkv"), staged)
+	content, err := os.ReadFile(staged)
+	assert.NoError(t, err)
+	assert.Equal(t, "original", string(content))
+
+	other, _, err := worker.stageInput(video)
+	assert.NoError(t, err)
+	assert.NotEqual(t, jobDir, other)
+}
+
+func TestWorker_reserveSpace_Scratch(t *testing.T) {
+	tmpDir := t.TempDir()
+	video := filepath.Join(tmpDir, "episode.mkv")
+	assert.NoError(t, os.WriteFile(video, make([]byte, 1000), 0644))
+
+	worker := NewWorker(1, nil, nil, nil, context.Background(), nil)
+	worker.Options.ScratchDir = tmpDir
+	worker.Options.Space = diskspace.NewReservations(diskspace.Config{Check: true})
+
+	// the scratch copies and the pushed file, the original needs no backup
+	release, err := worker.reserveSpace(context.Background(), video, "", false, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3000), worker.Options.Space.Reserved(tmpDir))
+	release()
+}
+
+// fakeFFprobe puts an ffprobe on PATH that reports output for every file
+func fakeFFprobe(t *testing.T, output string) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho '" + output + "'\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "ffprobe"), []byte(script), 0755))
+	t.Setenv("PATH", bin)
+}
+
+func TestWorker_findTracks_OutputDirRerun(t *testing.T) {
+	// the original never gains the sidecar, only the output does
+	fakeFFprobe(t, `{"streams": [{"index": 0, "codec_type": "video", "codec_name": "h264"}], "format": {"duration": "60.0"}}`)
+	tmpDir := t.TempDir()
+	video := filepath.Join(tmpDir, "episode.mkv")
+	assert.NoError(t, os.WriteFile(video, []byte("original"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "episode.en.srt"), []byte("1\n"), 0644))
+	destination := filepath.Join(t.TempDir(), "episode.mkv")
+
+	worker := NewWorker(1, nil, nil, nil, context.Background(), nil)
+	worker.Options.OutputDir = filepath.Dir(destination)
+	checker := validator.NewMediaProberContext(context.Background(), 0)
+	checker.Data = &ffprobe.ProbeData{Streams: []*ffprobe.Stream{
+		{Index: 0, CodecType: "video", CodecName: "h264"},
+		{Index: 1, CodecType: "subtitle", CodecName: "subrip", TagList: ffprobe.Tags{"language": "eng"}},
+	}}
+
+	pending, inputStreams, err := worker.findTracks(context.Background(), video, checker, destination)
+
+	// a regenerated output is remuxed from the original and needs the sidecar again
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, filepath.Join(tmpDir, "episode.en.srt"), pending[0].Path)
+	assert.Equal(t, 1, inputStreams)
+	// while the existing output already holds it
+	assert.Empty(t, tracks.Pending(pending, checker.Data.Streams))
+}
@@ -1,80 +1,254 @@
 package processor
 
 import (
+	"errors"
+	"github.com/bmj2728/go-vmu/internal/discovery"
+	"github.com/bmj2728/go-vmu/internal/metrics"
 	"github.com/bmj2728/go-vmu/internal/pool"
+	"github.com/bmj2728/go-vmu/internal/retry"
 	"github.com/bmj2728/go-vmu/internal/tracker"
 	"github.com/bmj2728/go-vmu/internal/utils"
 	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
+// ErrStopped is returned with the results gathered so far when Stop ends a run early
+var ErrStopped = errors.New("run stopped")
+
 type Processor struct {
 	Pool            *pool.Pool
 	ProgressTracker *tracker.ProgressTracker
+	// Listeners are attached to every progress tracker the processor creates
+	Listeners []tracker.Listener
+	// Reporter shows the progress of every run, nil draws a progress bar
+	Reporter tracker.Reporter
+	// OnResult is called with the final result of every file as it arrives, attempts that are
+	// retried are left out
+	OnResult func(*tracker.ProcessResult)
+	// Options are handed to every pool the processor creates
+	Options pool.Options
+	// Retry decides which failures are attempted again and how long to wait in between
+	Retry retry.Policy
+	// Discovery decides which files under the directory are processed
+	Discovery discovery.Config
+	// Excluded lists the paths the filters left out of the last run
+	Excluded []discovery.Exclusion
+	// mu guards Pool against Stop, which is called from other goroutines
+	mu sync.Mutex
 }
 
 func NewProcessor(workers int) *Processor {
 	return &Processor{
-		Pool: pool.NewPool(workers),
+		Pool:      pool.NewPool(workers),
+		Options:   pool.Options{Timeouts: pool.NewTimeouts()},
+		Retry:     retry.NewPolicy(),
+		Discovery: discovery.NewConfig(),
 	}
 }
 
+// Stop cancels the running files, which kill ffmpeg and revert their input, and starts no more.
+// The run returns ErrStopped once the running files have ended.
+func (p *Processor) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Pool.Stop()
+}
+
 func (p *Processor) ProcessDirectory(dir string, retries int) ([]*tracker.ProcessResult, error) {
-	//account for the initial run
-	retries = retries + 1
+	return p.ProcessPaths([]string{dir}, retries)
+}
 
+// ProcessPaths processes every video under the given directories along with the individual files.
+// Files are taken as they are, only directories go through the discovery filters.
+func (p *Processor) ProcessPaths(paths []string, retries int) ([]*tracker.ProcessResult, error) {
 	//get an initial jobs list
 	log.Debug().Msg("Getting jobs")
-	files, jobs, err := utils.GetFiles(dir)
+	discoverer, err := discovery.NewDiscoverer(p.Discovery)
 	if err != nil {
-		log.Error().Err(err).Msg("Error getting files")
 		return nil, err
 	}
-	log.Debug().Msgf("Got %d files", jobs)
-
-	//create a variable to hold successes during later loops
-	var trackedResults []*tracker.ProcessResult
-
-	for retries > 0 {
-		p.ProgressTracker = tracker.NewProgressTracker(jobs)
+	var files []string
+	seen := make(map[string]bool)
+	p.Excluded = nil
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Error().Err(err).Msg("Error getting files")
+			return nil, err
+		}
+		found := []string{path}
+		if info.IsDir() {
+			found, err = discoverer.Find(path)
+			if err != nil {
+				log.Error().Err(err).Msg("Error getting files")
+				return nil, err
+			}
+			p.Excluded = append(p.Excluded, discoverer.Excluded...)
+		}
+		//overlapping inputs must not process a file twice
+		for _, file := range found {
+			key := filepath.Clean(file)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			files = append(files, file)
+		}
+	}
+	log.Debug().Msgf("Got %d files, excluded %d paths", len(files), len(p.Excluded))
 
-		// add jobs to pool to avoid closing channel before submissions complete
-		p.Pool.SubmitJobs(files)
+	//mirror paths relative to the common parent of the inputs unless told otherwise
+	if p.Options.InputRoot == "" {
+		p.Options.InputRoot = CommonRoot(paths)
+	}
+	return p.process(files, retries)
+}
 
-		// start workers
-		log.Debug().Msg("Starting workers")
-		p.Pool.Start(p.ProgressTracker)
+// process runs files through the pool. A failure the retry policy allows is resubmitted on its own
+// after a backoff while the other files carry on, up to retries times per file.
+func (p *Processor) process(files []string, retries int) ([]*tracker.ProcessResult, error) {
+	if p.Options.RunID == "" {
+		p.Options.RunID = utils.NewRunID()
+	}
+	log.Info().Msgf("Run ID: %s", p.Options.RunID)
+	//scratch copies never outlive the run
+	if p.Options.ScratchDir != "" {
+		defer func() {
+			if err := os.RemoveAll(p.Options.RunScratchDir()); err != nil {
+				log.Warn().Err(err).Msgf("Error removing scratch directory %s", p.Options.RunScratchDir())
+			}
+		}()
+	}
 
-		// wait for all workers to finish
-		results := p.Pool.Wait()
-		// end process directory
-		log.Debug().Msgf("Ending process directory - %v", results)
+	reporter := p.Reporter
+	if reporter == nil {
+		reporter = tracker.NewBarReporter()
+	}
+	p.ProgressTracker = tracker.NewProgressTrackerWithReporter(len(files), reporter)
+	for _, listener := range p.Listeners {
+		p.ProgressTracker.AddListener(listener)
+	}
+	p.Pool.Options = p.Options
 
-		successes, failures := utils.SplitResults(p.ProgressTracker.Results)
+	// add jobs to pool to avoid closing channel before submissions complete
+	p.Pool.SubmitJobs(files)
 
-		//add successes to global tracker
-		trackedResults = append(trackedResults, successes...)
+	// start workers
+	log.Debug().Msg("Starting workers")
+	p.Pool.Start(p.ProgressTracker)
 
-		log.Debug().Msgf("Failures: %d", len(failures))
-		log.Debug().Msgf("Retries Remaining: %d", retries)
+	//every file ends with exactly one final result, retried attempts are only counted
+	var trackedResults []*tracker.ProcessResult
+	attempts := make(map[string]int, len(files))
+	pending := len(files)
+	//retries waiting for their backoff, a stopped run cancels them
+	var retryTimers []*time.Timer
+	var retryWg sync.WaitGroup
+	stopped := false
+	for pending > 0 && !stopped {
+		var result *tracker.ProcessResult
+		select {
+		case result = <-p.Pool.Results:
+		case <-p.Pool.Ctx.Done():
+			stopped = true
+			continue
+		}
+		//every attempt counts towards the stage timings, retried or not
+		metrics.ObserveStages(result.Stages)
+		retried := attempts[result.FilePath]
+		result = result.WithRetries(retried)
+		if retried < retries && p.Retry.ShouldRetry(result) {
+			attempts[result.FilePath] = retried + 1
+			delay := p.Retry.Delay(retried + 1)
+			log.Warn().Err(result.Error).Msgf("%s failed with %s, retry %d of %d in %s", result.FilePath, result.Status, retried+1, retries, delay.Round(time.Millisecond))
+			metrics.Retries.Inc()
+			p.ProgressTracker.Requeue()
+			filePath := result.FilePath
+			retryWg.Add(1)
+			retryTimers = append(retryTimers, time.AfterFunc(delay, func() {
+				defer retryWg.Done()
+				if p.Pool.Ctx.Err() == nil {
+					p.Pool.Submit(filePath)
+				}
+			}))
+			continue
+		}
+		trackedResults = append(trackedResults, result)
+		pending--
+		if p.OnResult != nil {
+			p.OnResult(result)
+		}
+	}
 
-		//wipe files
-		files = []string{}
+	if stopped {
+		for _, timer := range retryTimers {
+			if timer.Stop() {
+				retryWg.Done()
+			}
+		}
+		retryWg.Wait()
+	}
 
-		for _, failure := range failures {
-			files = append(files, failure.FilePath)
+	// wait for all workers to finish, a stopped run still reports the files that were running
+	for _, result := range p.Pool.Wait() {
+		if !stopped {
+			continue
 		}
-		jobs = len(files)
-		//we now have new jobs count and files to process
-		//Recreate the pool - copying worker setting
-		p.Pool = pool.NewPool(p.Pool.Workers)
-		retries-- //decrement retry counter
-		if retries == 0 {
-			trackedResults = append(trackedResults, failures...)
-			break
+		metrics.ObserveStages(result.Stages)
+		result = result.WithRetries(attempts[result.FilePath])
+		trackedResults = append(trackedResults, result)
+		if p.OnResult != nil {
+			p.OnResult(result)
 		}
-		//end of the loop?
 	}
+	p.ProgressTracker.Finish()
+	log.Debug().Msgf("Ending run with %d results", len(trackedResults))
+	//a processor can be reused, the next run gets a fresh pool with the same worker count
+	p.mu.Lock()
+	p.Pool = pool.NewPool(p.Pool.Workers)
+	p.mu.Unlock()
+
+	for _, result := range trackedResults {
+		metrics.FilesProcessed.Inc(result.Status.String())
+	}
+	metrics.LastRunTimestamp.Set(float64(time.Now().Unix()))
 
-	//now
+	if stopped {
+		return trackedResults, ErrStopped
+	}
 	return trackedResults, nil
 }
+
+// CommonRoot returns the deepest directory containing every path, files count as their directory.
+// A single directory is returned as given, several inputs give an absolute path.
+func CommonRoot(paths []string) string {
+	if len(paths) == 1 {
+		if info, err := os.Stat(paths[0]); err == nil && info.IsDir() {
+			return paths[0]
+		}
+	}
+	root := ""
+	for _, path := range paths {
+		dir := path
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			dir = filepath.Dir(path)
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		if root == "" {
+			root = dir
+			continue
+		}
+		for root != filepath.Dir(root) {
+			if utils.InDir(root, dir) {
+				break
+			}
+			root = filepath.Dir(root)
+		}
+	}
+	return root
+}
@@ -4,8 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/bmj2728/go-vmu/internal/pool"
+	"github.com/bmj2728/go-vmu/internal/retry"
+	"github.com/bmj2728/go-vmu/internal/tracker"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -46,7 +49,7 @@ func TestProcessor_ProcessDirectory(t *testing.T) {
 	// Test with an empty directory
 	t.Run("Empty directory", func(t *testing.T) {
 		processor := NewProcessor(1)
-		results, err := processor.ProcessDirectory(tmpDir)
+		results, err := processor.ProcessDirectory(tmpDir, 0)
 
 		assert.NoError(t, err)
 		assert.Empty(t, results)
@@ -60,7 +63,7 @@ func TestProcessor_ProcessDirectory(t *testing.T) {
 		assert.NoError(t, err)
 
 		processor := NewProcessor(1)
-		results, err := processor.ProcessDirectory(tmpDir)
+		results, err := processor.ProcessDirectory(tmpDir, 0)
 
 		assert.NoError(t, err)
 		assert.Len(t, results, 1)
@@ -72,7 +75,7 @@ func TestProcessor_ProcessDirectory(t *testing.T) {
 	// Test with a non-existent directory
 	t.Run("Non-existent directory", func(t *testing.T) {
 		processor := NewProcessor(1)
-		results, err := processor.ProcessDirectory("/non/existent/directory")
+		results, err := processor.ProcessDirectory("/non/existent/directory", 0)
 
 		assert.Error(t, err)
 		assert.Nil(t, results)
@@ -95,3 +98,99 @@ func TestProcessor_Integration(t *testing.T) {
 	assert.Equal(t, mockPool, processor.Pool)
 	assert.Equal(t, 2, processor.Pool.Workers)
 }
+
+func TestProcessor_ProcessPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	showA := filepath.Join(tmpDir, "Show A")
+	showB := filepath.Join(tmpDir, "Show B")
+	assert.NoError(t, os.MkdirAll(showA, 0755))
+	assert.NoError(t, os.MkdirAll(showB, 0755))
+	epA := filepath.Join(showA, "ep1.mkv")
+	epB := filepath.Join(showB, "ep1.mkv")
+	assert.NoError(t, os.WriteFile(epA, []byte("test data"), 0644))
+	assert.NoError(t, os.WriteFile(epB, []byte("test data"), 0644))
+
+	// a file that is also inside a listed directory is processed once
+	processor := NewProcessor(1)
+	results, err := processor.ProcessPaths([]string{showA, epA, epB}, 0)
+
+	assert.NoError(t, err)
+	var paths []string
+	for _, result := range results {
+		paths = append(paths, result.FilePath)
+	}
+	assert.ElementsMatch(t, []string{epA, epB}, paths)
+	assert.Equal(t, tmpDir, processor.Options.InputRoot)
+
+	_, err = NewProcessor(1).ProcessPaths([]string{showA, filepath.Join(tmpDir, "missing.mkv")}, 0)
+	assert.Error(t, err)
+}
+
+func TestCommonRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	season := filepath.Join(tmpDir, "Show", "Season 1")
+	assert.NoError(t, os.MkdirAll(season, 0755))
+	episode := filepath.Join(season, "ep1.mkv")
+	assert.NoError(t, os.WriteFile(episode, []byte("x"), 0644))
+
+	assert.Equal(t, season, CommonRoot([]string{season}))
+	assert.Equal(t, season, CommonRoot([]string{episode}))
+	assert.Equal(t, filepath.Join(tmpDir, "Show"), CommonRoot([]string{episode, filepath.Join(tmpDir, "Show")}))
+	assert.Equal(t, tmpDir, CommonRoot([]string{season, filepath.Join(tmpDir, "Other", "ep2.mkv")}))
+}
+
+func TestProcessor_Retries(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.mkv")
+	assert.NoError(t, os.WriteFile(testFile, []byte("test data"), 0644))
+
+	// a missing NFO is permanent, retrying cannot help
+	processor := NewProcessor(1)
+	results, err := processor.ProcessDirectory(tmpDir, 3)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, tracker.StatusNFONotFound, results[0].Status)
+		assert.Zero(t, results[0].Retries)
+	}
+
+	// unless the policy says otherwise - each file gets exactly one final result
+	processor = NewProcessor(2)
+	processor.Retry = retry.Policy{BaseDelay: time.Millisecond, Rules: map[string]string{"NFONotFound": retry.ModeAlways}}
+	results, err = processor.ProcessDirectory(tmpDir, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, tracker.StatusNFONotFound, results[0].Status)
+		assert.Equal(t, 2, results[0].Retries)
+	}
+}
+
+func TestProcessor_Stop(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"ep1.mkv", "ep2.mkv", "ep3.mkv"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte("test data"), 0644))
+	}
+
+	// the first finished file stops the run while its retry waits for a backoff that never ends
+	processor := NewProcessor(1)
+	processor.Retry = retry.Policy{BaseDelay: time.Hour, Rules: map[string]string{"NFONotFound": retry.ModeAlways}}
+	processor.Listeners = append(processor.Listeners, func(event tracker.Event) {
+		if event.Type == tracker.EventFileFinished {
+			processor.Stop()
+		}
+	})
+	done := make(chan struct{})
+	var results []*tracker.ProcessResult
+	var err error
+	go func() {
+		defer close(done)
+		results, err = processor.ProcessDirectory(tmpDir, 3)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stopped run did not return")
+	}
+	assert.ErrorIs(t, err, ErrStopped)
+	assert.LessOrEqual(t, len(results), 1)
+}
@@ -0,0 +1,384 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Save writes the report in every format to dir and returns the files written. A format that
+// fails does not stop the others.
+func (r *Report) Save(dir string, formats []string) ([]string, error) {
+	var written []string
+	var errs []string
+	for _, format := range formats {
+		files, err := r.save(dir, format)
+		written = append(written, files...)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return written, fmt.Errorf("error saving reports: %s", strings.Join(errs, "; "))
+	}
+	return written, nil
+}
+
+// save writes a single format
+func (r *Report) save(dir string, format string) ([]string, error) {
+	if format == FormatJSON {
+		results := filepath.Join(dir, r.FileName("results.json"))
+		if err := utils.SaveResults(results, r.Results); err != nil {
+			return nil, err
+		}
+		failures := filepath.Join(dir, r.FileName("failures.json"))
+		if err := utils.SaveFailures(failures, r.Results); err != nil {
+			return []string{results}, err
+		}
+		if r.Refreshes == nil {
+			return []string{results, failures}, nil
+		}
+		refresh := filepath.Join(dir, r.FileName("refresh.json"))
+		if err := utils.SaveRefreshResults(refresh, r.Refreshes); err != nil {
+			return []string{results, failures}, err
+		}
+		return []string{results, failures, refresh}, nil
+	}
+
+	//the line-based formats keep the refresh calls in a file of their own
+	files := map[string]func(io.Writer) error{}
+	switch format {
+	case FormatCSV:
+		files["results.csv"] = r.WriteCSV
+		if r.Refreshes != nil {
+			files["refresh.csv"] = r.WriteRefreshCSV
+		}
+	case FormatNDJSON:
+		files["results.ndjson"] = r.WriteNDJSON
+		if r.Refreshes != nil {
+			files["refresh.ndjson"] = r.WriteRefreshNDJSON
+		}
+	case FormatMarkdown:
+		files["report.md"] = r.WriteMarkdown
+	case FormatHTML:
+		files["report.html"] = r.WriteHTML
+	case FormatJUnit:
+		files["junit.xml"] = r.WriteJUnit
+	default:
+		return nil, fmt.Errorf("unknown report format %q", format)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var written []string
+	for _, name := range names {
+		path := filepath.Join(dir, r.FileName(name))
+		if err := writeFile(path, files[name]); err != nil {
+			return written, fmt.Errorf("failed to write %s report: %w", format, err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// writeFile creates path and writes it with write
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// WriteCSV writes a row per file
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"file", "show", "status", "success", "retries", "error", "changes", "container", "dropped_keys",
+		"nfo", "attempts", "worker", "started", "duration_seconds", "input_size", "output_size", "ffmpeg_exit_code"})
+	for _, result := range r.Results {
+		human := result.MakeHumanReadable()
+		_ = writer.Write([]string{
+			human.FilePath,
+			Show(human.FilePath),
+			human.Status,
+			strconv.FormatBool(human.Success),
+			strconv.Itoa(human.Retries),
+			human.Error,
+			strconv.Itoa(len(human.Changes)),
+			human.Container,
+			strings.Join(human.DroppedKeys, ";"),
+			human.NFOPath,
+			strconv.Itoa(human.Attempts),
+			strconv.Itoa(human.WorkerID),
+			formatTime(human.Started),
+			strconv.FormatFloat(human.DurationSeconds, 'f', 3, 64),
+			strconv.FormatInt(human.InputSize, 10),
+			strconv.FormatInt(human.OutputSize, 10),
+			formatExitCode(human.FFmpegExitCode),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteRefreshCSV writes a row per media server refresh call
+func (r *Report) WriteRefreshCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"server", "type", "granularity", "targets", "attempts", "status_code", "success", "error"})
+	for _, refresh := range r.Refreshes {
+		_ = writer.Write([]string{
+			refresh.Server,
+			refresh.Type,
+			refresh.Granularity,
+			strings.Join(refresh.Targets, ";"),
+			strconv.Itoa(refresh.Attempts),
+			strconv.Itoa(refresh.StatusCode),
+			strconv.FormatBool(refresh.Success),
+			refresh.Error,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatTime leaves unknown times empty
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// formatExitCode leaves the exit code empty when ffmpeg did not run
+func formatExitCode(code *int) string {
+	if code == nil {
+		return ""
+	}
+	return strconv.Itoa(*code)
+}
+
+// WriteNDJSON writes a JSON object per file and line, as in results.json
+func (r *Report) WriteNDJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, result := range r.Results {
+		if err := encoder.Encode(result.MakeHumanReadable()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteRefreshNDJSON writes a JSON object per media server refresh call and line, as in refresh.json
+func (r *Report) WriteRefreshNDJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, refresh := range r.Refreshes {
+		if err := encoder.Encode(refresh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownReport is the Markdown report, the summaries first and then every failure
+var markdownReport = template.Must(template.New("markdown").Funcs(template.FuncMap{"cell": markdownCell}).Parse(
+	`# vmu run {{.RunID}}
+
+{{.Time.Format "2006-01-02 15:04:05 MST"}} - {{len .Results}} files, {{.Succeeded}} succeeded, {{len .Failures}} failed
+
+## By status
+
+| Status | Files |
+|--------|-------|
+{{range .Statuses}}| {{.Status}} | {{.Count}} |
+{{end}}
+## By show
+
+| Show | Files | Succeeded | Failed |
+|------|-------|-----------|--------|
+{{range .Shows}}| {{cell .Show}} | {{.Total}} | {{.Succeeded}} | {{.Failed}} |
+{{end}}{{with .Failures}}
+## Failures
+
+| File | Status | Error |
+|------|--------|-------|
+{{range .}}| {{cell .FilePath}} | {{.Status}} | {{if .Error}}{{cell .Error.Error}}{{end}} |
+{{end}}{{end}}{{with .Refreshes}}
+## Media server refreshes
+
+{{len .}} calls, {{$.FailedRefreshes}} failed
+
+| Server | Targets | Attempts | Result |
+|--------|---------|----------|--------|
+{{range .}}| {{cell .Server}} | {{len .Targets}} | {{.Attempts}} | {{if .Success}}OK{{else}}{{cell .Error}}{{end}} |
+{{end}}{{end}}`))
+
+// markdownCell keeps a value from breaking out of its table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// WriteMarkdown writes the summaries and failures as Markdown tables
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	return markdownReport.Execute(w, r)
+}
+
+// htmlReport is the HTML version of the Markdown report
+var htmlReport = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>vmu run {{.RunID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.failed { color: #b00; }
+</style>
+</head>
+<body>
+<h1>vmu run {{.RunID}}</h1>
+<p>{{.Time.Format "2006-01-02 15:04:05 MST"}} - {{len .Results}} files, {{.Succeeded}} succeeded, {{len .Failures}} failed</p>
+<h2>By status</h2>
+<table>
+<tr><th>Status</th><th>Files</th></tr>
+{{range .Statuses}}<tr><td>{{.Status}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+<h2>By show</h2>
+<table>
+<tr><th>Show</th><th>Files</th><th>Succeeded</th><th>Failed</th></tr>
+{{range .Shows}}<tr><td>{{.Show}}</td><td>{{.Total}}</td><td>{{.Succeeded}}</td><td{{if .Failed}} class="failed"{{end}}>{{.Failed}}</td></tr>
+{{end}}</table>
+{{with .Failures}}<h2>Failures</h2>
+<table>
+<tr><th>File</th><th>Status</th><th>Error</th></tr>
+{{range .}}<tr><td>{{.FilePath}}</td><td class="failed">{{.Status}}</td><td>{{if .Error}}{{.Error.Error}}{{end}}</td></tr>
+{{end}}</table>
+{{end}}{{with .Refreshes}}<h2>Media server refreshes</h2>
+<p>{{len .}} calls, {{$.FailedRefreshes}} failed</p>
+<table>
+<tr><th>Server</th><th>Targets</th><th>Attempts</th><th>Result</th></tr>
+{{range .}}<tr><td>{{.Server}}</td><td>{{len .Targets}}</td><td>{{.Attempts}}</td>{{if .Success}}<td>OK</td>{{else}}<td class="failed">{{.Error}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes the summaries and failures as a standalone HTML page
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlReport.Execute(w, r)
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes a test suite per show with a test case per file. Skipped files and containers
+// that cannot hold tags are reported as skipped, every other unsuccessful file as failed. The media
+// server refresh calls follow as a suite of their own.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suites := junitSuites{Name: "vmu run " + r.RunID}
+	index := make(map[string]int)
+	for _, result := range r.Results {
+		show := Show(result.FilePath)
+		i, ok := index[show]
+		if !ok {
+			i = len(suites.Suites)
+			index[show] = i
+			suites.Suites = append(suites.Suites, junitSuite{Name: show, Timestamp: r.Time.Format("2006-01-02T15:04:05")})
+		}
+		suite := &suites.Suites[i]
+		testCase := junitCase{Name: filepath.Base(result.FilePath), ClassName: show, Time: result.Duration.Seconds()}
+		message := junitMessage{Message: result.Status.String()}
+		if result.Error != nil {
+			message.Text = result.Error.Error()
+		}
+		switch {
+		case result.Status == tracker.StatusSkipped || result.Status == tracker.StatusUnsupportedContainer:
+			testCase.Skipped = &message
+			suite.Skipped++
+		case !result.Success:
+			message.Type = result.Status.String()
+			testCase.Failure = &message
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Time += testCase.Time
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	if len(r.Refreshes) > 0 {
+		suite := junitSuite{Name: "Media server refreshes", Tests: len(r.Refreshes), Timestamp: r.Time.Format("2006-01-02T15:04:05")}
+		for _, refresh := range r.Refreshes {
+			testCase := junitCase{Name: refresh.Server, ClassName: refresh.Type}
+			if !refresh.Success {
+				testCase.Failure = &junitMessage{Message: "refresh failed", Text: refresh.Error}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		suites.Suites = append(suites.Suites, suite)
+	}
+	for _, suite := range suites.Suites {
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
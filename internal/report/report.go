@@ -0,0 +1,208 @@
+package report
+
+import (
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/mediaserver"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report formats
+const (
+	// FormatJSON writes results.json and failures.json, the files --from-results reads
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatNDJSON   = "ndjson"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatJUnit    = "junit"
+)
+
+// Formats lists every format in the order reports are written
+var Formats = []string{FormatJSON, FormatCSV, FormatNDJSON, FormatMarkdown, FormatHTML, FormatJUnit}
+
+// How report files are named
+const (
+	// NamingFixed overwrites the files of the previous run, e.g. results.json
+	NamingFixed = "fixed"
+	// NamingTimestamp adds the time of the run, e.g. results-20250102-150405.json
+	NamingTimestamp = "timestamp"
+	// NamingRunID adds the run ID, e.g. results-<run id>.json
+	NamingRunID = "run-id"
+)
+
+// Config decides which reports --save writes and how they are named
+type Config struct {
+	Formats []string `toml:"formats"`
+	Naming  string   `toml:"naming"`
+}
+
+// NewConfig returns the default report config - results.json and failures.json as before
+func NewConfig() Config {
+	return Config{
+		Formats: []string{FormatJSON},
+		Naming:  NamingFixed,
+	}
+}
+
+// Validate checks the formats and the naming
+func (c Config) Validate() error {
+	for _, format := range c.Formats {
+		if !slices.Contains(Formats, format) {
+			return fmt.Errorf("unknown report format %q - use %s", format, strings.Join(Formats, ", "))
+		}
+	}
+	switch c.Naming {
+	case NamingFixed, NamingTimestamp, NamingRunID:
+	default:
+		return fmt.Errorf("unknown report naming %q - use %q, %q or %q", c.Naming, NamingFixed, NamingTimestamp, NamingRunID)
+	}
+	return nil
+}
+
+// Report is the outcome of a run as written to the report files
+type Report struct {
+	RunID   string
+	Time    time.Time
+	Naming  string
+	Results []*tracker.ProcessResult
+	// Refreshes are the media server refresh calls after the run, nil when no server is configured
+	Refreshes []*mediaserver.RefreshResult
+}
+
+// New creates the report of a run finished now
+func New(runID string, naming string, results []*tracker.ProcessResult) *Report {
+	return &Report{
+		RunID:   runID,
+		Time:    time.Now(),
+		Naming:  naming,
+		Results: results,
+	}
+}
+
+// WithRefreshes adds the outcome of the media server refresh calls
+func (r *Report) WithRefreshes(refreshes []*mediaserver.RefreshResult) *Report {
+	report := *r
+	report.Refreshes = refreshes
+	if report.Refreshes == nil {
+		report.Refreshes = make([]*mediaserver.RefreshResult, 0)
+	}
+	return &report
+}
+
+// FileName adds the timestamp or run ID to a file name depending on the naming
+func (r *Report) FileName(name string) string {
+	var suffix string
+	switch r.Naming {
+	case NamingTimestamp:
+		suffix = r.Time.Format("20060102-150405")
+	case NamingRunID:
+		suffix = r.RunID
+	default:
+		return name
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + suffix + ext
+}
+
+// StatusCount is the number of files that ended with a status
+type StatusCount struct {
+	Status string
+	Count  int
+}
+
+// Statuses counts the results per status, most frequent first
+func (r *Report) Statuses() []StatusCount {
+	counts := make(map[string]int)
+	for _, result := range r.Results {
+		counts[result.Status.String()]++
+	}
+	statuses := make([]StatusCount, 0, len(counts))
+	for status, count := range counts {
+		statuses = append(statuses, StatusCount{Status: status, Count: count})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Count != statuses[j].Count {
+			return statuses[i].Count > statuses[j].Count
+		}
+		return statuses[i].Status < statuses[j].Status
+	})
+	return statuses
+}
+
+// ShowSummary is the outcome of the files of one show
+type ShowSummary struct {
+	Show      string
+	Total     int
+	Succeeded int
+	Failed    int
+}
+
+// Shows summarizes the results per show, by name
+func (r *Report) Shows() []ShowSummary {
+	summaries := make(map[string]*ShowSummary)
+	for _, result := range r.Results {
+		show := Show(result.FilePath)
+		summary, ok := summaries[show]
+		if !ok {
+			summary = &ShowSummary{Show: show}
+			summaries[show] = summary
+		}
+		summary.Total++
+		if result.Success {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+	}
+	shows := make([]ShowSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		shows = append(shows, *summary)
+	}
+	sort.Slice(shows, func(i, j int) bool { return shows[i].Show < shows[j].Show })
+	return shows
+}
+
+// Failures returns the results that did not succeed
+func (r *Report) Failures() []*tracker.ProcessResult {
+	var failures []*tracker.ProcessResult
+	for _, result := range r.Results {
+		if !result.Success {
+			failures = append(failures, result)
+		}
+	}
+	return failures
+}
+
+// FailedRefreshes counts the refresh calls that did not succeed
+func (r *Report) FailedRefreshes() int {
+	failed := 0
+	for _, refresh := range r.Refreshes {
+		if !refresh.Success {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Succeeded counts the results that succeeded
+func (r *Report) Succeeded() int {
+	return len(r.Results) - len(r.Failures())
+}
+
+// seasonDir matches the folders episodes are grouped in below the show folder
+var seasonDir = regexp.MustCompile(`(?i)^(season|series|staffel|saison)\s*\d+$|^specials$|^s\d+$`)
+
+// Show names the show a file belongs to - the folder above the season folder, or the file's own folder
+func Show(path string) string {
+	dir := filepath.Dir(path)
+	if seasonDir.MatchString(filepath.Base(dir)) {
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Base(dir)
+}
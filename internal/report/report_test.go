@@ -0,0 +1,238 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmj2728/go-vmu/internal/mediaserver"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func testReport() *Report {
+	exitCode := 1
+	return &Report{
+		RunID:  "20250102-150405-abcd",
+		Time:   time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC),
+		Naming: NamingFixed,
+		Results: []*tracker.ProcessResult{
+			{FilePath: "/tv/Show A/Season 1/ep1.mkv", Status: tracker.StatusSuccess, Success: true,
+				Changes: []tracker.TagChange{{Key: "title", Old: "", New: "Pilot"}}},
+			{FilePath: "/tv/Show A/Season 1/ep2.mkv", Status: tracker.StatusSkipped, Success: true},
+			{FilePath: "/tv/Show A/Specials/sp1.mkv", Status: tracker.StatusFFmpegError, Retries: 2, Attempts: 3,
+				Error: errors.New("exit status 1 | broken"), NFOPath: "/tv/Show A/Specials/sp1.nfo", WorkerID: 2,
+				Started: time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC), Duration: 1500 * time.Millisecond,
+				InputSize: 1000, FFmpegExitCode: &exitCode},
+			{FilePath: "/tv/Show B/ep1.avi", Status: tracker.StatusUnsupportedContainer, Container: "avi",
+				Error: errors.New("avi files cannot store tags")},
+		},
+	}
+}
+
+func testRefreshes() []*mediaserver.RefreshResult {
+	return []*mediaserver.RefreshResult{
+		{Server: "jellyfin", Type: mediaserver.TypeJellyfin, Granularity: "file", Targets: []string{"/media/a.mkv", "/media/b.mkv"},
+			Attempts: 1, StatusCode: 204, Success: true},
+		{Server: "plex", Type: mediaserver.TypePlex, Granularity: "folder", Targets: []string{"/media"},
+			Attempts: 3, Error: "connection refused"},
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, NewConfig().Validate())
+	assert.NoError(t, Config{Formats: Formats, Naming: NamingRunID}.Validate())
+	assert.Error(t, Config{Formats: []string{"pdf"}, Naming: NamingFixed}.Validate())
+	assert.Error(t, Config{Formats: []string{FormatJSON}, Naming: "daily"}.Validate())
+}
+
+func TestReport_FileName(t *testing.T) {
+	report := testReport()
+	assert.Equal(t, "results.json", report.FileName("results.json"))
+
+	report.Naming = NamingTimestamp
+	assert.Equal(t, "results-20250102-150405.json", report.FileName("results.json"))
+
+	report.Naming = NamingRunID
+	assert.Equal(t, "junit-20250102-150405-abcd.xml", report.FileName("junit.xml"))
+}
+
+func TestShow(t *testing.T) {
+	assert.Equal(t, "3 Body Problem", Show("/tv/3 Body Problem/Season 1/ep.mkv"))
+	assert.Equal(t, "Show", Show("/tv/Show/Specials/ep.mkv"))
+	assert.Equal(t, "Show", Show("/tv/Show/S02/ep.mkv"))
+	assert.Equal(t, "Movie (2020)", Show("/movies/Movie (2020)/movie.mkv"))
+}
+
+func TestReport_Summaries(t *testing.T) {
+	report := testReport()
+
+	assert.Equal(t, 2, report.Succeeded())
+	assert.Len(t, report.Failures(), 2)
+	assert.Equal(t, []ShowSummary{
+		{Show: "Show A", Total: 3, Succeeded: 2, Failed: 1},
+		{Show: "Show B", Total: 1, Failed: 1},
+	}, report.Shows())
+	assert.Equal(t, []StatusCount{
+		{Status: "FFmpegError", Count: 1},
+		{Status: "Skipped", Count: 1},
+		{Status: "Success", Count: 1},
+		{Status: "UnsupportedContainer", Count: 1},
+	}, report.Statuses())
+}
+
+func TestReport_WriteCSV(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, testReport().WriteCSV(&out))
+
+	rows, err := csv.NewReader(&out).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 5)
+	assert.Equal(t, "file", rows[0][0])
+	assert.Equal(t, []string{"/tv/Show A/Specials/sp1.mkv", "Show A", "FFmpegError", "false", "2", "exit status 1 | broken", "0", "", "",
+		"/tv/Show A/Specials/sp1.nfo", "3", "2", "2025-01-02T15:00:00Z", "1.500", "1000", "0", "1"}, rows[3])
+	assert.Equal(t, "", rows[4][12])
+	assert.Equal(t, "", rows[4][16])
+	assert.Equal(t, "1", rows[1][6])
+}
+
+func TestReport_WriteNDJSON(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, testReport().WriteNDJSON(&out))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 4)
+	var result tracker.HumanReadableResult
+	assert.NoError(t, json.Unmarshal([]byte(lines[2]), &result))
+	assert.Equal(t, "FFmpegError", result.Status)
+	assert.Equal(t, 2, result.Retries)
+}
+
+func TestReport_WriteMarkdown(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, testReport().WriteMarkdown(&out))
+
+	markdown := out.String()
+	assert.Contains(t, markdown, "# vmu run 20250102-150405-abcd")
+	assert.Contains(t, markdown, "4 files, 2 succeeded, 2 failed")
+	assert.Contains(t, markdown, "| Show A | 3 | 2 | 1 |")
+	assert.Contains(t, markdown, "| FFmpegError | 1 |")
+	assert.Contains(t, markdown, `| /tv/Show A/Specials/sp1.mkv | FFmpegError | exit status 1 \| broken |`)
+}
+
+func TestReport_WriteHTML(t *testing.T) {
+	report := testReport()
+	report.Results[2].Error = errors.New("<script>")
+	var out bytes.Buffer
+	assert.NoError(t, report.WriteHTML(&out))
+
+	page := out.String()
+	assert.Contains(t, page, "<td>Show B</td>")
+	assert.Contains(t, page, "&lt;script&gt;")
+	assert.NotContains(t, page, "<script>")
+}
+
+func TestReport_WriteJUnit(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, testReport().WriteJUnit(&out))
+
+	var suites junitSuites
+	assert.NoError(t, xml.Unmarshal(out.Bytes(), &suites))
+	assert.Equal(t, 4, suites.Tests)
+	assert.Equal(t, 1, suites.Failures)
+	assert.Equal(t, 2, suites.Skipped)
+	assert.Len(t, suites.Suites, 2)
+	assert.Equal(t, "Show A", suites.Suites[0].Name)
+	assert.Len(t, suites.Suites[0].Cases, 3)
+	assert.Nil(t, suites.Suites[0].Cases[0].Failure)
+	assert.NotNil(t, suites.Suites[0].Cases[1].Skipped)
+	assert.Equal(t, "FFmpegError", suites.Suites[0].Cases[2].Failure.Message)
+	assert.Equal(t, "exit status 1 | broken", suites.Suites[0].Cases[2].Failure.Text)
+	assert.Equal(t, 1.5, suites.Suites[0].Cases[2].Time)
+	assert.Equal(t, 1.5, suites.Suites[0].Time)
+	assert.NotNil(t, suites.Suites[1].Cases[0].Skipped)
+}
+
+func TestReport_Refreshes(t *testing.T) {
+	report := testReport().WithRefreshes(testRefreshes())
+	assert.Nil(t, testReport().Refreshes)
+	assert.NotNil(t, testReport().WithRefreshes(nil).Refreshes)
+
+	var out bytes.Buffer
+	assert.NoError(t, report.WriteRefreshCSV(&out))
+	rows, err := csv.NewReader(&out).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, []string{"plex", "plex", "folder", "/media", "3", "0", "false", "connection refused"}, rows[2])
+
+	out.Reset()
+	assert.NoError(t, report.WriteRefreshNDJSON(&out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	var refresh mediaserver.RefreshResult
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &refresh))
+	assert.Equal(t, []string{"/media/a.mkv", "/media/b.mkv"}, refresh.Targets)
+
+	out.Reset()
+	assert.NoError(t, report.WriteMarkdown(&out))
+	assert.Contains(t, out.String(), "2 calls, 1 failed")
+	assert.Contains(t, out.String(), "| jellyfin | 2 | 1 | OK |")
+	assert.Contains(t, out.String(), "| plex | 1 | 3 | connection refused |")
+
+	out.Reset()
+	assert.NoError(t, report.WriteHTML(&out))
+	assert.Contains(t, out.String(), `<td class="failed">connection refused</td>`)
+
+	out.Reset()
+	assert.NoError(t, report.WriteJUnit(&out))
+	var suites junitSuites
+	assert.NoError(t, xml.Unmarshal(out.Bytes(), &suites))
+	assert.Equal(t, 6, suites.Tests)
+	assert.Equal(t, 2, suites.Failures)
+	refreshes := suites.Suites[len(suites.Suites)-1]
+	assert.Equal(t, "Media server refreshes", refreshes.Name)
+	assert.Nil(t, refreshes.Cases[0].Failure)
+	assert.Equal(t, "connection refused", refreshes.Cases[1].Failure.Text)
+}
+
+func TestReport_Save(t *testing.T) {
+	dir := t.TempDir()
+	report := testReport()
+	report.Naming = NamingRunID
+
+	written, err := report.Save(dir, Formats)
+
+	assert.NoError(t, err)
+	assert.Len(t, written, 7)
+	for _, name := range []string{"results", "failures"} {
+		assert.FileExists(t, filepath.Join(dir, name+"-20250102-150405-abcd.json"))
+	}
+	for _, name := range []string{"results.csv", "results.ndjson", "report.md", "report.html", "junit.xml"} {
+		assert.FileExists(t, filepath.Join(dir, report.FileName(name)))
+	}
+	// the JSON results can still be re-run
+	paths, err := utils.LoadResultPaths(filepath.Join(dir, report.FileName("failures.json")))
+	assert.NoError(t, err)
+	assert.Contains(t, paths, "/tv/Show A/Specials/sp1.mkv")
+
+	// refresh calls get files of their own next to the line-based results
+	written, err = report.WithRefreshes(testRefreshes()).Save(dir, Formats)
+	assert.NoError(t, err)
+	assert.Len(t, written, 10)
+	for _, name := range []string{"refresh.json", "refresh.csv", "refresh.ndjson"} {
+		assert.FileExists(t, filepath.Join(dir, report.FileName(name)))
+	}
+
+	_, err = report.Save(filepath.Join(dir, "missing"), []string{FormatCSV})
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,50 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// transientErrnos are the errors a network filesystem returns during a blip
+var transientErrnos = []syscall.Errno{
+	syscall.EIO, syscall.ESTALE, syscall.ETIMEDOUT, syscall.EAGAIN, syscall.EBUSY,
+	syscall.ECONNRESET, syscall.ECONNABORTED, syscall.ENETUNREACH, syscall.EHOSTUNREACH,
+}
+
+// transientMessages catch the same errors once they were flattened into a string,
+// e.g. by ffmpeg or an fmt.Errorf with %v
+var transientMessages = []string{
+	"input/output error", "stale file handle", "stale nfs file handle", "timed out", "timeout",
+	"connection reset", "resource temporarily unavailable", "transport endpoint is not connected",
+	"host is down", "network is unreachable",
+}
+
+// Transient reports whether err looks like a temporary failure that a later attempt can get past
+func Transient(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, m := range transientMessages {
+		if strings.Contains(message, m) {
+			return true
+		}
+	}
+	return false
+}
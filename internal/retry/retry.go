@@ -0,0 +1,133 @@
+package retry
+
+import (
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"math/rand/v2"
+	"time"
+)
+
+// Retry modes for a status
+const (
+	// ModeAlways retries every failure with the status
+	ModeAlways = "always"
+	// ModeTransient only retries when the error looks temporary
+	ModeTransient = "transient"
+	// ModeNever treats the status as final
+	ModeNever = "never"
+)
+
+// DefaultRules retry what a second attempt can fix - a missing or broken NFO stays missing or broken
+var DefaultRules = map[string]string{
+	tracker.StatusFileNotFound.String():         ModeTransient,
+	tracker.StatusNFONotFound.String():          ModeNever,
+	tracker.StatusNFOParseError.String():        ModeNever,
+	tracker.StatusFFmpegError.String():          ModeAlways,
+	tracker.StatusValidationError.String():      ModeAlways,
+	tracker.StatusCleanupError.String():         ModeAlways,
+	tracker.StatusNetworkError.String():         ModeAlways,
+	tracker.StatusUnknownError.String():         ModeAlways,
+	tracker.StatusUnsupportedContainer.String(): ModeNever,
+	tracker.StatusTimeout.String():              ModeAlways,
+	tracker.StatusInsufficientSpace.String():    ModeNever,
+}
+
+// MaxRetries caps the retries a run can ask for
+const MaxRetries = 5
+
+// ClampRetries keeps a retry count within 0 and MaxRetries
+func ClampRetries(retries int) int {
+	if retries < 0 {
+		return 0
+	}
+	if retries > MaxRetries {
+		return MaxRetries
+	}
+	return retries
+}
+
+// Policy decides which failures are retried and how long to wait before each attempt
+type Policy struct {
+	// BaseDelay is the wait before the first retry, it doubles with every further retry
+	BaseDelay time.Duration `toml:"base_delay"`
+	// MaxDelay caps the wait
+	MaxDelay time.Duration `toml:"max_delay"`
+	// Jitter spreads the wait by up to this fraction either way so retries do not arrive together
+	Jitter float64 `toml:"jitter"`
+	// Rules maps status names such as "FFmpegError" to a mode, statuses left out use DefaultRules
+	Rules map[string]string `toml:"rules"`
+}
+
+// NewPolicy returns the default retry policy
+func NewPolicy() Policy {
+	return Policy{
+		BaseDelay: 2 * time.Second,
+		MaxDelay:  time.Minute,
+		Jitter:    0.2,
+	}
+}
+
+// Validate checks the delays and the rules
+func (p Policy) Validate() error {
+	if p.BaseDelay < 0 || p.MaxDelay < 0 {
+		return fmt.Errorf("retry delays must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1, got %v", p.Jitter)
+	}
+	for status, mode := range p.Rules {
+		if _, ok := DefaultRules[status]; !ok {
+			return fmt.Errorf("unknown status %q in retry rules", status)
+		}
+		switch mode {
+		case ModeAlways, ModeTransient, ModeNever:
+		default:
+			return fmt.Errorf("unknown retry mode %q for %s - use %q, %q or %q", mode, status, ModeAlways, ModeTransient, ModeNever)
+		}
+	}
+	return nil
+}
+
+// Mode returns the retry mode of a status
+func (p Policy) Mode(status tracker.ProcessStatus) string {
+	if mode, ok := p.Rules[status.String()]; ok {
+		return mode
+	}
+	if mode, ok := DefaultRules[status.String()]; ok {
+		return mode
+	}
+	return ModeNever
+}
+
+// ShouldRetry reports whether a failed result gets another attempt
+func (p Policy) ShouldRetry(result *tracker.ProcessResult) bool {
+	if result.Success {
+		return false
+	}
+	switch p.Mode(result.Status) {
+	case ModeAlways:
+		return true
+	case ModeTransient:
+		return Transient(result.Error)
+	default:
+		return false
+	}
+}
+
+// Delay is the wait before the given retry, counting from 1
+func (p Policy) Delay(retry int) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+	delay := p.BaseDelay
+	for i := 1; i < retry && i < 32 && (p.MaxDelay == 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return delay
+}
@@ -0,0 +1,73 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransient(t *testing.T) {
+	assert.False(t, Transient(nil))
+	assert.True(t, Transient(&fs.PathError{Op: "open", Path: "/mnt/nfs/ep1.mkv", Err: syscall.ESTALE}))
+	assert.True(t, Transient(fmt.Errorf("error copying file: %w", syscall.EIO)))
+	assert.True(t, Transient(context.DeadlineExceeded))
+	// flattened errors are recognised by their message
+	assert.True(t, Transient(errors.New("error reading nfo file: read /mnt/nfs/ep1.nfo: input/output error")))
+	assert.False(t, Transient(fs.ErrNotExist))
+	assert.False(t, Transient(errors.New("error unmarshalling nfo file: XML syntax error")))
+}
+
+func TestPolicy_ShouldRetry(t *testing.T) {
+	policy := NewPolicy()
+
+	assert.False(t, policy.ShouldRetry(&tracker.ProcessResult{Success: true, Status: tracker.StatusSuccess}))
+	assert.False(t, policy.ShouldRetry(&tracker.ProcessResult{Status: tracker.StatusNFONotFound, Error: errors.New("missing")}))
+	assert.False(t, policy.ShouldRetry(&tracker.ProcessResult{Status: tracker.StatusNFOParseError, Error: errors.New("bad xml")}))
+	assert.True(t, policy.ShouldRetry(&tracker.ProcessResult{Status: tracker.StatusFFmpegError, Error: errors.New("exit status 1")}))
+	assert.True(t, policy.ShouldRetry(&tracker.ProcessResult{Status: tracker.StatusNetworkError, Error: syscall.EIO}))
+	// a vanished file is only worth another look when the filesystem hiccupped
+	assert.False(t, policy.ShouldRetry(&tracker.ProcessResult{Status: tracker.StatusFileNotFound, Error: fs.ErrNotExist}))
+	assert.True(t, policy.ShouldRetry(&tracker.ProcessResult{Status: tracker.StatusFileNotFound, Error: syscall.ESTALE}))
+
+	policy.Rules = map[string]string{"FFmpegError": ModeTransient}
+	assert.False(t, policy.ShouldRetry(&tracker.ProcessResult{Status: tracker.StatusFFmpegError, Error: errors.New("exit status 1")}))
+	assert.True(t, policy.ShouldRetry(&tracker.ProcessResult{Status: tracker.StatusFFmpegError, Error: errors.New("Connection timed out")}))
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	assert.NoError(t, NewPolicy().Validate())
+	assert.NoError(t, Policy{Rules: map[string]string{"NFONotFound": ModeAlways}}.Validate())
+	assert.Error(t, Policy{Rules: map[string]string{"Oops": ModeAlways}}.Validate())
+	assert.Error(t, Policy{Rules: map[string]string{"FFmpegError": "sometimes"}}.Validate())
+	assert.Error(t, Policy{Jitter: 2}.Validate())
+	assert.Error(t, Policy{BaseDelay: -time.Second}.Validate())
+}
+
+func TestPolicy_Delay(t *testing.T) {
+	policy := Policy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	assert.Equal(t, time.Second, policy.Delay(1))
+	assert.Equal(t, 2*time.Second, policy.Delay(2))
+	assert.Equal(t, 4*time.Second, policy.Delay(3))
+	assert.Equal(t, 5*time.Second, policy.Delay(4))
+	assert.Equal(t, 5*time.Second, policy.Delay(30))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(2)
+		assert.GreaterOrEqual(t, delay, time.Second)
+		assert.LessOrEqual(t, delay, 3*time.Second)
+	}
+}
+
+func TestClampRetries(t *testing.T) {
+	assert.Equal(t, 0, ClampRetries(-1))
+	assert.Equal(t, 3, ClampRetries(3))
+	assert.Equal(t, MaxRetries, ClampRetries(50))
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"sync"
+)
+
+// RunEvent is a tracker event tagged with the run it belongs to
+type RunEvent struct {
+	RunID string `json:"run_id"`
+	tracker.Event
+}
+
+// Broker fans run events out to Server-Sent Event subscribers
+type Broker struct {
+	subscribers map[chan RunEvent]struct{}
+	mu          sync.Mutex
+}
+
+// NewBroker creates an empty broker
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[chan RunEvent]struct{}),
+	}
+}
+
+// Subscribe returns a channel of events and a function to stop the subscription
+func (b *Broker) Subscribe() (<-chan RunEvent, func()) {
+	ch := make(chan RunEvent, 64)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends an event to every subscriber, dropping it for subscribers that are not keeping up
+func (b *Broker) Publish(event RunEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Run states
+const (
+	RunQueued    = "queued"
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+)
+
+// Run is a single processing run started through the API
+type Run struct {
+	ID         string                         `json:"id"`
+	Directory  string                         `json:"directory"`
+	Workers    int                            `json:"workers"`
+	Retries    int                            `json:"retries"`
+	State      string                         `json:"state"`
+	CreatedAt  time.Time                      `json:"created_at"`
+	StartedAt  *time.Time                     `json:"started_at,omitempty"`
+	FinishedAt *time.Time                     `json:"finished_at,omitempty"`
+	Error      string                         `json:"error,omitempty"`
+	Counts     map[string]int                 `json:"counts,omitempty"`
+	Results    []*tracker.HumanReadableResult `json:"results,omitempty"`
+}
+
+// RunSummary is the list view of a run, without per-file results
+type RunSummary struct {
+	ID         string         `json:"id"`
+	Directory  string         `json:"directory"`
+	State      string         `json:"state"`
+	CreatedAt  time.Time      `json:"created_at"`
+	StartedAt  *time.Time     `json:"started_at,omitempty"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Files      int            `json:"files"`
+	Counts     map[string]int `json:"counts,omitempty"`
+}
+
+// FileHistoryEntry is one result for a file within a run
+type FileHistoryEntry struct {
+	RunID  string                       `json:"run_id"`
+	Time   time.Time                    `json:"time"`
+	Result *tracker.HumanReadableResult `json:"result"`
+}
+
+// RunStore keeps runs in memory and optionally persists finished runs to disk
+type RunStore struct {
+	dir  string
+	runs map[string]*Run
+	mu   sync.RWMutex
+}
+
+// NewRunStore creates a store, loading previous runs from dir when it is set
+func NewRunStore(dir string) (*RunStore, error) {
+	store := &RunStore{
+		dir:  dir,
+		runs: make(map[string]*Run),
+	}
+	if dir == "" {
+		return store, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating run directory %s: %w", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading run directory %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			log.Warn().Err(err).Msgf("Skipping unreadable run file %s", entry.Name())
+			continue
+		}
+		run := &Run{}
+		if err := json.Unmarshal(data, run); err != nil {
+			log.Warn().Err(err).Msgf("Skipping invalid run file %s", entry.Name())
+			continue
+		}
+		// a run that was in flight when the server stopped will never finish
+		if run.State == RunQueued || run.State == RunRunning {
+			run.State = RunFailed
+			run.Error = "server stopped before the run finished"
+		}
+		store.runs[run.ID] = run
+	}
+	log.Debug().Msgf("Loaded %d previous runs from %s", len(store.runs), dir)
+	return store, nil
+}
+
+// Add stores a new run
+func (s *RunStore) Add(run *Run) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[run.ID] = run
+}
+
+// Update applies fn to the run under the lock and persists it once it is finished
+func (s *RunStore) Update(id string, fn func(run *Run)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	if !ok {
+		return
+	}
+	fn(run)
+	if run.State == RunCompleted || run.State == RunFailed {
+		s.save(run)
+	}
+}
+
+// Get returns a copy of a run
+func (s *RunStore) Get(id string) (*Run, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	run, ok := s.runs[id]
+	if !ok {
+		return nil, false
+	}
+	c := *run
+	return &c, true
+}
+
+// List returns summaries of all runs, newest first
+func (s *RunStore) List() []*RunSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	summaries := make([]*RunSummary, 0, len(s.runs))
+	for _, run := range s.runs {
+		summaries = append(summaries, &RunSummary{
+			ID:         run.ID,
+			Directory:  run.Directory,
+			State:      run.State,
+			CreatedAt:  run.CreatedAt,
+			StartedAt:  run.StartedAt,
+			FinishedAt: run.FinishedAt,
+			Error:      run.Error,
+			Files:      len(run.Results),
+			Counts:     run.Counts,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].CreatedAt.After(summaries[j].CreatedAt)
+	})
+	return summaries
+}
+
+// FileHistory returns every result recorded for path, newest first
+func (s *RunStore) FileHistory(path string) []*FileHistoryEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	history := make([]*FileHistoryEntry, 0)
+	for _, run := range s.runs {
+		for _, result := range run.Results {
+			if result.FilePath != path {
+				continue
+			}
+			t := run.CreatedAt
+			if run.FinishedAt != nil {
+				t = *run.FinishedAt
+			}
+			history = append(history, &FileHistoryEntry{RunID: run.ID, Time: t, Result: result})
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Time.After(history[j].Time)
+	})
+	return history
+}
+
+// save writes a run to disk, callers must hold the lock
+func (s *RunStore) save(run *Run) {
+	if s.dir == "" {
+		return
+	}
+	data, err := json.MarshalIndent(run, "", "    ")
+	if err != nil {
+		log.Error().Err(err).Msgf("Error marshalling run %s", run.ID)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, run.ID+".json"), data, 0644); err != nil {
+		log.Error().Err(err).Msgf("Error saving run %s", run.ID)
+	}
+}
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/metrics"
+	"github.com/bmj2728/go-vmu/internal/processor"
+	"github.com/bmj2728/go-vmu/internal/retry"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	"github.com/rs/zerolog/log"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// RunFunc processes a directory as the run runID and reports progress to the listener
+type RunFunc func(runID string, directory string, workers int, retries int, listener tracker.Listener) ([]*tracker.ProcessResult, error)
+
+// Config holds the settings for the API server
+type Config struct {
+	Addr    string
+	Token   string
+	DataDir string
+	// Workers is the default and the most workers a run can ask for
+	Workers int
+	Retries int
+}
+
+// Server exposes the REST API, the SSE event stream and the dashboard
+type Server struct {
+	Config  Config
+	Runs    *RunStore
+	Broker  *Broker
+	RunFunc RunFunc
+	queue   chan string
+}
+
+// StartRunRequest is the body of POST /api/runs
+type StartRunRequest struct {
+	Directory string `json:"directory"`
+	Workers   int    `json:"workers,omitempty"`
+	Retries   *int   `json:"retries,omitempty"`
+}
+
+// NewServer creates a server that processes runs one at a time
+func NewServer(cfg Config) (*Server, error) {
+	runs, err := NewRunStore(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		Config:  cfg,
+		Runs:    runs,
+		Broker:  NewBroker(),
+		RunFunc: processDirectory,
+		queue:   make(chan string, 100),
+	}, nil
+}
+
+// processDirectory is the default RunFunc backed by the processor
+func processDirectory(runID string, directory string, workers int, retries int, listener tracker.Listener) ([]*tracker.ProcessResult, error) {
+	proc := processor.NewProcessor(workers)
+	proc.Options.RunID = runID
+	proc.Listeners = append(proc.Listeners, listener)
+	//the API streams the events, a bar would only clutter the server log
+	proc.Reporter = tracker.NewSilentReporter()
+	return proc.ProcessDirectory(directory, retries)
+}
+
+// Handler returns the HTTP handler for the API and dashboard
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/runs", s.auth(http.HandlerFunc(s.handleStartRun)))
+	mux.Handle("GET /api/runs", s.auth(http.HandlerFunc(s.handleListRuns)))
+	mux.Handle("GET /api/runs/{id}", s.auth(http.HandlerFunc(s.handleGetRun)))
+	mux.Handle("GET /api/runs/{id}/results", s.auth(http.HandlerFunc(s.handleRunResults)))
+	mux.Handle("GET /api/files", s.auth(http.HandlerFunc(s.handleFileHistory)))
+	mux.Handle("GET /api/events", s.auth(http.HandlerFunc(s.handleEvents)))
+	// left open so Prometheus can scrape without the API token
+	mux.Handle("GET /metrics", metrics.Default.Handler())
+
+	static, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		// the embedded directory is part of the binary, this cannot fail at runtime
+		panic(err)
+	}
+	mux.Handle("GET /", http.FileServerFS(static))
+	return mux
+}
+
+// ListenAndServe starts the run worker and serves until ctx is cancelled
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if s.Config.Token == "" {
+		log.Warn().Msg("No API token configured - the API is open to anyone who can reach it")
+	}
+	go s.runWorker(ctx)
+
+	httpServer := &http.Server{
+		Addr:              s.Config.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Error shutting down server")
+		}
+	}()
+
+	log.Info().Msgf("Serving vmu dashboard on %s", s.Config.Addr)
+	err := httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Enqueue creates a run and queues it for processing
+func (s *Server) Enqueue(req StartRunRequest) (*Run, error) {
+	info, err := os.Stat(req.Directory)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", req.Directory)
+	}
+	run := &Run{
+		ID:        utils.NewRunID(),
+		Directory: req.Directory,
+		Workers:   s.Config.Workers,
+		Retries:   s.Config.Retries,
+		State:     RunQueued,
+		CreatedAt: time.Now(),
+	}
+	//a run may ask for fewer workers than the server allows, never more
+	if req.Workers > 0 && req.Workers < run.Workers {
+		run.Workers = req.Workers
+	}
+	if req.Retries != nil {
+		run.Retries = retry.ClampRetries(*req.Retries)
+	}
+	queued := *run
+	s.Runs.Add(run)
+	select {
+	case s.queue <- run.ID:
+	default:
+		s.Runs.Update(run.ID, func(r *Run) {
+			r.State = RunFailed
+			r.Error = "run queue is full"
+		})
+		return nil, errors.New("run queue is full")
+	}
+	return &queued, nil
+}
+
+// runWorker processes queued runs one at a time so runs never touch the same files concurrently
+func (s *Server) runWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue:
+			s.execute(id)
+		}
+	}
+}
+
+func (s *Server) execute(id string) {
+	run, ok := s.Runs.Get(id)
+	if !ok {
+		return
+	}
+	started := time.Now()
+	s.Runs.Update(id, func(r *Run) {
+		r.State = RunRunning
+		r.StartedAt = &started
+	})
+	log.Info().Msgf("Starting run %s on %s", id, run.Directory)
+
+	results, err := s.RunFunc(id, run.Directory, run.Workers, run.Retries, func(event tracker.Event) {
+		s.Broker.Publish(RunEvent{RunID: id, Event: event})
+	})
+
+	finished := time.Now()
+	s.Runs.Update(id, func(r *Run) {
+		r.FinishedAt = &finished
+		if err != nil {
+			r.State = RunFailed
+			r.Error = err.Error()
+			return
+		}
+		r.State = RunCompleted
+		r.Counts = make(map[string]int)
+		for status, count := range utils.GetStatusCounts(results) {
+			r.Counts[status.String()] = count
+		}
+		for _, result := range results {
+			r.Results = append(r.Results, result.MakeHumanReadable())
+		}
+	})
+	s.Broker.Publish(RunEvent{RunID: id, Event: tracker.Event{Type: "run_finished", Time: finished}})
+	log.Info().Msgf("Finished run %s", id)
+}
+
+// auth checks the bearer token, falling back to a token query parameter for EventSource clients
+func (s *Server) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Config.Token != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" {
+				token = r.URL.Query().Get("token")
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.Config.Token)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleStartRun(w http.ResponseWriter, r *http.Request) {
+	req := StartRunRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.Directory == "" {
+		writeError(w, http.StatusBadRequest, errors.New("directory is required"))
+		return
+	}
+	run, err := s.Enqueue(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+func (s *Server) handleListRuns(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.Runs.List())
+}
+
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.Runs.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("run not found"))
+		return
+	}
+	run.Results = nil
+	writeJSON(w, http.StatusOK, run)
+}
+
+func (s *Server) handleRunResults(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.Runs.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("run not found"))
+		return
+	}
+	results := run.Results
+	if results == nil {
+		results = make([]*tracker.HumanReadableResult, 0)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) handleFileHistory(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		writeError(w, http.StatusBadRequest, errors.New("path is required"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Runs.FileHistory(path))
+}
+
+// handleEvents streams run events as Server-Sent Events
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+	// subscribe before the headers go out so the client never misses an event
+	events, unsubscribe := s.Broker.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Error().Err(err).Msg("Error marshalling event")
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Msg("Error writing response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T, runFunc RunFunc) (*Server, *httptest.Server, context.CancelFunc) {
+	srv, err := NewServer(Config{Token: "secret", Workers: 1, DataDir: t.TempDir()})
+	assert.NoError(t, err)
+	srv.RunFunc = runFunc
+	ctx, cancel := context.WithCancel(context.Background())
+	go srv.runWorker(ctx)
+	httpServer := httptest.NewServer(srv.Handler())
+	t.Cleanup(httpServer.Close)
+	return srv, httpServer, cancel
+}
+
+func fakeRun(_ string, directory string, _ int, _ int, listener tracker.Listener) ([]*tracker.ProcessResult, error) {
+	file := directory + "/ep1.mkv"
+	listener(tracker.Event{Type: tracker.EventStageChanged, File: file, Stage: tracker.StageProcess})
+	return []*tracker.ProcessResult{
+		{
+			FilePath: file,
+			Status:   tracker.StatusSuccess,
+			Success:  true,
+			Changes:  []tracker.TagChange{{Key: "title", Old: "", New: "Pilot"}},
+		},
+		{
+			FilePath: directory + "/ep2.mkv",
+			Status:   tracker.StatusNFONotFound,
+			Error:    errors.New("nfo missing"),
+		},
+	}, nil
+}
+
+func request(t *testing.T, method string, url string, body string, token string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	return resp
+}
+
+func waitForState(t *testing.T, srv *Server, id string, state string) *Run {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		run, ok := srv.Runs.Get(id)
+		if ok && run.State == state {
+			return run
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("run %s did not reach state %s", id, state)
+	return nil
+}
+
+func TestServer_Auth(t *testing.T) {
+	_, httpServer, cancel := newTestServer(t, fakeRun)
+	defer cancel()
+
+	resp := request(t, http.MethodGet, httpServer.URL+"/api/runs", "", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = request(t, http.MethodGet, httpServer.URL+"/api/runs", "", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = request(t, http.MethodGet, httpServer.URL+"/api/runs?token=secret", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = request(t, http.MethodGet, httpServer.URL+"/api/runs", "", "secret")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the dashboard itself is public, the token is entered in the page
+	resp = request(t, http.MethodGet, httpServer.URL+"/", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+}
+
+func TestServer_RunLifecycle(t *testing.T) {
+	srv, httpServer, cancel := newTestServer(t, fakeRun)
+	defer cancel()
+	dir := t.TempDir()
+
+	resp := request(t, http.MethodPost, httpServer.URL+"/api/runs", `{"directory":"`+dir+`"}`, "secret")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	run := &Run{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(run))
+	assert.NotEmpty(t, run.ID)
+
+	finished := waitForState(t, srv, run.ID, RunCompleted)
+	assert.Equal(t, 1, finished.Counts["Success"])
+	assert.Equal(t, 1, finished.Counts["NFONotFound"])
+
+	resp = request(t, http.MethodGet, httpServer.URL+"/api/runs", "", "secret")
+	var summaries []*RunSummary
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&summaries))
+	assert.Len(t, summaries, 1)
+	assert.Equal(t, 2, summaries[0].Files)
+
+	resp = request(t, http.MethodGet, httpServer.URL+"/api/runs/"+run.ID+"/results", "", "secret")
+	var results []*tracker.HumanReadableResult
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&results))
+	assert.Len(t, results, 2)
+	assert.Equal(t, "Pilot", results[0].Changes[0].New)
+	assert.Equal(t, "nfo missing", results[1].Error)
+
+	resp = request(t, http.MethodGet, httpServer.URL+"/api/files?path="+dir+"/ep1.mkv", "", "secret")
+	var history []*FileHistoryEntry
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	assert.Len(t, history, 1)
+	assert.Equal(t, run.ID, history[0].RunID)
+
+	resp = request(t, http.MethodGet, httpServer.URL+"/api/runs/missing", "", "secret")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// finished runs are persisted and reloaded
+	store, err := NewRunStore(srv.Config.DataDir)
+	assert.NoError(t, err)
+	reloaded, ok := store.Get(run.ID)
+	assert.True(t, ok)
+	assert.Equal(t, RunCompleted, reloaded.State)
+	assert.Len(t, reloaded.Results, 2)
+}
+
+func TestServer_StartRunValidation(t *testing.T) {
+	_, httpServer, cancel := newTestServer(t, fakeRun)
+	defer cancel()
+
+	resp := request(t, http.MethodPost, httpServer.URL+"/api/runs", `{}`, "secret")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = request(t, http.MethodPost, httpServer.URL+"/api/runs", `{"directory":"/non/existent"}`, "secret")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = request(t, http.MethodPost, httpServer.URL+"/api/runs", `not json`, "secret")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServer_FailedRun(t *testing.T) {
+	srv, httpServer, cancel := newTestServer(t, func(string, string, int, int, tracker.Listener) ([]*tracker.ProcessResult, error) {
+		return nil, errors.New("walk failed")
+	})
+	defer cancel()
+
+	resp := request(t, http.MethodPost, httpServer.URL+"/api/runs", `{"directory":"`+t.TempDir()+`"}`, "secret")
+	run := &Run{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(run))
+
+	failed := waitForState(t, srv, run.ID, RunFailed)
+	assert.Equal(t, "walk failed", failed.Error)
+}
+
+func TestServer_ClampsRuns(t *testing.T) {
+	srv, err := NewServer(Config{Workers: 4, Retries: 3, DataDir: t.TempDir()})
+	assert.NoError(t, err)
+	ranAs := make(chan string, 1)
+	srv.RunFunc = func(runID string, _ string, _ int, _ int, _ tracker.Listener) ([]*tracker.ProcessResult, error) {
+		ranAs <- runID
+		return nil, nil
+	}
+
+	retries := 50
+	run, err := srv.Enqueue(StartRunRequest{Directory: t.TempDir(), Workers: 64, Retries: &retries})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, run.Workers)
+	assert.Equal(t, 5, run.Retries)
+
+	retries = -1
+	run, err = srv.Enqueue(StartRunRequest{Directory: t.TempDir(), Workers: 2, Retries: &retries})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, run.Workers)
+	assert.Equal(t, 0, run.Retries)
+
+	srv.execute(run.ID)
+	assert.Equal(t, run.ID, <-ranAs)
+}
+
+func TestServer_Events(t *testing.T) {
+	srv, httpServer, cancel := newTestServer(t, fakeRun)
+	defer cancel()
+
+	resp := request(t, http.MethodGet, httpServer.URL+"/api/events?token=secret", "", "")
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	_, err := srv.Enqueue(StartRunRequest{Directory: t.TempDir()})
+	assert.NoError(t, err)
+
+	reader := bufio.NewReader(resp.Body)
+	var eventTypes []string
+	for len(eventTypes) < 2 {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		if strings.HasPrefix(line, "event: ") {
+			eventTypes = append(eventTypes, strings.TrimSpace(strings.TrimPrefix(line, "event: ")))
+		}
+	}
+	assert.Equal(t, []string{tracker.EventStageChanged, "run_finished"}, eventTypes)
+}
+
+func TestServer_Metrics(t *testing.T) {
+	_, httpServer, cancel := newTestServer(t, fakeRun)
+	defer cancel()
+
+	resp := request(t, http.MethodGet, httpServer.URL+"/metrics", "", "")
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body := new(strings.Builder)
+	_, err := bufio.NewReader(resp.Body).WriteTo(body)
+	assert.NoError(t, err)
+	assert.Contains(t, body.String(), "# TYPE vmu_files_processed_total counter")
+	assert.Contains(t, body.String(), "vmu_active_workers")
+}
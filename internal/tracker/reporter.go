@@ -0,0 +1,182 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/schollz/progressbar/v3"
+	"io"
+	"os"
+	"time"
+)
+
+// Reporter kinds accepted by NewReporter
+const (
+	// ReporterAuto draws the bar on a terminal and writes text lines everywhere else
+	ReporterAuto   = "auto"
+	ReporterBar    = "bar"
+	ReporterText   = "text"
+	ReporterJSON   = "json"
+	ReporterSilent = "silent"
+)
+
+// Reporter shows the progress of a run. The tracker calls it with its lock held, so calls never
+// overlap, and like listeners a reporter should not block.
+type Reporter interface {
+	// Event receives every event the tracker emits
+	Event(event Event)
+	// Update receives the file counts and a description of the active files after every change
+	Update(completed, total int, description string)
+	// Close ends the output at the end of a run
+	Close()
+}
+
+// NewReporter returns the reporter of the given kind writing to stderr
+func NewReporter(kind string) (Reporter, error) {
+	switch kind {
+	case ReporterAuto, "":
+		if isTerminal(os.Stderr) {
+			return NewBarReporter(), nil
+		}
+		return NewTextReporter(os.Stderr), nil
+	case ReporterBar:
+		return NewBarReporter(), nil
+	case ReporterText:
+		return NewTextReporter(os.Stderr), nil
+	case ReporterJSON:
+		return NewJSONReporter(os.Stderr), nil
+	case ReporterSilent:
+		return NewSilentReporter(), nil
+	default:
+		return nil, fmt.Errorf("unknown progress reporter %q - use %s, %s, %s, %s or %s", kind,
+			ReporterAuto, ReporterBar, ReporterText, ReporterJSON, ReporterSilent)
+	}
+}
+
+// isTerminal reports whether f is a character device rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// BarReporter redraws a progress bar with the active files below it
+type BarReporter struct {
+	bar *progressbar.ProgressBar
+}
+
+// NewBarReporter creates a reporter drawing a progress bar on stderr
+func NewBarReporter() *BarReporter {
+	return &BarReporter{}
+}
+
+// Event is a no-op, the bar only shows the state
+func (r *BarReporter) Event(Event) {}
+
+// Update redraws the bar, the first update of a run creates it
+func (r *BarReporter) Update(completed, total int, description string) {
+	if r.bar == nil {
+		r.bar = progressbar.Default(int64(total))
+	}
+	if r.bar.GetMax() != total {
+		r.bar.ChangeMax(total)
+	}
+	_ = r.bar.Set(completed)
+	r.bar.Describe(description)
+}
+
+// Close lets the next run start a new bar
+func (r *BarReporter) Close() {
+	r.bar = nil
+}
+
+// TextReporter writes a line per event, readable in log files and CI output
+type TextReporter struct {
+	w         io.Writer
+	completed int
+	total     int
+	// step is the last 10% step printed per file, progress events in between are left out
+	step map[string]int
+}
+
+// NewTextReporter creates a reporter writing plain lines to w
+func NewTextReporter(w io.Writer) *TextReporter {
+	return &TextReporter{w: w, step: make(map[string]int)}
+}
+
+// Event writes the line for an event
+func (r *TextReporter) Event(event Event) {
+	var line string
+	switch event.Type {
+	case EventFileStarted:
+		delete(r.step, event.File)
+		line = fmt.Sprintf("%s: started", event.File)
+	case EventStageChanged:
+		line = fmt.Sprintf("%s: %s", event.File, event.Stage)
+	case EventProgress:
+		if event.Progress == nil {
+			return
+		}
+		step := int(event.Progress.Percent / 10)
+		if last, ok := r.step[event.File]; ok && step <= last {
+			return
+		}
+		r.step[event.File] = step
+		line = fmt.Sprintf("%s: %s %s", event.File, event.Stage, event.Progress)
+	case EventFileFinished:
+		delete(r.step, event.File)
+		line = fmt.Sprintf("%s: %s in %s", event.File, event.Status,
+			(time.Duration(event.DurationSeconds * float64(time.Second))).Round(time.Millisecond))
+	default:
+		return
+	}
+	_, _ = fmt.Fprintf(r.w, "%s [%d/%d] %s\n", event.Time.Format(time.TimeOnly), r.completed, r.total, line)
+}
+
+// Update keeps the counts for the next line
+func (r *TextReporter) Update(completed, total int, _ string) {
+	r.completed = completed
+	r.total = total
+}
+
+// Close is a no-op, every line is written as it happens
+func (r *TextReporter) Close() {}
+
+// JSONReporter writes every event as a line of JSON (NDJSON) for other programs to follow
+type JSONReporter struct {
+	encoder *json.Encoder
+}
+
+// NewJSONReporter creates a reporter writing NDJSON events to w
+func NewJSONReporter(w io.Writer) *JSONReporter {
+	return &JSONReporter{encoder: json.NewEncoder(w)}
+}
+
+// Event writes the event as one line
+func (r *JSONReporter) Event(event Event) {
+	_ = r.encoder.Encode(event)
+}
+
+// Update is a no-op, the events carry everything
+func (r *JSONReporter) Update(int, int, string) {}
+
+// Close is a no-op, every event is written as it happens
+func (r *JSONReporter) Close() {}
+
+// SilentReporter shows nothing, e.g. when listeners or the API report instead
+type SilentReporter struct{}
+
+// NewSilentReporter creates a reporter that shows nothing
+func NewSilentReporter() SilentReporter {
+	return SilentReporter{}
+}
+
+// Event is a no-op
+func (SilentReporter) Event(Event) {}
+
+// Update is a no-op
+func (SilentReporter) Update(int, int, string) {}
+
+// Close is a no-op
+func (SilentReporter) Close() {}
@@ -0,0 +1,98 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReporter(t *testing.T) {
+	testCases := []struct {
+		kind     string
+		expected Reporter
+	}{
+		{kind: ReporterBar, expected: &BarReporter{}},
+		{kind: ReporterText, expected: &TextReporter{}},
+		{kind: ReporterJSON, expected: &JSONReporter{}},
+		{kind: ReporterSilent, expected: SilentReporter{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.kind, func(t *testing.T) {
+			reporter, err := NewReporter(tc.kind)
+			assert.NoError(t, err)
+			assert.IsType(t, tc.expected, reporter)
+		})
+	}
+
+	// stderr is not a terminal under go test
+	reporter, err := NewReporter(ReporterAuto)
+	assert.NoError(t, err)
+	assert.NotNil(t, reporter)
+
+	_, err = NewReporter("fancy")
+	assert.Error(t, err)
+}
+
+func TestTextReporter(t *testing.T) {
+	var out bytes.Buffer
+	tracker := NewProgressTrackerWithReporter(2, NewTextReporter(&out))
+
+	tracker.UpdateStage("/path/to/file1.mkv", StageProcess)
+	tracker.UpdateProgress("/path/to/file1.mkv", Progress{Percent: 12})
+	tracker.UpdateProgress("/path/to/file1.mkv", Progress{Percent: 15})
+	tracker.UpdateProgress("/path/to/file1.mkv", Progress{Percent: 21})
+	tracker.CompleteFile("/path/to/file1.mkv")
+	tracker.AppendResult(&ProcessResult{FilePath: "/path/to/file1.mkv", Status: StatusSuccess})
+	tracker.Finish()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 5)
+	assert.Contains(t, lines[0], "[0/2] /path/to/file1.mkv: started")
+	assert.Contains(t, lines[1], "/path/to/file1.mkv: Process")
+	// only the first progress event of every 10% step is written
+	assert.Contains(t, lines[2], "Process 12%")
+	assert.Contains(t, lines[3], "Process 21%")
+	assert.Contains(t, lines[4], "[1/2] /path/to/file1.mkv: Success in ")
+}
+
+func TestJSONReporter(t *testing.T) {
+	var out bytes.Buffer
+	tracker := NewProgressTrackerWithReporter(1, NewJSONReporter(&out))
+
+	tracker.UpdateStage("/path/to/file1.mkv", StageProcess)
+	tracker.UpdateProgress("/path/to/file1.mkv", Progress{Percent: 50, Speed: 2})
+	tracker.CompleteFile("/path/to/file1.mkv")
+	tracker.AppendResult(&ProcessResult{FilePath: "/path/to/file1.mkv", Status: StatusFFmpegError})
+
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var event Event
+		assert.NoError(t, json.Unmarshal([]byte(line), &event))
+		events = append(events, event)
+	}
+	assert.Len(t, events, 4)
+	assert.Equal(t, EventFileStarted, events[0].Type)
+	assert.Equal(t, EventStageChanged, events[1].Type)
+	assert.Equal(t, EventProgress, events[2].Type)
+	assert.Equal(t, 50.0, events[2].Progress.Percent)
+	assert.Equal(t, EventFileFinished, events[3].Type)
+	assert.Equal(t, "FFmpegError", events[3].Status)
+	assert.GreaterOrEqual(t, events[3].DurationSeconds, 0.0)
+	assert.False(t, events[3].Time.IsZero())
+}
+
+func TestBarReporter(t *testing.T) {
+	reporter := NewBarReporter()
+	tracker := NewProgressTrackerWithReporter(1, reporter)
+	assert.NotNil(t, reporter.bar)
+
+	tracker.Requeue()
+	assert.Equal(t, 2, reporter.bar.GetMax())
+
+	// the next run starts a new bar
+	tracker.Finish()
+	assert.Nil(t, reporter.bar)
+}
@@ -1,5 +1,12 @@
 package tracker
 
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
 type ProcessStatus int
 
 const (
@@ -13,6 +20,9 @@ const (
 	StatusNetworkError // For those temporary blips
 	StatusUnknownError
 	StatusSkipped
+	StatusUnsupportedContainer // the container cannot store tags at all
+	StatusTimeout              // a stage or the whole file ran past its deadline
+	StatusInsufficientSpace    // the backup and the new file can never fit on the filesystem
 )
 
 func (ps ProcessStatus) String() string {
@@ -37,79 +47,145 @@ func (ps ProcessStatus) String() string {
 		return "UnknownError"
 	case StatusSkipped:
 		return "Skipped"
+	case StatusUnsupportedContainer:
+		return "UnsupportedContainer"
+	case StatusTimeout:
+		return "Timeout"
+	case StatusInsufficientSpace:
+		return "InsufficientSpace"
 	default:
 		return "UnknownStatus"
 	}
 }
 
-// ProcessResult contains the result of processing a file
+// ParseStatus looks up a status by the name String gives it, ignoring case
+func ParseStatus(name string) (ProcessStatus, bool) {
+	for status := StatusSuccess; status <= StatusInsufficientSpace; status++ {
+		if strings.EqualFold(status.String(), name) {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+// TagChange describes a single tag that differs between the file and its NFO
+type TagChange struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// ProcessResult contains the result of processing a file, it serializes as its HumanReadableResult
 type ProcessResult struct {
-	FilePath string        `json:"file_path"`
-	Retries  int           `json:"retries,omitempty"` //to be used to determine if should retry this file
-	Status   ProcessStatus `json:"status"`
-	Success  bool          `json:"success"`
-	Error    error         `json:"error,omitempty"`
+	FilePath string
+	Retries  int //to be used to determine if should retry this file
+	Status   ProcessStatus
+	Success  bool
+	Error    error
+	Changes  []TagChange
+	// Container and DroppedKeys record the NFO keys the container cannot store
+	Container   string
+	DroppedKeys []string
+	// Attempts counts the runs of the file, retries included
+	Attempts int
+	// WorkerID is the worker that ran the last attempt
+	WorkerID int
+	NFOPath  string
+	// OutputPath is the file written, the converted file or the copy in the output directory
+	OutputPath string
+	// InputSize is the size of the file before, OutputSize of the file written
+	InputSize  int64
+	OutputSize int64
+	// TagsBefore and TagsWritten are the global tags of a rewritten file before and the tags ffmpeg was given
+	TagsBefore  map[string]string
+	TagsWritten map[string]string
+	// FFmpegExitCode is nil when ffmpeg did not run
+	FFmpegExitCode *int
+	// Started, Duration and Stages time the last attempt, Stages by tracker stage
+	Started  time.Time
+	Duration time.Duration
+	Stages   map[string]time.Duration
 }
 
 type HumanReadableResult struct {
-	FilePath string `json:"file_path"`
-	Retries  int    `json:"retries,omitempty"`
-	Status   string `json:"status"`
-	Success  bool   `json:"success"`
-	Error    string `json:"error,omitempty"`
+	FilePath string      `json:"file_path"`
+	Retries  int         `json:"retries,omitempty"`
+	Status   string      `json:"status"`
+	Success  bool        `json:"success"`
+	Error    string      `json:"error,omitempty"`
+	Changes  []TagChange `json:"changes,omitempty"`
+	// Container and DroppedKeys record the NFO keys the container cannot store
+	Container       string             `json:"container,omitempty"`
+	DroppedKeys     []string           `json:"dropped_keys,omitempty"`
+	Attempts        int                `json:"attempts,omitempty"`
+	WorkerID        int                `json:"worker_id"`
+	NFOPath         string             `json:"nfo_path,omitempty"`
+	OutputPath      string             `json:"output_path,omitempty"`
+	InputSize       int64              `json:"input_size,omitempty"`
+	OutputSize      int64              `json:"output_size,omitempty"`
+	TagsBefore      map[string]string  `json:"tags_before,omitempty"`
+	TagsWritten     map[string]string  `json:"tags_written,omitempty"`
+	FFmpegExitCode  *int               `json:"ffmpeg_exit_code,omitempty"`
+	Started         time.Time          `json:"started,omitzero"`
+	DurationSeconds float64            `json:"duration_seconds,omitempty"`
+	StageSeconds    map[string]float64 `json:"stage_seconds,omitempty"`
 }
 
 func (r *ProcessResult) WithRetries(retries int) *ProcessResult {
-	return &ProcessResult{
-		FilePath: r.FilePath,
-		Status:   r.Status,
-		Success:  r.Success,
-		Error:    r.Error,
-		Retries:  retries,
-	}
+	result := *r
+	result.Retries = retries
+	result.Attempts = retries + 1
+	return &result
+}
+
+// WithWorker records the worker that ran the attempt
+func (r *ProcessResult) WithWorker(id int) *ProcessResult {
+	result := *r
+	result.WorkerID = id
+	return &result
+}
+
+// WithTimings records when the attempt started, how long it took and how long each stage took
+func (r *ProcessResult) WithTimings(started time.Time, duration time.Duration, stages map[string]time.Duration) *ProcessResult {
+	result := *r
+	result.Started = started
+	result.Duration = duration
+	result.Stages = stages
+	return &result
 }
 
 //add granular Withs for fields - can extend existing with WithStatus
 //consider refactor of WithResult to maintain one-shot but add Status
 
 func (r *ProcessResult) WithResult(success bool, err error) *ProcessResult {
-	return &ProcessResult{
-		FilePath: r.FilePath,
-		Status:   r.Status,
-		Success:  success,
-		Error:    err,
-		Retries:  r.Retries,
-	}
+	result := *r
+	result.Success = success
+	result.Error = err
+	return &result
 }
 
 func (r *ProcessResult) WithStatus(status ProcessStatus) *ProcessResult {
-	return &ProcessResult{
-		FilePath: r.FilePath,
-		Status:   status,
-		Success:  r.Success,
-		Error:    r.Error,
-		Retries:  r.Retries,
-	}
+	result := *r
+	result.Status = status
+	return &result
 }
 
 func (r *ProcessResult) WithSuccess(success bool) *ProcessResult {
-	return &ProcessResult{
-		FilePath: r.FilePath,
-		Status:   r.Status,
-		Success:  success,
-		Error:    r.Error,
-		Retries:  r.Retries,
-	}
+	result := *r
+	result.Success = success
+	return &result
 }
 
 func (r *ProcessResult) WithError(err error) *ProcessResult {
-	return &ProcessResult{
-		FilePath: r.FilePath,
-		Status:   r.Status,
-		Success:  r.Success,
-		Error:    err,
-		Retries:  r.Retries,
-	}
+	result := *r
+	result.Error = err
+	return &result
+}
+
+func (r *ProcessResult) WithChanges(changes []TagChange) *ProcessResult {
+	result := *r
+	result.Changes = changes
+	return &result
 }
 
 func (r *ProcessResult) MakeHumanReadable() *HumanReadableResult {
@@ -119,11 +195,92 @@ func (r *ProcessResult) MakeHumanReadable() *HumanReadableResult {
 		errorString = r.Error.Error()
 	}
 
+	var stageSeconds map[string]float64
+	if len(r.Stages) > 0 {
+		stageSeconds = make(map[string]float64, len(r.Stages))
+		for stage, duration := range r.Stages {
+			stageSeconds[stage] = duration.Seconds()
+		}
+	}
+
 	return &HumanReadableResult{
-		FilePath: r.FilePath,
-		Retries:  r.Retries,
-		Status:   statusString,
-		Success:  r.Success,
-		Error:    errorString,
+		FilePath:        r.FilePath,
+		Retries:         r.Retries,
+		Status:          statusString,
+		Success:         r.Success,
+		Error:           errorString,
+		Changes:         r.Changes,
+		Container:       r.Container,
+		DroppedKeys:     r.DroppedKeys,
+		Attempts:        r.Attempts,
+		WorkerID:        r.WorkerID,
+		NFOPath:         r.NFOPath,
+		OutputPath:      r.OutputPath,
+		InputSize:       r.InputSize,
+		OutputSize:      r.OutputSize,
+		TagsBefore:      r.TagsBefore,
+		TagsWritten:     r.TagsWritten,
+		FFmpegExitCode:  r.FFmpegExitCode,
+		Started:         r.Started,
+		DurationSeconds: r.Duration.Seconds(),
+		StageSeconds:    stageSeconds,
+	}
+}
+
+// ProcessResult turns a stored result back into a result, an unknown status becomes UnknownError
+func (h *HumanReadableResult) ProcessResult() *ProcessResult {
+	status, ok := ParseStatus(h.Status)
+	if !ok {
+		status = StatusUnknownError
+	}
+	var err error
+	if h.Error != "" {
+		err = errors.New(h.Error)
+	}
+	var stages map[string]time.Duration
+	if len(h.StageSeconds) > 0 {
+		stages = make(map[string]time.Duration, len(h.StageSeconds))
+		for stage, seconds := range h.StageSeconds {
+			stages[stage] = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	return &ProcessResult{
+		FilePath:       h.FilePath,
+		Retries:        h.Retries,
+		Status:         status,
+		Success:        h.Success,
+		Error:          err,
+		Changes:        h.Changes,
+		Container:      h.Container,
+		DroppedKeys:    h.DroppedKeys,
+		Attempts:       h.Attempts,
+		WorkerID:       h.WorkerID,
+		NFOPath:        h.NFOPath,
+		OutputPath:     h.OutputPath,
+		InputSize:      h.InputSize,
+		OutputSize:     h.OutputSize,
+		TagsBefore:     h.TagsBefore,
+		TagsWritten:    h.TagsWritten,
+		FFmpegExitCode: h.FFmpegExitCode,
+		Started:        h.Started,
+		Duration:       time.Duration(h.DurationSeconds * float64(time.Second)),
+		Stages:         stages,
+	}
+}
+
+// MarshalJSON writes the result as its HumanReadableResult - an error has no fields of its own
+// and would marshal to {}
+func (r ProcessResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.MakeHumanReadable())
+}
+
+// UnmarshalJSON reads a result written by MarshalJSON
+func (r *ProcessResult) UnmarshalJSON(data []byte) error {
+	var human HumanReadableResult
+	if err := json.Unmarshal(data, &human); err != nil {
+		return err
 	}
+	*r = *human.ProcessResult()
+	return nil
 }
@@ -1,8 +1,10 @@
 package tracker
 
 import (
+	"encoding/json"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -36,3 +38,80 @@ func TestProcessResult_WithResult(t *testing.T) {
 	assert.False(t, newResult.Success)
 	assert.Equal(t, testErr, newResult.Error)
 }
+
+func TestParseStatus(t *testing.T) {
+	for status := StatusSuccess; status <= StatusInsufficientSpace; status++ {
+		parsed, ok := ParseStatus(status.String())
+		assert.True(t, ok)
+		assert.Equal(t, status, parsed)
+	}
+
+	parsed, ok := ParseStatus("cleanuperror")
+	assert.True(t, ok)
+	assert.Equal(t, StatusCleanupError, parsed)
+
+	_, ok = ParseStatus("Exploded")
+	assert.False(t, ok)
+}
+
+func TestProcessResult_JSON(t *testing.T) {
+	exitCode := 1
+	result := &ProcessResult{
+		FilePath:       "/tv/Show/ep1.mkv",
+		Retries:        1,
+		Attempts:       2,
+		Status:         StatusFFmpegError,
+		Error:          errors.New("exit status 1"),
+		WorkerID:       3,
+		NFOPath:        "/tv/Show/ep1.nfo",
+		OutputPath:     "/out/Show/ep1.mkv",
+		InputSize:      1000,
+		TagsBefore:     map[string]string{"title": "Old"},
+		TagsWritten:    map[string]string{"title": "New"},
+		FFmpegExitCode: &exitCode,
+		Started:        time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC),
+		Duration:       1500 * time.Millisecond,
+		Stages:         map[string]time.Duration{StageProcess: time.Second, StageBackup: 500 * time.Millisecond},
+	}
+
+	data, err := json.Marshal(result)
+
+	assert.NoError(t, err)
+	// the error is its message, not {}
+	assert.JSONEq(t, `{
+		"file_path": "/tv/Show/ep1.mkv",
+		"retries": 1,
+		"attempts": 2,
+		"status": "FFmpegError",
+		"success": false,
+		"error": "exit status 1",
+		"worker_id": 3,
+		"nfo_path": "/tv/Show/ep1.nfo",
+		"output_path": "/out/Show/ep1.mkv",
+		"input_size": 1000,
+		"tags_before": {"title": "Old"},
+		"tags_written": {"title": "New"},
+		"ffmpeg_exit_code": 1,
+		"started": "2025-01-02T15:04:05Z",
+		"duration_seconds": 1.5,
+		"stage_seconds": {"Process": 1, "Backup": 0.5}
+	}`, string(data))
+
+	var decoded ProcessResult
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "exit status 1", decoded.Error.Error())
+	decoded.Error = result.Error
+	assert.Equal(t, *result, decoded)
+
+	// a plain result leaves out what it does not know, a value marshals the same as a pointer
+	data, err = json.Marshal(ProcessResult{FilePath: "/tv/Show/ep2.mkv", Status: StatusSkipped, Success: true})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"file_path": "/tv/Show/ep2.mkv", "status": "Skipped", "success": true, "worker_id": 0}`, string(data))
+}
+
+func TestProcessResult_WithRetries(t *testing.T) {
+	result := (&ProcessResult{FilePath: "a.mkv"}).WithRetries(2)
+
+	assert.Equal(t, 2, result.Retries)
+	assert.Equal(t, 3, result.Attempts)
+}
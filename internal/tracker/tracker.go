@@ -3,19 +3,73 @@ package tracker
 import (
 	"fmt"
 	//"github.com/bmj2728/go-vmu/internal/pool"
-	"github.com/schollz/progressbar/v3"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
 // Define stages for better tracking
 const (
-	StageBackup   = "Backup"
-	StageProcess  = "Process"
-	StageValidate = "Validate"
-	StageCleanup  = "Cleanup"
+	StageWaitSlot  = "WaitSlot"
+	StageWaitSpace = "WaitSpace"
+	StageScratch   = "Scratch"
+	StageBackup    = "Backup"
+	StageProcess   = "Process"
+	StageValidate  = "Validate"
+	StageCleanup   = "Cleanup"
 )
 
+// Event types emitted to listeners
+const (
+	EventFileStarted  = "file_started"
+	EventStageChanged = "stage_changed"
+	EventFileFinished = "file_finished"
+	EventProgress     = "progress"
+)
+
+// Event describes a change in a file's progress
+type Event struct {
+	Type   string `json:"type"`
+	File   string `json:"file"`
+	Stage  string `json:"stage,omitempty"`
+	Status string `json:"status,omitempty"`
+	// Progress is set on progress events
+	Progress *Progress `json:"progress,omitempty"`
+	// DurationSeconds is how long the attempt took, set on file_finished events
+	DurationSeconds float64   `json:"duration_seconds,omitempty"`
+	Time            time.Time `json:"time"`
+}
+
+// Progress is how far the remux of a file got
+type Progress struct {
+	// Percent of the file's duration written so far
+	Percent float64 `json:"percent"`
+	// Speed as a multiple of realtime
+	Speed float64 `json:"speed,omitempty"`
+	// BytesPerSecond is the average write throughput
+	BytesPerSecond float64 `json:"bytes_per_second,omitempty"`
+	// ETASeconds is the estimated time left
+	ETASeconds float64 `json:"eta_seconds,omitempty"`
+}
+
+// String renders the progress for the progress bar, e.g. "42% 3.1x 85MB/s ETA 2m10s"
+func (p Progress) String() string {
+	s := fmt.Sprintf("%.0f%%", p.Percent)
+	if p.Speed > 0 {
+		s += fmt.Sprintf(" %.1fx", p.Speed)
+	}
+	if p.BytesPerSecond > 0 {
+		s += fmt.Sprintf(" %.1fMB/s", p.BytesPerSecond/(1<<20))
+	}
+	if p.ETASeconds > 0 {
+		s += " ETA " + (time.Duration(p.ETASeconds) * time.Second).String()
+	}
+	return s
+}
+
+// Listener receives progress events - listeners are called synchronously and should not block
+type Listener func(Event)
+
 // Progress tracking structure
 type ProgressTracker struct {
 	totalFiles     int
@@ -23,22 +77,54 @@ type ProgressTracker struct {
 	currentFiles   map[string]*FileProgress
 	Results        []*ProcessResult
 	mu             sync.Mutex
-	bar            *progressbar.ProgressBar
+	reporter       Reporter
+	listeners      []Listener
+	// finished holds the stage timings of completed files until the worker takes them
+	finished map[string]map[string]time.Duration
 }
 
 type FileProgress struct {
 	filename string
 	stage    string
 	done     bool
+	// stages adds up the time spent in each stage, the current one since stageStarted
+	stages       map[string]time.Duration
+	stageStarted time.Time
+	// progress of the remux, nil outside of the process stage
+	progress *Progress
 }
 
-// Create a new progress tracker
+// Create a new progress tracker drawing a progress bar
 func NewProgressTracker(totalFiles int) *ProgressTracker {
-	return &ProgressTracker{
+	return NewProgressTrackerWithReporter(totalFiles, NewBarReporter())
+}
+
+// NewProgressTrackerWithReporter creates a progress tracker that shows its progress through reporter
+func NewProgressTrackerWithReporter(totalFiles int, reporter Reporter) *ProgressTracker {
+	p := &ProgressTracker{
 		totalFiles:   totalFiles,
 		currentFiles: make(map[string]*FileProgress),
-		bar:          progressbar.Default(int64(totalFiles)),
+		reporter:     reporter,
+		finished:     make(map[string]map[string]time.Duration),
+	}
+	p.updateDescription()
+	return p
+}
+
+// AddListener registers a listener for progress events
+func (p *ProgressTracker) AddListener(listener Listener) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listeners = append(p.listeners, listener)
+}
+
+// emit sends an event to all listeners, callers must hold the lock
+func (p *ProgressTracker) emit(event Event) {
+	event.Time = time.Now()
+	for _, listener := range p.listeners {
+		listener(event)
 	}
+	p.reporter.Event(event)
 }
 
 // Update stage for a file
@@ -46,20 +132,42 @@ func (p *ProgressTracker) UpdateStage(filename, stage string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	now := time.Now()
 	if progress, exists := p.currentFiles[filename]; exists {
+		progress.stages[progress.stage] += now.Sub(progress.stageStarted)
 		progress.stage = stage
+		progress.stageStarted = now
+		progress.progress = nil
 	} else {
 		p.currentFiles[filename] = &FileProgress{
-			filename: filename,
-			stage:    stage,
-			done:     false,
+			filename:     filename,
+			stage:        stage,
+			done:         false,
+			stages:       make(map[string]time.Duration),
+			stageStarted: now,
 		}
+		p.emit(Event{Type: EventFileStarted, File: filename})
 	}
+	p.emit(Event{Type: EventStageChanged, File: filename, Stage: stage})
 
 	// Update description to show active files and their stages
 	p.updateDescription()
 }
 
+// UpdateProgress records how far the remux of a file got
+func (p *ProgressTracker) UpdateProgress(filename string, progress Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	file, exists := p.currentFiles[filename]
+	if !exists {
+		return
+	}
+	file.progress = &progress
+	p.emit(Event{Type: EventProgress, File: filename, Stage: file.stage, Progress: &progress})
+	p.updateDescription()
+}
+
 // Mark a file as complete
 func (p *ProgressTracker) CompleteFile(filename string) {
 	p.mu.Lock()
@@ -67,18 +175,42 @@ func (p *ProgressTracker) CompleteFile(filename string) {
 
 	if progress, exists := p.currentFiles[filename]; exists {
 		progress.done = true
+		progress.stages[progress.stage] += time.Since(progress.stageStarted)
+		p.finished[filename] = progress.stages
 		delete(p.currentFiles, filename) // Remove from active tracking
 	}
 
 	p.completedFiles++
-	err := p.bar.Add(1)
-	if err != nil {
-		return
-	}
 	p.updateDescription()
 }
 
-// Update the progress bar description to show active files
+// Requeue adds another attempt of a file to the total once a failure is scheduled for a retry
+func (p *ProgressTracker) Requeue() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.totalFiles++
+	p.updateDescription()
+}
+
+// StageTimings returns how long a completed file spent in each stage and forgets them, nil when the
+// file finished before its first stage
+func (p *ProgressTracker) StageTimings(filename string) map[string]time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stages := p.finished[filename]
+	delete(p.finished, filename)
+	return stages
+}
+
+// Finish ends the reporter's output once the run is over
+func (p *ProgressTracker) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reporter.Close()
+}
+
+// Hand the counts and a description of the active files to the reporter
 func (p *ProgressTracker) updateDescription() {
 	// Build description showing active files (limit to 2-3 to avoid clutter)
 	desc := fmt.Sprintf("%d/%d complete", p.completedFiles, p.totalFiles)
@@ -87,6 +219,9 @@ func (p *ProgressTracker) updateDescription() {
 	for _, progress := range p.currentFiles {
 		if activeCount < 3 { // Show max 3 active files
 			desc += fmt.Sprintf("\n%s: %s", filepath.Base(progress.filename), progress.stage)
+			if progress.progress != nil {
+				desc += " " + progress.progress.String()
+			}
 			activeCount++
 		}
 	}
@@ -95,9 +230,12 @@ func (p *ProgressTracker) updateDescription() {
 		desc += fmt.Sprintf(" (+ %d more)", len(p.currentFiles)-3)
 	}
 
-	p.bar.Describe(desc)
+	p.reporter.Update(p.completedFiles, p.totalFiles, desc)
 }
 
 func (p *ProgressTracker) AppendResult(result *ProcessResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.Results = append(p.Results, result)
+	p.emit(Event{Type: EventFileFinished, File: result.FilePath, Status: result.Status.String(), DurationSeconds: result.Duration.Seconds()})
 }
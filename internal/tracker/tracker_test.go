@@ -2,6 +2,7 @@ package tracker
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -35,7 +36,7 @@ func TestNewProgressTracker(t *testing.T) {
 			assert.Equal(t, 0, tracker.completedFiles)
 			assert.NotNil(t, tracker.currentFiles)
 			assert.Empty(t, tracker.currentFiles)
-			assert.NotNil(t, tracker.bar)
+			assert.IsType(t, &BarReporter{}, tracker.reporter)
 		})
 	}
 }
@@ -152,4 +153,77 @@ func TestProgressTracker_updateDescription(t *testing.T) {
 		tracker.updateDescription()
 		// We can't easily verify the description, but at least ensure it doesn't panic
 	})
-}
\ No newline at end of file
+}
+
+func TestProgressTracker_Listeners(t *testing.T) {
+	tracker := NewProgressTracker(1)
+	var events []Event
+	tracker.AddListener(func(event Event) {
+		events = append(events, event)
+	})
+
+	tracker.UpdateStage("/path/to/file1.mkv", StageBackup)
+	tracker.UpdateStage("/path/to/file1.mkv", StageProcess)
+	tracker.CompleteFile("/path/to/file1.mkv")
+	tracker.AppendResult(&ProcessResult{FilePath: "/path/to/file1.mkv", Status: StatusSuccess})
+
+	assert.Len(t, events, 4)
+	assert.Equal(t, EventFileStarted, events[0].Type)
+	assert.Equal(t, EventStageChanged, events[1].Type)
+	assert.Equal(t, StageBackup, events[1].Stage)
+	assert.Equal(t, StageProcess, events[2].Stage)
+	assert.Equal(t, EventFileFinished, events[3].Type)
+	assert.Equal(t, "Success", events[3].Status)
+	assert.False(t, events[3].Time.IsZero())
+}
+
+func TestProgressTracker_UpdateProgress(t *testing.T) {
+	tracker := NewProgressTracker(1)
+	var events []Event
+	tracker.AddListener(func(event Event) {
+		events = append(events, event)
+	})
+
+	// unknown files are ignored
+	tracker.UpdateProgress("/path/to/other.mkv", Progress{Percent: 10})
+	assert.Empty(t, events)
+
+	tracker.UpdateStage("/path/to/file1.mkv", StageProcess)
+	tracker.UpdateProgress("/path/to/file1.mkv", Progress{Percent: 42, Speed: 3.1})
+
+	assert.Len(t, events, 3)
+	assert.Equal(t, EventProgress, events[2].Type)
+	assert.Equal(t, StageProcess, events[2].Stage)
+	assert.Equal(t, 42.0, events[2].Progress.Percent)
+	assert.NotNil(t, tracker.currentFiles["/path/to/file1.mkv"].progress)
+
+	// a new stage drops the progress of the previous one
+	tracker.UpdateStage("/path/to/file1.mkv", StageValidate)
+	assert.Nil(t, tracker.currentFiles["/path/to/file1.mkv"].progress)
+}
+
+func TestProgress_String(t *testing.T) {
+	assert.Equal(t, "0%", Progress{}.String())
+	assert.Equal(t, "42% 3.1x 85.0MB/s ETA 2m10s",
+		Progress{Percent: 42, Speed: 3.1, BytesPerSecond: 85 << 20, ETASeconds: 130.4}.String())
+}
+
+func TestProgressTracker_StageTimings(t *testing.T) {
+	tracker := NewProgressTrackerWithReporter(1, NewSilentReporter())
+
+	tracker.UpdateStage("/path/to/file1.mkv", StageBackup)
+	time.Sleep(10 * time.Millisecond)
+	tracker.UpdateStage("/path/to/file1.mkv", StageProcess)
+	tracker.UpdateStage("/path/to/file1.mkv", StageBackup)
+	tracker.CompleteFile("/path/to/file1.mkv")
+
+	stages := tracker.StageTimings("/path/to/file1.mkv")
+	assert.Len(t, stages, 2)
+	// time spent in a stage twice adds up
+	assert.GreaterOrEqual(t, stages[StageBackup], 10*time.Millisecond)
+	assert.Contains(t, stages, StageProcess)
+
+	// the timings are handed out once
+	assert.Nil(t, tracker.StageTimings("/path/to/file1.mkv"))
+	assert.Nil(t, tracker.StageTimings("/path/to/unknown.mkv"))
+}
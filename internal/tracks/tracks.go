@@ -0,0 +1,261 @@
+package tracks
+
+import (
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/utils"
+	"gopkg.in/vansante/go-ffprobe.v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Track kinds match the ffprobe codec_type of the stream they become
+const (
+	KindSubtitle = "subtitle"
+	KindAudio    = "audio"
+)
+
+// SubtitleExtensions are the subtitle sidecars that can be muxed, .sup is image based (PGS)
+var SubtitleExtensions = []string{".srt", ".ass", ".ssa", ".vtt", ".sup"}
+
+// AudioExtensions are the external audio tracks that can be muxed
+var AudioExtensions = []string{".ac3", ".eac3", ".dts", ".aac", ".flac", ".mka", ".m4a", ".mp3", ".opus"}
+
+// Config controls muxing of subtitle and audio sidecars
+type Config struct {
+	Enabled bool `toml:"enabled"`
+	// ArchiveDir receives the sidecars once they are muxed - a relative path is a folder next to the
+	// video, an absolute path mirrors the input tree. Empty leaves the sidecars in place.
+	ArchiveDir string `toml:"archive_dir"`
+}
+
+// Track is a subtitle or audio sidecar and the flags parsed from its name
+// example: Episode.en.forced.srt, Episode.commentary.ac3
+type Track struct {
+	Path            string
+	Kind            string
+	Language        string
+	Title           string
+	Default         bool
+	Forced          bool
+	HearingImpaired bool
+	Commentary      bool
+}
+
+// languages maps ISO 639-1 codes to the ISO 639-2/B codes Matroska uses
+var languages = map[string]string{
+	"ar": "ara", "cs": "cze", "da": "dan", "de": "ger", "el": "gre", "en": "eng", "es": "spa",
+	"fi": "fin", "fr": "fre", "he": "heb", "hi": "hin", "hu": "hun", "id": "ind", "it": "ita",
+	"ja": "jpn", "ko": "kor", "nl": "dut", "no": "nor", "pl": "pol", "pt": "por", "ro": "rum",
+	"ru": "rus", "sv": "swe", "th": "tha", "tr": "tur", "uk": "ukr", "vi": "vie", "zh": "chi",
+}
+
+// language returns the ISO 639-2 code for a filename token such as "en", "eng" or "pt-BR"
+func language(token string) (string, bool) {
+	token = strings.ToLower(token)
+	if code, ok := languages[strings.SplitN(token, "-", 2)[0]]; ok {
+		return code, true
+	}
+	for _, code := range languages {
+		if token == code {
+			return code, true
+		}
+	}
+	return "", token == "und"
+}
+
+// Parse reads a sidecar name that belongs to videoPath. The name has to be the video's base name
+// followed by dot separated tokens - a language, "default", "forced", "sdh"/"cc", "commentary"
+// or free text that becomes the track title. "hi" is read as Hindi, not as hearing impaired.
+func Parse(videoPath string, sidecarPath string) (Track, bool) {
+	video := filepath.Base(videoPath)
+	base := strings.TrimSuffix(video, filepath.Ext(video))
+	name := filepath.Base(sidecarPath)
+	ext := strings.ToLower(filepath.Ext(name))
+
+	track := Track{Path: sidecarPath}
+	switch {
+	case contains(SubtitleExtensions, ext):
+		track.Kind = KindSubtitle
+	case contains(AudioExtensions, ext):
+		track.Kind = KindAudio
+	default:
+		return Track{}, false
+	}
+
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	if stem != base && !strings.HasPrefix(stem, base+".") {
+		return Track{}, false
+	}
+	var title []string
+	for _, token := range strings.Split(strings.TrimPrefix(stem, base), ".") {
+		if token == "" {
+			continue
+		}
+		switch strings.ToLower(token) {
+		case "default":
+			track.Default = true
+		case "forced", "foreign":
+			track.Forced = true
+		case "sdh", "cc":
+			track.HearingImpaired = true
+		case "commentary":
+			track.Commentary = true
+			title = append(title, "Commentary")
+		default:
+			if code, ok := language(token); ok && track.Language == "" {
+				track.Language = code
+				continue
+			}
+			title = append(title, token)
+		}
+	}
+	track.Title = strings.Join(title, " ")
+	return track, true
+}
+
+// Find returns the subtitle and audio sidecars next to a video
+func Find(videoPath string) ([]Track, error) {
+	dir := filepath.Dir(videoPath)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", dir, err)
+	}
+	var found []Track
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if track, ok := Parse(videoPath, filepath.Join(dir, entry.Name())); ok {
+			found = append(found, track)
+		}
+	}
+	return found, nil
+}
+
+// ImageBased reports whether the track is a bitmap subtitle that MP4 cannot store
+func (t Track) ImageBased() bool {
+	return strings.EqualFold(filepath.Ext(t.Path), ".sup")
+}
+
+// Disposition returns the value for ffmpeg's -disposition option
+func (t Track) Disposition() string {
+	var flags []string
+	if t.Default {
+		flags = append(flags, "default")
+	}
+	if t.Forced {
+		flags = append(flags, "forced")
+	}
+	if t.HearingImpaired {
+		flags = append(flags, "hearing_impaired")
+	}
+	if t.Commentary {
+		flags = append(flags, "comment")
+	}
+	if len(flags) == 0 {
+		return "0"
+	}
+	return strings.Join(flags, "+")
+}
+
+// Muxed reports whether a stream with the track's kind, language, title and flags already exists
+func (t Track) Muxed(streams []*ffprobe.Stream) bool {
+	for _, stream := range streams {
+		if t.matches(stream) {
+			return true
+		}
+	}
+	return false
+}
+
+// Written reports whether a stream carries the track as Matroska stores it, the default flag
+// included. Streams without a default track of their kind get the flag from the muxer, so it is
+// only required when the track asked for it.
+func (t Track) Written(streams []*ffprobe.Stream) bool {
+	for _, stream := range streams {
+		if t.matches(stream) && (!t.Default || stream.Disposition.Default == 1) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether a stream has the track's kind, language, title and forced, hearing
+// impaired and commentary flags. A track without a language or title only matches a stream
+// without one either.
+func (t Track) matches(stream *ffprobe.Stream) bool {
+	disposition := stream.Disposition
+	if stream.CodecType != t.Kind || (disposition.Forced == 1) != t.Forced ||
+		(disposition.HearingImpaired == 1) != t.HearingImpaired || (disposition.Comment == 1) != t.Commentary {
+		return false
+	}
+	language, _ := stream.TagList.GetString("language")
+	if strings.EqualFold(language, "und") {
+		language = ""
+	}
+	title, _ := stream.TagList.GetString("title")
+	return strings.EqualFold(language, t.Language) && title == t.Title
+}
+
+// String describes the track by its kind, language, title and disposition
+func (t Track) String() string {
+	description := t.Kind
+	if t.Language != "" {
+		description += " " + t.Language
+	}
+	if t.Title != "" {
+		description += fmt.Sprintf(" %q", t.Title)
+	}
+	return description + " (" + t.Disposition() + ")"
+}
+
+// Pending drops the tracks that are already part of the probed streams
+func Pending(found []Track, streams []*ffprobe.Stream) []Track {
+	var pending []Track
+	for _, track := range found {
+		if !track.Muxed(streams) {
+			pending = append(pending, track)
+		}
+	}
+	return pending
+}
+
+// Archive moves a muxed sidecar out of the way so it is not picked up again
+func Archive(track Track, inputRoot string, archiveDir string) (string, error) {
+	target := filepath.Join(filepath.Dir(track.Path), archiveDir, filepath.Base(track.Path))
+	if filepath.IsAbs(archiveDir) {
+		source := track.Path
+		if filepath.IsAbs(inputRoot) != filepath.IsAbs(source) {
+			inputRoot, _ = filepath.Abs(inputRoot)
+			source, _ = filepath.Abs(source)
+		}
+		rel, err := filepath.Rel(inputRoot, source)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = filepath.Base(track.Path)
+		}
+		target = filepath.Join(archiveDir, rel)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", fmt.Errorf("error creating archive directory: %w", err)
+	}
+	if err := os.Rename(track.Path, target); err != nil {
+		// the archive may be on another filesystem
+		if _, copyErr := utils.CopyFile(track.Path, target); copyErr != nil {
+			return "", fmt.Errorf("error archiving %s: %w", track.Path, copyErr)
+		}
+		if err := os.Remove(track.Path); err != nil {
+			return "", fmt.Errorf("error removing archived %s: %w", track.Path, err)
+		}
+	}
+	return target, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
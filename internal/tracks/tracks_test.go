@@ -0,0 +1,121 @@
+package tracks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+func TestParse(t *testing.T) {
+	video := "/tv/Episode.mkv"
+
+	track, ok := Parse(video, "/tv/Episode.en.forced.srt")
+	assert.True(t, ok)
+	assert.Equal(t, Track{Path: "/tv/Episode.en.forced.srt", Kind: KindSubtitle, Language: "eng", Forced: true}, track)
+
+	track, ok = Parse(video, "/tv/Episode.commentary.ac3")
+	assert.True(t, ok)
+	assert.Equal(t, KindAudio, track.Kind)
+	assert.True(t, track.Commentary)
+	assert.Equal(t, "Commentary", track.Title)
+
+	track, ok = Parse(video, "/tv/Episode.pt-BR.sdh.default.ass")
+	assert.True(t, ok)
+	assert.Equal(t, "por", track.Language)
+	assert.True(t, track.HearingImpaired)
+	assert.True(t, track.Default)
+
+	track, ok = Parse(video, "/tv/Episode.ger.Director Notes.srt")
+	assert.True(t, ok)
+	assert.Equal(t, "ger", track.Language)
+	assert.Equal(t, "Director Notes", track.Title)
+
+	track, ok = Parse(video, "/tv/Episode.srt")
+	assert.True(t, ok)
+	assert.Empty(t, track.Language)
+
+	// hi is Hindi, hearing impaired is sdh or cc
+	track, ok = Parse(video, "/tv/Episode.hi.srt")
+	assert.True(t, ok)
+	assert.Equal(t, "hin", track.Language)
+	assert.False(t, track.HearingImpaired)
+
+	// other episodes, other file types and the video itself are not tracks
+	for _, name := range []string{"/tv/Episode2.en.srt", "/tv/Episode.nfo", "/tv/Episode-thumb.jpg", "/tv/Episode.mkv"} {
+		_, ok = Parse(video, name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestTrack_Disposition(t *testing.T) {
+	assert.Equal(t, "0", Track{}.Disposition())
+	assert.Equal(t, "default+forced", Track{Default: true, Forced: true}.Disposition())
+	assert.Equal(t, "hearing_impaired+comment", Track{HearingImpaired: true, Commentary: true}.Disposition())
+}
+
+func TestPending(t *testing.T) {
+	streams := []*ffprobe.Stream{
+		{CodecType: "video"},
+		{CodecType: "subtitle", TagList: ffprobe.Tags{"language": "eng"}},
+	}
+	english := Track{Kind: KindSubtitle, Language: "eng"}
+	forced := Track{Kind: KindSubtitle, Language: "eng", Forced: true}
+	french := Track{Kind: KindSubtitle, Language: "fre"}
+
+	assert.Equal(t, []Track{forced, french}, Pending([]Track{english, forced, french}, streams))
+
+	// a stream that differs in any flag, title or language does not hold the sidecar
+	sdh := Track{Kind: KindSubtitle, Language: "eng", HearingImpaired: true}
+	untitled := Track{Kind: KindSubtitle}
+	titled := Track{Kind: KindSubtitle, Language: "eng", Title: "Signs"}
+	assert.Equal(t, []Track{sdh, untitled, titled}, Pending([]Track{sdh, untitled, titled}, streams))
+	assert.Empty(t, Pending([]Track{untitled}, []*ffprobe.Stream{{CodecType: "subtitle", TagList: ffprobe.Tags{"language": "und"}}}))
+}
+
+func TestTrack_Written(t *testing.T) {
+	streams := []*ffprobe.Stream{
+		{CodecType: "video", Disposition: ffprobe.StreamDisposition{Default: 1}},
+		{CodecType: "subtitle", TagList: ffprobe.Tags{"language": "eng", "title": "SDH"},
+			Disposition: ffprobe.StreamDisposition{Default: 1, HearingImpaired: 1}},
+		{CodecType: "subtitle", TagList: ffprobe.Tags{"language": "eng", "title": "Signs"}},
+	}
+
+	assert.True(t, Track{Kind: KindSubtitle, Language: "eng", Title: "SDH", HearingImpaired: true}.Written(streams))
+	assert.True(t, Track{Kind: KindSubtitle, Language: "eng", Title: "SDH", Default: true, HearingImpaired: true}.Written(streams))
+	// the stream counts as muxed, but lost the default flag it asked for
+	assert.True(t, Track{Kind: KindSubtitle, Language: "eng", Title: "Signs", Default: true}.Muxed(streams))
+	assert.False(t, Track{Kind: KindSubtitle, Language: "eng", Title: "Signs", Default: true}.Written(streams))
+	assert.False(t, Track{Kind: KindSubtitle, Language: "eng", Title: "SDH"}.Written(streams))
+	assert.False(t, Track{Kind: KindSubtitle, Language: "fre", Title: "SDH", HearingImpaired: true}.Written(streams))
+	assert.False(t, Track{Kind: KindSubtitle, Language: "eng", Title: "Signs", HearingImpaired: true}.Written(streams))
+}
+
+func TestTrack_String(t *testing.T) {
+	assert.Equal(t, `subtitle eng "Signs" (default+forced)`, Track{Kind: KindSubtitle, Language: "eng", Title: "Signs", Default: true, Forced: true}.String())
+	assert.Equal(t, "audio (0)", Track{Kind: KindAudio}.String())
+}
+
+func TestFindAndArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"Episode.mkv", "Episode.en.srt", "Episode.commentary.ac3", "Episode.nfo"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte("data"), 0644))
+	}
+
+	found, err := Find(filepath.Join(tmpDir, "Episode.mkv"))
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+
+	archived, err := Archive(found[0], tmpDir, ".muxed")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(tmpDir, ".muxed", filepath.Base(found[0].Path)), archived)
+	assert.FileExists(t, archived)
+	assert.NoFileExists(t, found[0].Path)
+
+	archiveRoot := t.TempDir()
+	archived, err = Archive(found[1], tmpDir, archiveRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(archiveRoot, filepath.Base(found[1].Path)), archived)
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SidecarExtensions are the files that travel with a video - metadata and artwork
+var SidecarExtensions = []string{".nfo", ".jpg", ".jpeg", ".png", ".webp", ".tbn"}
+
+// CopyFile copies src to dst, creating or truncating dst, and returns the bytes copied
+func CopyFile(src string, dst string) (int64, error) {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer func() {
+		if err := sourceFile.Close(); err != nil {
+			log.Debug().Err(err).Msgf("Error closing %s", src)
+		}
+	}()
+
+	info, err := sourceFile.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	destFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return 0, fmt.Errorf("failed to create destination file: %w", err)
+	}
+
+	copied, err := io.Copy(destFile, sourceFile)
+	if err != nil {
+		_ = destFile.Close()
+		return copied, fmt.Errorf("error copying file: %w", err)
+	}
+	if err := destFile.Close(); err != nil {
+		return copied, fmt.Errorf("error closing destination file: %w", err)
+	}
+	return copied, nil
+}
+
+// LinkOrCopyFile hardlinks src to dst, falling back to a copy when the link is not possible
+// (e.g. across filesystems). An existing dst is replaced.
+func LinkOrCopyFile(src string, dst string) error {
+	if err := os.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to replace %s: %w", dst, err)
+	}
+	err := os.Link(src, dst)
+	if err == nil {
+		return nil
+	}
+	log.Debug().Err(err).Msgf("Hardlink %s -> %s failed, copying instead", src, dst)
+	_, err = CopyFile(src, dst)
+	return err
+}
+
+// SidecarFiles returns the NFO and image files next to a video that share its base name
+// example: /tv/ep1.mkv -> /tv/ep1.nfo, /tv/ep1-thumb.jpg
+func SidecarFiles(path string) ([]string, error) {
+	dir, file := filepath.Split(path)
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", dir, err)
+	}
+	var sidecars []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == file || !strings.HasPrefix(name, base) {
+			continue
+		}
+		// only exact matches or base followed by a separator - ep1 must not pick up ep10.nfo
+		rest := strings.TrimPrefix(name, base)
+		if rest == "" || !strings.ContainsRune(".-_", rune(rest[0])) {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(name))
+		for _, sidecarExt := range SidecarExtensions {
+			if ext == sidecarExt {
+				sidecars = append(sidecars, filepath.Join(dir, name))
+				break
+			}
+		}
+	}
+	return sidecars, nil
+}
+
+// SidecarName returns the path of a sidecar of video once it belongs to newVideo. Sidecars named after
+// the whole file follow the new extension, the rest only follow the new base name.
+// example: /tv/ep1.avi.nfo -> /out/ep1.mkv.nfo, /tv/ep1-thumb.jpg -> /out/ep1-thumb.jpg
+func SidecarName(sidecar string, video string, newVideo string) string {
+	name := filepath.Base(sidecar)
+	oldFile, newFile := filepath.Base(video), filepath.Base(newVideo)
+	oldBase := strings.TrimSuffix(oldFile, filepath.Ext(oldFile))
+	newBase := strings.TrimSuffix(newFile, filepath.Ext(newFile))
+	rest := strings.TrimPrefix(name, oldFile)
+	if rest != name && rest != "" && strings.ContainsRune(".-_", rune(rest[0])) {
+		name = newFile + rest
+	} else if strings.HasPrefix(name, oldBase) {
+		name = newBase + strings.TrimPrefix(name, oldBase)
+	}
+	return filepath.Join(filepath.Dir(newVideo), name)
+}
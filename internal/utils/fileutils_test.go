@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src.mkv")
+	dst := filepath.Join(tmpDir, "dst.mkv")
+	assert.NoError(t, os.WriteFile(src, []byte("test data"), 0640))
+
+	copied, err := CopyFile(src, dst)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), copied)
+	content, err := os.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "test data", string(content))
+	info, err := os.Stat(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	_, err = CopyFile(filepath.Join(tmpDir, "missing.mkv"), dst)
+	assert.Error(t, err)
+}
+
+func TestLinkOrCopyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src.nfo")
+	dst := filepath.Join(tmpDir, "dst.nfo")
+	assert.NoError(t, os.WriteFile(src, []byte("<episodedetails/>"), 0644))
+	// an existing destination is replaced
+	assert.NoError(t, os.WriteFile(dst, []byte("stale"), 0644))
+
+	assert.NoError(t, LinkOrCopyFile(src, dst))
+
+	content, err := os.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "<episodedetails/>", string(content))
+}
+
+func TestSidecarFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{
+		"ep1.mkv", "ep1.nfo", "ep1-thumb.jpg", "ep1.en.srt", "ep10.mkv", "ep10.nfo", "ep1.txt",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte("x"), 0644))
+	}
+
+	sidecars, err := SidecarFiles(filepath.Join(tmpDir, "ep1.mkv"))
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(tmpDir, "ep1.nfo"),
+		filepath.Join(tmpDir, "ep1-thumb.jpg"),
+	}, sidecars)
+}
+
+func TestSidecarName(t *testing.T) {
+	assert.Equal(t, "/tv/ep1.nfo", SidecarName("/tv/ep1.nfo", "/tv/ep1.avi", "/tv/ep1.mkv"))
+	assert.Equal(t, "/tv/ep1-thumb.jpg", SidecarName("/tv/ep1-thumb.jpg", "/tv/ep1.avi", "/tv/ep1.mkv"))
+	// names carrying the video extension follow the conversion
+	assert.Equal(t, "/tv/ep1.mkv.nfo", SidecarName("/tv/ep1.avi.nfo", "/tv/ep1.avi", "/tv/ep1.mkv"))
+	assert.Equal(t, "/tv/ep1.mkv-thumb.jpg", SidecarName("/tv/ep1.avi-thumb.jpg", "/tv/ep1.avi", "/tv/ep1.mkv"))
+	// mirroring into another tree
+	assert.Equal(t, "/out/ep1.nfo", SidecarName("/tv/ep1.nfo", "/tv/ep1.mkv", "/out/ep1.mkv"))
+}
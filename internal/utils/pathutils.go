@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
-	"github.com/rs/zerolog/log"
+	"github.com/bmj2728/go-vmu/internal/discovery"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -39,37 +41,59 @@ func NFOPath(path string) (string, error) {
 	return nfoPath, nil
 }
 
+// GetFiles returns the video files under path using the default discovery settings
 func GetFiles(path string) ([]string, int, error) {
-	//to store paths
-	var files []string
-	//go get em
-	err := filepath.Walk(path,
-		// Helper function to collect paths
-		func(path string, info os.FileInfo, err error) error {
-			log.Debug().Msgf("Checking %s", path)
-			if err != nil {
-				return err
-			}
-			if info.IsDir() {
-				return nil
-			} else if strings.HasSuffix(info.Name(), ".avi") ||
-				strings.HasSuffix(info.Name(), ".mp4") ||
-				strings.HasSuffix(info.Name(), ".mkv") ||
-				strings.HasSuffix(info.Name(), ".mpg") ||
-				strings.HasSuffix(info.Name(), ".mov") ||
-				strings.HasSuffix(info.Name(), ".wmv") ||
-				strings.HasSuffix(info.Name(), ".flv") ||
-				strings.HasSuffix(info.Name(), ".m4v") {
-				files = append(files, path)
-				log.Debug().Msgf("Found file: %s", path)
-			}
-			return nil
-		})
-
-	//check for errors
+	discoverer, err := discovery.NewDiscoverer(discovery.NewConfig())
+	if err != nil {
+		return nil, 0, err
+	}
+	files, err := discoverer.Find(path)
 	if err != nil {
 		return nil, 0, err
 	}
-	log.Debug().Msgf("Found %d files", len(files))
 	return files, len(files), nil
 }
+
+// ReadPathList reads one path per line, or NUL separated paths as written by find -print0.
+// Blank entries and the line endings are dropped.
+func ReadPathList(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading path list: %w", err)
+	}
+	separator := "\n"
+	if bytes.IndexByte(data, 0) >= 0 {
+		separator = "\x00"
+	}
+	var paths []string
+	for _, entry := range strings.Split(string(data), separator) {
+		entry = strings.TrimRight(entry, "\r\n")
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		paths = append(paths, entry)
+	}
+	return paths, nil
+}
+
+// ExistingDir returns dir or its closest ancestor that exists, for looking at the filesystem an
+// output directory will be created on
+func ExistingDir(dir string) string {
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// InDir reports whether path is dir or lies below it. A sibling whose name merely starts with
+// ".." is not mistaken for a parent.
+func InDir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -177,3 +178,46 @@ func TestGetFiles(t *testing.T) {
 	assert.Nil(t, files)
 	assert.Zero(t, count)
 }
+
+func TestReadPathList(t *testing.T) {
+	paths, err := ReadPathList(strings.NewReader("/tv/a.mkv\r\n\n/tv/b c.mkv\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/tv/a.mkv", "/tv/b c.mkv"}, paths)
+
+	// NUL separated lists keep newlines that are part of a name
+	paths, err = ReadPathList(strings.NewReader("/tv/a.mkv\x00/tv/odd\nname.mkv\x00"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/tv/a.mkv", "/tv/odd\nname.mkv"}, paths)
+
+	paths, err = ReadPathList(strings.NewReader(""))
+	assert.NoError(t, err)
+	assert.Empty(t, paths)
+}
+
+func TestExistingDir(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "Show"), 0755))
+
+	assert.Equal(t, filepath.Join(dir, "Show"), ExistingDir(filepath.Join(dir, "Show", "Season 1", "Extras")))
+	assert.Equal(t, dir, ExistingDir(dir))
+}
+
+func TestInDir(t *testing.T) {
+	testCases := []struct {
+		name string
+		path string
+		in   bool
+	}{
+		{name: "Same directory", path: "/videos", in: true},
+		{name: "Child", path: "/videos/Show", in: true},
+		{name: "Dotted child", path: "/videos/..tagged", in: true},
+		{name: "Parent", path: "/", in: false},
+		{name: "Sibling", path: "/videos-tagged", in: false},
+		{name: "Cousin", path: "/other/Show", in: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.in, InDir("/videos", tc.path))
+		})
+	}
+}
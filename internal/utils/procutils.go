@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// killGrace is how long a killed command gets to release its pipes before Wait gives up on it
+const killGrace = 5 * time.Second
+
+// CommandContext is exec.CommandContext for the external tools vmu runs. When ctx ends the
+// command is killed along with anything it started, where the platform allows.
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	killProcessGroup(cmd)
+	cmd.WaitDelay = killGrace
+	return cmd
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package utils
+
+import "os/exec"
+
+// killProcessGroup leaves the default cancel in place, which kills the command itself
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandContext_KillsProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	// the shell waits on a child, killing only the shell would leave sleep holding the pipe
+	cmd := CommandContext(ctx, "sh", "-c", "sleep 30 & wait")
+	started := time.Now()
+
+	out, err := cmd.Output()
+
+	assert.Error(t, err)
+	assert.Empty(t, out)
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+	assert.Less(t, time.Since(started), killGrace)
+}
@@ -3,8 +3,12 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/bmj2728/go-vmu/internal/discovery"
+	"github.com/bmj2728/go-vmu/internal/mediaserver"
 	"github.com/bmj2728/go-vmu/internal/tracker"
 	"os"
+	"sort"
+	"strings"
 )
 
 func CountSuccesses(results []*tracker.ProcessResult) int {
@@ -38,7 +42,8 @@ func SplitResults(results []*tracker.ProcessResult) ([]*tracker.ProcessResult, [
 	successes := make([]*tracker.ProcessResult, 0)
 	failures := make([]*tracker.ProcessResult, 0)
 	for _, r := range results {
-		if r.Status == tracker.StatusSuccess || r.Status == tracker.StatusSkipped {
+		//an unsupported container will not change on a retry
+		if r.Status == tracker.StatusSuccess || r.Status == tracker.StatusSkipped || r.Status == tracker.StatusUnsupportedContainer {
 			successes = append(successes, r)
 		} else {
 			failures = append(failures, r)
@@ -47,6 +52,73 @@ func SplitResults(results []*tracker.ProcessResult) ([]*tracker.ProcessResult, [
 	return successes, failures
 }
 
+// DroppedKeys collects the NFO keys each container could not store, keyed by container name
+func DroppedKeys(results []*tracker.ProcessResult) map[string][]string {
+	seen := make(map[string]map[string]bool)
+	for _, r := range results {
+		if len(r.DroppedKeys) == 0 {
+			continue
+		}
+		if seen[r.Container] == nil {
+			seen[r.Container] = make(map[string]bool)
+		}
+		for _, key := range r.DroppedKeys {
+			seen[r.Container][key] = true
+		}
+	}
+	dropped := make(map[string][]string, len(seen))
+	for container, keys := range seen {
+		for key := range keys {
+			dropped[container] = append(dropped[container], key)
+		}
+		sort.Strings(dropped[container])
+	}
+	return dropped
+}
+
+func PrintDroppedKeys(dropped map[string][]string) {
+	if len(dropped) == 0 {
+		return
+	}
+	containers := make([]string, 0, len(dropped))
+	for container := range dropped {
+		containers = append(containers, container)
+	}
+	sort.Strings(containers)
+	fmt.Printf("Keys not supported by the container:\n")
+	for _, container := range containers {
+		fmt.Printf(" %s - %s\n", container, strings.Join(dropped[container], ", "))
+	}
+}
+
+// PrintExclusions lists the paths the discovery filters left out and the rule behind each
+func PrintExclusions(excluded []discovery.Exclusion) {
+	if len(excluded) == 0 {
+		return
+	}
+	fmt.Printf("Excluded %d paths:\n", len(excluded))
+	for _, e := range excluded {
+		fmt.Printf(" %s - %s\n", e.Path, e.Rule)
+	}
+}
+
+// ChangedFiles returns the paths of the files written during the run - a converted file or the
+// copy in the output directory rather than the input
+func ChangedFiles(results []*tracker.ProcessResult) []string {
+	changed := make([]string, 0)
+	for _, r := range results {
+		if r.Status != tracker.StatusSuccess {
+			continue
+		}
+		if r.OutputPath != "" {
+			changed = append(changed, r.OutputPath)
+		} else {
+			changed = append(changed, r.FilePath)
+		}
+	}
+	return changed
+}
+
 func SaveResults(filePath string, results []*tracker.ProcessResult) error {
 
 	humanizedResults := make([]*tracker.HumanReadableResult, 0)
@@ -66,6 +138,25 @@ func SaveResults(filePath string, results []*tracker.ProcessResult) error {
 	return nil
 }
 
+// LoadResultPaths returns the files recorded in a results.json or failures.json of an earlier run
+func LoadResultPaths(filePath string) ([]string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results file: %w", err)
+	}
+	var results []*tracker.HumanReadableResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse results file %s: %w", filePath, err)
+	}
+	paths := make([]string, 0, len(results))
+	for _, r := range results {
+		if r.FilePath != "" {
+			paths = append(paths, r.FilePath)
+		}
+	}
+	return paths, nil
+}
+
 func SaveFailures(filePath string, results []*tracker.ProcessResult) error {
 	// Filter only failed results
 	failures := make([]*tracker.HumanReadableResult, 0)
@@ -86,3 +177,38 @@ func SaveFailures(filePath string, results []*tracker.ProcessResult) error {
 
 	return nil
 }
+
+func SaveRefreshResults(filePath string, results []*mediaserver.RefreshResult) error {
+	if results == nil {
+		results = make([]*mediaserver.RefreshResult, 0)
+	}
+
+	jsonData, err := json.MarshalIndent(results, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal refresh results: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write refresh results file: %w", err)
+	}
+
+	return nil
+}
+
+// SaveExclusions writes the paths left out by the discovery filters to a JSON file
+func SaveExclusions(filePath string, excluded []discovery.Exclusion) error {
+	if excluded == nil {
+		excluded = make([]discovery.Exclusion, 0)
+	}
+
+	jsonData, err := json.MarshalIndent(excluded, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal exclusions: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write exclusions file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmj2728/go-vmu/internal/discovery"
+	"github.com/bmj2728/go-vmu/internal/tracker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitResults(t *testing.T) {
+	results := []*tracker.ProcessResult{
+		{FilePath: "a.mkv", Status: tracker.StatusSuccess},
+		{FilePath: "b.mkv", Status: tracker.StatusFFmpegError},
+		{FilePath: "c.mpg", Status: tracker.StatusUnsupportedContainer},
+	}
+
+	successes, failures := SplitResults(results)
+
+	// unsupported containers are final, retrying them cannot help
+	assert.Len(t, successes, 2)
+	assert.Len(t, failures, 1)
+	assert.Equal(t, "b.mkv", failures[0].FilePath)
+}
+
+func TestDroppedKeys(t *testing.T) {
+	results := []*tracker.ProcessResult{
+		{FilePath: "a.mp4", Container: "mp4", DroppedKeys: []string{"season", "actor"}},
+		{FilePath: "b.mp4", Container: "mp4", DroppedKeys: []string{"season", "episode"}},
+		{FilePath: "c.mkv", Container: "matroska"},
+	}
+
+	assert.Equal(t, map[string][]string{"mp4": {"actor", "episode", "season"}}, DroppedKeys(results))
+}
+
+func TestChangedFiles(t *testing.T) {
+	results := []*tracker.ProcessResult{
+		{FilePath: "/tv/a.mkv", OutputPath: "/tv/a.mkv", Status: tracker.StatusSuccess},
+		{FilePath: "/tv/b.avi", OutputPath: "/tv/b.mkv", Status: tracker.StatusSuccess},
+		{FilePath: "/tv/c.mkv", OutputPath: "/out/c.mkv", Status: tracker.StatusSuccess},
+		{FilePath: "/tv/d.mkv", Status: tracker.StatusFFmpegError},
+		// results saved before output paths were recorded
+		{FilePath: "/tv/e.mkv", Status: tracker.StatusSuccess},
+	}
+
+	assert.Equal(t, []string{"/tv/a.mkv", "/tv/b.mkv", "/out/c.mkv", "/tv/e.mkv"}, ChangedFiles(results))
+}
+
+func TestSaveExclusions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "excluded.json")
+
+	err := SaveExclusions(path, []discovery.Exclusion{{Path: "/tv/Show/Extras", Rule: "--exclude Extras"}})
+
+	assert.NoError(t, err)
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"path": "/tv/Show/Extras", "rule": "--exclude Extras"}]`, string(content))
+}
+
+func TestLoadResultPaths(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failures.json")
+	results := []*tracker.ProcessResult{
+		{FilePath: "/tv/a.mkv", Status: tracker.StatusFFmpegError},
+		{FilePath: "/tv/b.mkv", Status: tracker.StatusSuccess},
+		{FilePath: "/tv/c.mkv", Status: tracker.StatusNFONotFound},
+	}
+	assert.NoError(t, SaveFailures(path, results))
+
+	paths, err := LoadResultPaths(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/tv/a.mkv", "/tv/c.mkv"}, paths)
+
+	assert.NoError(t, os.WriteFile(path, []byte("not json"), 0644))
+	_, err = LoadResultPaths(path)
+	assert.Error(t, err)
+	_, err = LoadResultPaths(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
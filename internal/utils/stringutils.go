@@ -1,7 +1,19 @@
 package utils
 
-import "al.essio.dev/pkg/shellescape"
+import (
+	"al.essio.dev/pkg/shellescape"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
 
 func QuoteString(s string) string {
 	return shellescape.Quote(s)
 }
+
+// NewRunID returns a sortable, unique id for a run - e.g. 20250102T150405Z-1a2b3c
+func NewRunID() string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
@@ -3,6 +3,8 @@ package validator
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/bmj2728/go-vmu/internal/metrics"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/vansante/go-ffprobe.v2"
 	"time"
@@ -21,6 +23,9 @@ type MediaProberInterface interface {
 	AudioBitrate() string
 	AudioChannels() int
 	Size() string
+	ChapterCount() int
+	StreamCount(codecType string) int
+	Streams() []*ffprobe.Stream
 }
 
 // Ensure MediaProber implements MediaProberInterface
@@ -41,11 +46,33 @@ func NewMediaProber(timeout time.Duration) *MediaProber {
 	}
 }
 
+// NewMediaProberContext returns a prober that gives up when parent ends or timeout passes,
+// a zero timeout only follows parent
+func NewMediaProberContext(parent context.Context, timeout time.Duration) *MediaProber {
+	var ctx context.Context
+	var cancelFn context.CancelFunc
+	if timeout > 0 {
+		ctx, cancelFn = context.WithTimeout(parent, timeout)
+	} else {
+		ctx, cancelFn = context.WithCancel(parent)
+	}
+	return &MediaProber{
+		Context:  ctx,
+		CancelFn: cancelFn,
+	}
+}
+
 func (m *MediaProber) Probe(path string) error {
 	defer m.CancelFn()
+	started := time.Now()
 	data, err := ffprobe.ProbeURL(m.Context, path)
+	metrics.FFprobeDuration.Observe(metrics.Since(started))
 	if err != nil {
 		m.ProbeFailed = true
+		//ffprobe only reports being killed, keep the reason
+		if ctxErr := m.Context.Err(); ctxErr != nil {
+			return fmt.Errorf("probing %s stopped: %w (%v)", path, ctxErr, err)
+		}
 		return err
 	}
 	m.Data = data
@@ -156,6 +183,35 @@ func (m *MediaProber) Size() string {
 	return m.Data.Format.Size
 }
 
+func (m *MediaProber) ChapterCount() int {
+	if m.Data == nil {
+		return 0
+	}
+	return len(m.Data.Chapters)
+}
+
+// StreamCount counts the streams of a codec type such as "audio" or "subtitle"
+func (m *MediaProber) StreamCount(codecType string) int {
+	if m.Data == nil {
+		return 0
+	}
+	count := 0
+	for _, stream := range m.Data.Streams {
+		if stream.CodecType == codecType {
+			count++
+		}
+	}
+	return count
+}
+
+// Streams returns the probed streams, nil before probing
+func (m *MediaProber) Streams() []*ffprobe.Stream {
+	if m.Data == nil {
+		return nil
+	}
+	return m.Data.Streams
+}
+
 func (m *MediaProber) Tags() (ffprobe.Tags, error) {
 	if m.Data == nil || m.Data.Format.TagList == nil {
 		return nil, errors.New("No tags")
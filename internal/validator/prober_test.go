@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -85,3 +86,14 @@ func TestMediaProber_Methods_NilData(t *testing.T) {
 	assert.Equal(t, 0, prober.AudioChannels())
 	assert.Equal(t, "", prober.Size())
 }
+
+func TestMediaProber_Probe_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	prober := NewMediaProberContext(ctx, time.Minute)
+
+	err := prober.Probe("/non/existent/file.mkv")
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, prober.ProbeFailed)
+}
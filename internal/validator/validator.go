@@ -1,23 +1,58 @@
 package validator
 
 import (
+	"context"
 	"fmt"
+	"github.com/bmj2728/go-vmu/internal/tracks"
 	"github.com/rs/zerolog/log"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
+// ValidationMismatchError reports a property of the new file that differs from what was expected,
+// Old is the value of the original file or the expected value, New the value of the new file
+type ValidationMismatchError struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+func (e *ValidationMismatchError) Error() string {
+	return fmt.Sprintf("%s mismatch: expected %v, got %v", e.Field, e.Old, e.New)
+}
+
+// mismatch logs and returns the mismatch of field
+func mismatch(field string, old interface{}, got interface{}) error {
+	err := &ValidationMismatchError{Field: field, Old: old, New: got}
+	log.Error().Msg(err.Error())
+	return err
+}
+
 type Validator struct {
 	oldFile   string
 	newFile   string
 	oldProber MediaProberInterface
 	newProber MediaProberInterface
+	// chapters is the chapter count the new file must have when checkChapters is set
+	chapters      int
+	checkChapters bool
+	// addedStreams is how many streams of each codec type were muxed in from sidecars
+	addedStreams map[string]int
+	// tracks are the sidecars muxed in, each must be in the new file as it was written
+	tracks []tracks.Track
 }
 
-func NewValidator(oldFile string, newFile string, timeoutSecs time.Duration) *Validator {
-	timeout := timeoutSecs * time.Second
-	log.Info().Str("timeout", timeout.String()).Msgf("Timeout set to %v", timeout)
-	oldProber := NewMediaProber(timeout)
-	newProber := NewMediaProber(timeout)
+func NewValidator(oldFile string, newFile string, timeout time.Duration) *Validator {
+	return NewValidatorContext(context.Background(), oldFile, newFile, timeout)
+}
+
+// NewValidatorContext returns a validator whose probes stop when ctx ends. Both probers start
+// their clock now, so timeout bounds the whole validation - zero leaves it to ctx.
+func NewValidatorContext(ctx context.Context, oldFile string, newFile string, timeout time.Duration) *Validator {
+	log.Debug().Str("timeout", timeout.String()).Msgf("Validation timeout set to %v", timeout)
+	oldProber := NewMediaProberContext(ctx, timeout)
+	newProber := NewMediaProberContext(ctx, timeout)
 	return &Validator{
 		oldFile:   oldFile,
 		newFile:   newFile,
@@ -26,6 +61,37 @@ func NewValidator(oldFile string, newFile string, timeoutSecs time.Duration) *Va
 	}
 }
 
+// WithAddedStreams returns a copy of the validator that checks the new file gained count streams of codecType
+func (v *Validator) WithAddedStreams(codecType string, count int) *Validator {
+	validator := *v
+	validator.addedStreams = make(map[string]int, len(v.addedStreams)+1)
+	for k, n := range v.addedStreams {
+		validator.addedStreams[k] = n
+	}
+	validator.addedStreams[codecType] += count
+	return &validator
+}
+
+// WithTracks returns a copy of the validator that checks the new file gained the sidecar tracks.
+// Matroska outputs are also checked for the language, title and disposition of each track.
+func (v *Validator) WithTracks(added []tracks.Track) *Validator {
+	validator := *v
+	validator.tracks = append(append([]tracks.Track(nil), v.tracks...), added...)
+	result := &validator
+	for _, track := range added {
+		result = result.WithAddedStreams(track.Kind, 1)
+	}
+	return result
+}
+
+// WithChapterCount returns a copy of the validator that also checks the new file's chapter count
+func (v *Validator) WithChapterCount(count int) *Validator {
+	validator := *v
+	validator.chapters = count
+	validator.checkChapters = true
+	return &validator
+}
+
 func (v *Validator) Validate() error {
 	err := v.oldProber.Probe(v.oldFile)
 	if err != nil {
@@ -43,44 +109,56 @@ func (v *Validator) Validate() error {
 	//}
 
 	if v.oldProber.VideoCodec() != v.newProber.VideoCodec() {
-		log.Error().Msg("Video codec mismatch")
-		return fmt.Errorf("video codec mismatch")
+		return mismatch("video codec", v.oldProber.VideoCodec(), v.newProber.VideoCodec())
 	}
 
 	if v.oldProber.VideoBitrate() != v.newProber.VideoBitrate() {
-		log.Error().Msg("Video bitrate mismatch")
-		return fmt.Errorf("video bitrate mismatch")
+		return mismatch("video bitrate", v.oldProber.VideoBitrate(), v.newProber.VideoBitrate())
 	}
 
 	if v.oldProber.VideoHeight() != v.newProber.VideoHeight() {
-		log.Error().Msg("Height mismatch")
-		return fmt.Errorf("height mismatch")
+		return mismatch("height", v.oldProber.VideoHeight(), v.newProber.VideoHeight())
 	}
 
 	if v.oldProber.VideoWidth() != v.newProber.VideoWidth() {
-		log.Error().Msg("Width mismatch")
-		return fmt.Errorf("width mismatch")
+		return mismatch("width", v.oldProber.VideoWidth(), v.newProber.VideoWidth())
 	}
 
 	if v.oldProber.VideoAspectRatio() != v.newProber.VideoAspectRatio() {
-		log.Error().Msg("Aspect ratio mismatch")
-		return fmt.Errorf("aspect ratio mismatch")
+		return mismatch("aspect ratio", v.oldProber.VideoAspectRatio(), v.newProber.VideoAspectRatio())
 	}
 
 	if v.oldProber.AudioCodec() != v.newProber.AudioCodec() {
-		log.Error().Msg("Audio codec mismatch")
-		return fmt.Errorf("audio codec mismatch")
+		return mismatch("audio codec", v.oldProber.AudioCodec(), v.newProber.AudioCodec())
 	}
 
 	if v.oldProber.AudioBitrate() != v.newProber.AudioBitrate() {
-		log.Error().Msg("Audio bitrate mismatch")
-		return fmt.Errorf("audio bitrate mismatch")
+		return mismatch("audio bitrate", v.oldProber.AudioBitrate(), v.newProber.AudioBitrate())
 	}
 
 	if v.oldProber.AudioChannels() != v.newProber.AudioChannels() {
-		log.Error().Msg("Audio channels mismatch")
-		return fmt.Errorf("audio channels mismatch")
+		return mismatch("audio channels", v.oldProber.AudioChannels(), v.newProber.AudioChannels())
+	}
+	if v.checkChapters && v.newProber.ChapterCount() != v.chapters {
+		return mismatch("chapter count", v.chapters, v.newProber.ChapterCount())
 	}
+
+	for codecType, added := range v.addedStreams {
+		expected := v.oldProber.StreamCount(codecType) + added
+		if actual := v.newProber.StreamCount(codecType); actual != expected {
+			return mismatch(codecType+" stream count", expected, actual)
+		}
+	}
+
+	//other containers drop the title and most dispositions of a track
+	if strings.EqualFold(filepath.Ext(v.newFile), ".mkv") {
+		for _, track := range v.tracks {
+			if !track.Written(v.newProber.Streams()) {
+				return mismatch(filepath.Base(track.Path)+" track", track, "no such stream")
+			}
+		}
+	}
+
 	//hmmmm Size mismatch oldFile: 1696803304  newFile: 1692549566
 	//if v.oldProber.Size() != v.newProber.Size() {
 	//	log.Error().Msgf("Size mismatch oldFile: %v newFile: %v", v.oldProber.Size(), v.newProber.Size())
@@ -1,11 +1,15 @@
 package validator
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/bmj2728/go-vmu/internal/tracks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gopkg.in/vansante/go-ffprobe.v2"
 )
 
 // MockMediaProber is a mock implementation of MediaProber for testing
@@ -72,14 +76,44 @@ func (m *MockMediaProber) Size() string {
 	return args.String(0)
 }
 
+func (m *MockMediaProber) ChapterCount() int {
+	args := m.Called()
+	return args.Int(0)
+}
+
+func (m *MockMediaProber) StreamCount(codecType string) int {
+	args := m.Called(codecType)
+	return args.Int(0)
+}
+
+func (m *MockMediaProber) Streams() []*ffprobe.Stream {
+	args := m.Called()
+	streams, _ := args.Get(0).([]*ffprobe.Stream)
+	return streams
+}
+
 func TestNewValidator(t *testing.T) {
-	validator := NewValidator("old.mkv", "new.mkv", 30)
+	validator := NewValidator("old.mkv", "new.mkv", 30*time.Second)
 
 	assert.NotNil(t, validator)
 	assert.Equal(t, "old.mkv", validator.oldFile)
 	assert.Equal(t, "new.mkv", validator.newFile)
 	assert.NotNil(t, validator.oldProber)
 	assert.NotNil(t, validator.newProber)
+	deadline, ok := validator.oldProber.(*MediaProber).Context.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(30*time.Second), deadline, time.Second)
+}
+
+func TestNewValidatorContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	validator := NewValidatorContext(ctx, "old.mkv", "new.mkv", 0)
+
+	//no stage timeout, the probes only follow ctx
+	_, ok := validator.newProber.(*MediaProber).Context.Deadline()
+	assert.False(t, ok)
+	cancel()
+	assert.ErrorIs(t, validator.newProber.(*MediaProber).Context.Err(), context.Canceled)
 }
 
 func TestValidator_Validate_ProbeError(t *testing.T) {
@@ -185,7 +219,7 @@ func TestValidator_Validate_Mismatches(t *testing.T) {
 				oldProber.On("VideoCodec").Return("h264")
 				newProber.On("VideoCodec").Return("h265")
 			},
-			expectedErrMsg: "video codec mismatch",
+			expectedErrMsg: "video codec mismatch: expected h264, got h265",
 		},
 		{
 			name: "Video bitrate mismatch",
@@ -195,7 +229,7 @@ func TestValidator_Validate_Mismatches(t *testing.T) {
 				oldProber.On("VideoBitrate").Return("1000000")
 				newProber.On("VideoBitrate").Return("2000000")
 			},
-			expectedErrMsg: "video bitrate mismatch",
+			expectedErrMsg: "video bitrate mismatch: expected 1000000, got 2000000",
 		},
 		{
 			name: "Video height mismatch",
@@ -207,7 +241,7 @@ func TestValidator_Validate_Mismatches(t *testing.T) {
 				oldProber.On("VideoHeight").Return(1080)
 				newProber.On("VideoHeight").Return(720)
 			},
-			expectedErrMsg: "height mismatch",
+			expectedErrMsg: "height mismatch: expected 1080, got 720",
 		},
 		{
 			name: "Video width mismatch",
@@ -221,7 +255,7 @@ func TestValidator_Validate_Mismatches(t *testing.T) {
 				oldProber.On("VideoWidth").Return(1920)
 				newProber.On("VideoWidth").Return(1280)
 			},
-			expectedErrMsg: "width mismatch",
+			expectedErrMsg: "width mismatch: expected 1920, got 1280",
 		},
 		{
 			name: "Aspect ratio mismatch",
@@ -237,7 +271,7 @@ func TestValidator_Validate_Mismatches(t *testing.T) {
 				oldProber.On("VideoAspectRatio").Return("16:9")
 				newProber.On("VideoAspectRatio").Return("4:3")
 			},
-			expectedErrMsg: "aspect ratio mismatch",
+			expectedErrMsg: "aspect ratio mismatch: expected 16:9, got 4:3",
 		},
 		{
 			name: "Audio codec mismatch",
@@ -255,7 +289,7 @@ func TestValidator_Validate_Mismatches(t *testing.T) {
 				oldProber.On("AudioCodec").Return("aac")
 				newProber.On("AudioCodec").Return("mp3")
 			},
-			expectedErrMsg: "audio codec mismatch",
+			expectedErrMsg: "audio codec mismatch: expected aac, got mp3",
 		},
 		{
 			name: "Audio bitrate mismatch",
@@ -275,7 +309,7 @@ func TestValidator_Validate_Mismatches(t *testing.T) {
 				oldProber.On("AudioBitrate").Return("128000")
 				newProber.On("AudioBitrate").Return("192000")
 			},
-			expectedErrMsg: "audio bitrate mismatch",
+			expectedErrMsg: "audio bitrate mismatch: expected 128000, got 192000",
 		},
 		{
 			name: "Audio channels mismatch",
@@ -297,7 +331,7 @@ func TestValidator_Validate_Mismatches(t *testing.T) {
 				oldProber.On("AudioChannels").Return(2)
 				newProber.On("AudioChannels").Return(6)
 			},
-			expectedErrMsg: "audio channels mismatch",
+			expectedErrMsg: "audio channels mismatch: expected 2, got 6",
 		},
 	}
 
@@ -326,8 +360,99 @@ func TestValidator_Validate_Mismatches(t *testing.T) {
 			// Verify the expected error is returned
 			assert.Error(t, err)
 			assert.Equal(t, tc.expectedErrMsg, err.Error())
+			var mismatchErr *ValidationMismatchError
+			assert.ErrorAs(t, err, &mismatchErr)
 			oldProber.AssertExpectations(t)
 			newProber.AssertExpectations(t)
 		})
 	}
 }
+
+func TestValidator_Validate_ChapterCount(t *testing.T) {
+	setup := func(chapters int) (*MockMediaProber, *MockMediaProber) {
+		oldProber, newProber := matchingProbers(t, "new.mkv")
+		newProber.On("ChapterCount").Return(chapters)
+		return oldProber, newProber
+	}
+
+	oldProber, newProber := setup(3)
+	validator := (&Validator{oldFile: "old.mkv", newFile: "new.mkv", oldProber: oldProber, newProber: newProber}).WithChapterCount(3)
+	assert.NoError(t, validator.Validate())
+
+	oldProber, newProber = setup(0)
+	validator = (&Validator{oldFile: "old.mkv", newFile: "new.mkv", oldProber: oldProber, newProber: newProber}).WithChapterCount(3)
+	err := validator.Validate()
+	assert.Error(t, err)
+	assert.Equal(t, "chapter count mismatch: expected 3, got 0", err.Error())
+	var mismatchErr *ValidationMismatchError
+	assert.ErrorAs(t, err, &mismatchErr)
+	assert.Equal(t, &ValidationMismatchError{Field: "chapter count", Old: 3, New: 0}, mismatchErr)
+}
+
+func TestValidator_Validate_AddedStreams(t *testing.T) {
+	setup := func(newSubtitles int) (*MockMediaProber, *MockMediaProber) {
+		oldProber, newProber := matchingProbers(t, "new.mkv")
+		oldProber.On("StreamCount", "subtitle").Return(1)
+		newProber.On("StreamCount", "subtitle").Return(newSubtitles)
+		return oldProber, newProber
+	}
+
+	oldProber, newProber := setup(3)
+	validator := (&Validator{oldFile: "old.mkv", newFile: "new.mkv", oldProber: oldProber, newProber: newProber}).WithAddedStreams("subtitle", 2)
+	assert.NoError(t, validator.Validate())
+
+	oldProber, newProber = setup(2)
+	validator = (&Validator{oldFile: "old.mkv", newFile: "new.mkv", oldProber: oldProber, newProber: newProber}).WithAddedStreams("subtitle", 2)
+	err := validator.Validate()
+	assert.Error(t, err)
+	assert.Equal(t, "subtitle stream count mismatch: expected 3, got 2", err.Error())
+}
+
+// matchingProbers returns probers for old.mkv and newFile that agree on every codec, bitrate and dimension
+func matchingProbers(t *testing.T, newFile string) (*MockMediaProber, *MockMediaProber) {
+	oldProber := NewMockMediaProber()
+	newProber := NewMockMediaProber()
+	oldProber.On("Probe", "old.mkv").Return(nil)
+	newProber.On("Probe", newFile).Return(nil)
+	for _, prober := range []*MockMediaProber{oldProber, newProber} {
+		prober.On("VideoCodec").Return("h264")
+		prober.On("VideoBitrate").Return("1000000")
+		prober.On("VideoHeight").Return(1080)
+		prober.On("VideoWidth").Return(1920)
+		prober.On("VideoAspectRatio").Return("16:9")
+		prober.On("AudioCodec").Return("aac")
+		prober.On("AudioBitrate").Return("128000")
+		prober.On("AudioChannels").Return(2)
+	}
+	t.Cleanup(func() {
+		oldProber.AssertExpectations(t)
+		newProber.AssertExpectations(t)
+	})
+	return oldProber, newProber
+}
+
+func TestValidator_Validate_Tracks(t *testing.T) {
+	forced := tracks.Track{Path: "/tv/ep1.en.forced.srt", Kind: tracks.KindSubtitle, Language: "eng", Forced: true}
+	setup := func(newFile string, disposition ffprobe.StreamDisposition) *Validator {
+		oldProber, newProber := matchingProbers(t, newFile)
+		oldProber.On("StreamCount", "subtitle").Return(0)
+		newProber.On("StreamCount", "subtitle").Return(1)
+		newProber.On("Streams").Return([]*ffprobe.Stream{
+			{CodecType: "video"},
+			{CodecType: "subtitle", TagList: ffprobe.Tags{"language": "eng"}, Disposition: disposition},
+		}).Maybe()
+		return (&Validator{oldFile: "old.mkv", newFile: newFile, oldProber: oldProber, newProber: newProber}).WithTracks([]tracks.Track{forced})
+	}
+
+	assert.NoError(t, setup("new.mkv", ffprobe.StreamDisposition{Forced: 1}).Validate())
+
+	// the stream landed without its forced flag
+	err := setup("new.mkv", ffprobe.StreamDisposition{}).Validate()
+	var mismatchErr *ValidationMismatchError
+	assert.ErrorAs(t, err, &mismatchErr)
+	assert.Equal(t, "ep1.en.forced.srt track", mismatchErr.Field)
+	assert.EqualError(t, err, "ep1.en.forced.srt track mismatch: expected subtitle eng (forced), got no such stream")
+
+	// mp4 does not keep the disposition, only the count is checked
+	assert.NoError(t, setup("new.mp4", ffprobe.StreamDisposition{}).Validate())
+}